@@ -0,0 +1,94 @@
+package camera
+
+import (
+	"go-tracer/src/framebuffer"
+	"go-tracer/src/hittable"
+	"go-tracer/src/sampler"
+	"go-tracer/src/vec3"
+	"math"
+)
+
+// Samples an adaptive pixel takes before it may stop, so a pixel whose first
+// few rays happen to agree isn't mistaken for a converged one
+const DefaultMinSamples = 16
+
+// Mean luminance below which noise is judged in absolute terms, so that nearly
+// black pixels don't sample forever chasing a relative error
+const adaptiveMeanFloor = 0.1
+
+// Mean and variance of a stream of values, updated one value at a time
+// (Welford's algorithm)
+type runningStats struct {
+	n    int
+	mean float64
+	m2   float64 // sum of squared differences from the mean
+}
+
+func (s *runningStats) add(x float64) {
+	s.n++
+	delta := x - s.mean
+	s.mean += delta / float64(s.n)
+	s.m2 += delta * (x - s.mean)
+}
+
+func (s *runningStats) variance() float64 {
+	if s.n < 2 {
+		return 0
+	}
+	return s.m2 / float64(s.n-1)
+}
+
+// Whether the standard error of the mean is within threshold of the mean
+func (s *runningStats) converged(threshold float64) bool {
+	stderr := math.Sqrt(s.variance() / float64(s.n))
+	return stderr <= threshold*math.Max(s.mean, adaptiveMeanFloor)
+}
+
+func (c *Camera) adaptive() bool {
+	return c.NoiseThreshold > 0
+}
+
+func (c *Camera) minSamples() int {
+	if c.MinSamples > 0 {
+		return min(c.MinSamples, c.SamplesPerPixel)
+	}
+	return min(DefaultMinSamples, c.SamplesPerPixel)
+}
+
+// Whether an adaptive pixel with these stats may stop sampling
+func (c *Camera) pixelConverged(stats *runningStats) bool {
+	return stats.n >= c.minSamples() && stats.converged(c.NoiseThreshold)
+}
+
+// Sample pixel (i, j) one ray at a time, splatting each sample into fm and
+// adding its luminance to stats, until the noise drops below NoiseThreshold
+// or stats holds limit samples
+func (c *Camera) samplePixelAdaptive(i, j int, world hittable.Hittable, smp sampler.Sampler, stats *runningStats, limit int, aov *aovSample, fm *film) {
+	for stats.n < limit && !c.pixelConverged(stats) {
+		sample := c.samplePixel(i, j, world, smp, stats.n, 1, aov, fm)
+		stats.add(luminance(sample))
+	}
+}
+
+// Color-coded map of SampleCounts: blue for pixels that stopped after a few
+// samples through green to red for those that needed all SamplesPerPixel.
+// Returns nil if the last render wasn't adaptive.
+func (c *Camera) SampleHeatmap() *framebuffer.Framebuffer {
+	if c.SampleCounts == nil {
+		return nil
+	}
+	fb := framebuffer.New(c.ImageWidth, c.ImageHeight)
+	for idx, n := range c.SampleCounts {
+		fb.Pixels[idx] = heatColor(float64(n) / float64(c.SamplesPerPixel))
+	}
+	return fb
+}
+
+// Blue at 0, green at 0.5, red at 1
+func heatColor(t float64) vec3.Vec3 {
+	t = math.Max(0, math.Min(t, 1))
+	if t < 0.5 {
+		return vec3.Vec3{X: 0, Y: 2 * t, Z: 1 - 2*t}
+	}
+	return vec3.Vec3{X: 2*t - 1, Y: 2 - 2*t, Z: 0}
+}
@@ -0,0 +1,192 @@
+package camera
+
+import (
+	"go-tracer/src/framebuffer"
+	"go-tracer/src/hittable"
+	"go-tracer/src/interval"
+	"go-tracer/src/utils"
+	"go-tracer/src/vec3"
+	"math"
+)
+
+// Auxiliary outputs (AOVs) describing the first surface each camera ray hits,
+// for compositing and to guide the denoiser. All but the IDs are averaged over
+// the samples of a pixel; the IDs, which can't be blended, come from a single
+// ray through the pixel center. IDs are stored in all three channels.
+type AOVs struct {
+	Albedo     *framebuffer.Framebuffer // surface color before lighting; the background, clamped to 1, where rays escape
+	Normal     *framebuffer.Framebuffer // world-space unit normal facing the camera; zero where rays escape
+	Depth      *framebuffer.Framebuffer // distance from the ray origin to the hit; zero where rays escape
+	Position   *framebuffer.Framebuffer // world-space hit point; zero where rays escape
+	MaterialID *framebuffer.Framebuffer // ID of the TaggedMaterial hit, 0 if none
+	ObjectID   *framebuffer.Framebuffer // HitRecord.ObjectID of the object hit, 0 if none
+}
+
+func NewAOVs(width, height int) *AOVs {
+	return &AOVs{
+		Albedo:     framebuffer.New(width, height),
+		Normal:     framebuffer.New(width, height),
+		Depth:      framebuffer.New(width, height),
+		Position:   framebuffer.New(width, height),
+		MaterialID: framebuffer.New(width, height),
+		ObjectID:   framebuffer.New(width, height),
+	}
+}
+
+// A named AOV buffer, e.g. for writing each to its own file
+type AOVLayer struct {
+	Name string
+	FB   *framebuffer.Framebuffer
+}
+
+// Every buffer with a short name, in a fixed order
+func (a *AOVs) Layers() []AOVLayer {
+	return []AOVLayer{
+		{"albedo", a.Albedo},
+		{"normal", a.Normal},
+		{"depth", a.Depth},
+		{"position", a.Position},
+		{"material_id", a.MaterialID},
+		{"object_id", a.ObjectID},
+	}
+}
+
+// Version of the layer that reads well as an 8-bit image, where negative and
+// large values are lost: normals are mapped from [-1, 1] to [0, 1], depth and
+// position are scaled by their largest magnitude, and every ID gets its own
+// arbitrary color (0 stays black). Use an HDR format for the exact values.
+func (l AOVLayer) Display() *framebuffer.Framebuffer {
+	out := framebuffer.New(l.FB.Width, l.FB.Height)
+	switch l.Name {
+	case "normal":
+		for idx, n := range l.FB.Pixels {
+			out.Pixels[idx] = *n.Add(vec3.Vec3{X: 1, Y: 1, Z: 1}).MultiplyFloat(0.5)
+		}
+	case "depth", "position":
+		largest := 0.0
+		for _, p := range l.FB.Pixels {
+			largest = math.Max(largest, math.Max(math.Abs(p.X), math.Max(math.Abs(p.Y), math.Abs(p.Z))))
+		}
+		if largest == 0 {
+			return out
+		}
+		for idx, p := range l.FB.Pixels {
+			scaled := *p.DivideFloat(largest)
+			if l.Name == "position" {
+				// Centre on grey so negative coordinates show
+				scaled = *scaled.Add(vec3.Vec3{X: 1, Y: 1, Z: 1}).MultiplyFloat(0.5)
+			}
+			out.Pixels[idx] = scaled
+		}
+	case "material_id", "object_id":
+		for idx, p := range l.FB.Pixels {
+			out.Pixels[idx] = idColor(int(p.X))
+		}
+	default:
+		copy(out.Pixels, l.FB.Pixels)
+	}
+	return out
+}
+
+// Scatter IDs over the color cube so neighbouring IDs look different
+func idColor(id int) vec3.Vec3 {
+	if id == 0 {
+		return vec3.Vec3{}
+	}
+	h := uint32(id) * 2654435761
+	return vec3.Vec3{
+		X: 0.2 + 0.8*float64(h&0xff)/255,
+		Y: 0.2 + 0.8*float64((h>>8)&0xff)/255,
+		Z: 0.2 + 0.8*float64((h>>16)&0xff)/255,
+	}
+}
+
+// Averaged AOV values of one or more samples of a pixel
+type aovSample struct {
+	Albedo   vec3.Vec3
+	Normal   vec3.Vec3
+	Depth    float64
+	Position vec3.Vec3
+}
+
+func (s *aovSample) add(o aovSample) {
+	s.Albedo.PlusEqual(o.Albedo)
+	s.Normal.PlusEqual(o.Normal)
+	s.Depth += o.Depth
+	s.Position.PlusEqual(o.Position)
+}
+
+func (s aovSample) scaled(scale float64) aovSample {
+	return aovSample{
+		Albedo:   *s.Albedo.MultiplyFloat(scale),
+		Normal:   *s.Normal.MultiplyFloat(scale),
+		Depth:    s.Depth * scale,
+		Position: *s.Position.MultiplyFloat(scale),
+	}
+}
+
+func (a *AOVs) at(i, j int) aovSample {
+	return aovSample{Albedo: a.Albedo.At(i, j), Normal: a.Normal.At(i, j), Depth: a.Depth.At(i, j).X, Position: a.Position.At(i, j)}
+}
+
+func (a *AOVs) set(i, j int, s aovSample) {
+	a.Albedo.Set(i, j, s.Albedo)
+	a.Normal.Set(i, j, s.Normal)
+	a.Depth.Set(i, j, vec3.Vec3{X: s.Depth, Y: s.Depth, Z: s.Depth})
+	a.Position.Set(i, j, s.Position)
+}
+
+// Copy with each pixel of the averaged buffers divided by its sample count,
+// turning sums into averages; the IDs are shared. Pixels with no samples
+// stay zero.
+func (a *AOVs) averaged(counts []int) *AOVs {
+	out := &AOVs{
+		Albedo:     framebuffer.New(a.Albedo.Width, a.Albedo.Height),
+		Normal:     framebuffer.New(a.Albedo.Width, a.Albedo.Height),
+		Depth:      framebuffer.New(a.Albedo.Width, a.Albedo.Height),
+		Position:   framebuffer.New(a.Albedo.Width, a.Albedo.Height),
+		MaterialID: a.MaterialID,
+		ObjectID:   a.ObjectID,
+	}
+	for j := 0; j < a.Albedo.Height; j++ {
+		for i := 0; i < a.Albedo.Width; i++ {
+			if n := counts[j*a.Albedo.Width+i]; n > 0 {
+				out.set(i, j, a.at(i, j).scaled(1.0/float64(n)))
+			}
+		}
+	}
+	return out
+}
+
+// Record in a the IDs of whatever the ray through the center of pixel (i, j)
+// hits. The ray starts at the lens center at ShutterOpen, so it draws no
+// random numbers.
+func (c *Camera) setPixelIDs(a *AOVs, i, j int, world hittable.Hittable) {
+	pixel_center := c.Pixel00_loc.Add(*c.PixelDeltaU.MultiplyFloat(float64(i))).Add(*c.PixelDeltaV.MultiplyFloat(float64(j)))
+	r := vec3.Ray{Origin: c.Center, Direction: *pixel_center.Subtract(c.Center), Time: c.ShutterOpen}
+
+	var rec hittable.HitRecord
+	material, object := 0.0, 0.0
+	if world.Hit(&r, interval.Interval{Min: 0.001, Max: utils.INFINITY}, &rec) {
+		material, object = float64(hittable.MaterialID(rec.Mat)), float64(rec.ObjectID)
+	}
+	a.MaterialID.Set(i, j, vec3.Vec3{X: material, Y: material, Z: material})
+	a.ObjectID.Set(i, j, vec3.Vec3{X: object, Y: object, Z: object})
+}
+
+// AOVs of the first thing r hits. This traces r again rather than hooking
+// into RayColor; hitting the world draws no random numbers, so the image
+// comes out the same whether or not AOVs are recorded.
+func (c *Camera) firstHit(r *vec3.Ray, world hittable.Hittable) aovSample {
+	var rec hittable.HitRecord
+	if !world.Hit(r, interval.Interval{Min: 0.001, Max: utils.INFINITY}, &rec) {
+		bg := c.background().Value(r)
+		return aovSample{Albedo: vec3.Vec3{X: math.Min(bg.X, 1), Y: math.Min(bg.Y, 1), Z: math.Min(bg.Z, 1)}}
+	}
+	return aovSample{
+		Albedo:   hittable.SurfaceAlbedo(&rec),
+		Normal:   *rec.Normal.UnitVector(),
+		Depth:    rec.T * r.GetDirection().Length(),
+		Position: rec.P,
+	}
+}
@@ -0,0 +1,36 @@
+package camera
+
+import "go-tracer/src/vec3"
+
+// What a ray sees when it leaves the scene without hitting anything
+type Background interface {
+	Value(r *vec3.Ray) vec3.Vec3
+}
+
+// Same color in every direction. The zero value is black, i.e. no background
+// light, so all light has to come from emissive materials.
+type SolidBackground struct {
+	Color vec3.Vec3
+}
+
+func (b SolidBackground) Value(r *vec3.Ray) vec3.Vec3 {
+	return b.Color
+}
+
+// Vertical blend from Bottom (looking straight down) to Top (straight up)
+type GradientBackground struct {
+	Bottom vec3.Vec3
+	Top    vec3.Vec3
+}
+
+func (b GradientBackground) Value(r *vec3.Ray) vec3.Vec3 {
+	unit_direction := r.GetDirection().UnitVector()
+	a := 0.5 * (unit_direction.GetY() + 1.0)
+	return b.Bottom.MultiplyFloat(1.0 - a).Add(*b.Top.MultiplyFloat(a))
+}
+
+// The white to blue sky used when a camera has no Background set
+var DefaultBackground Background = GradientBackground{
+	Bottom: vec3.Vec3{X: 1.0, Y: 1.0, Z: 1.0},
+	Top:    vec3.Vec3{X: 0.5, Y: 0.7, Z: 1.0},
+}
@@ -1,16 +1,19 @@
 package camera
 
 import (
+	"context"
 	"fmt"
+	"go-tracer/src/filter"
+	"go-tracer/src/framebuffer"
 	"go-tracer/src/hittable"
 	"go-tracer/src/interval"
+	"go-tracer/src/sampler"
 	"go-tracer/src/utils"
 	"go-tracer/src/vec3"
 	"log"
 	"math"
-	"runtime"
 	"strconv"
-	"sync"
+	"sync/atomic"
 )
 
 type Camera struct {
@@ -25,6 +28,21 @@ type Camera struct {
 	ViewUp          vec3.Vec3
 	DefocusAngle    float64
 	FocusDistance   float64
+	ShutterOpen     float64 // rays are spread over [ShutterOpen, ShutterClose] to blur moving objects
+	ShutterClose    float64
+	Workers         int                 // goroutines used by RenderMulti, 0 means one per CPU
+	TileSize        int                 // edge length in pixels of the tiles handed to workers, 0 means DefaultTileSize
+	Seed            int64               // each pixel's random numbers are derived from this and its coordinates
+	Background      Background          // color of rays that escape the scene, nil means DefaultBackground
+	SamplesPerPass  int                 // samples per pixel added by each RenderProgressive pass, 0 means 1
+	Lights          hittable.Sampleable // emitters to sample directly from diffuse surfaces, nil to rely on scattering alone
+	RecordAOVs      bool                // also fill AOVs with first-hit data while rendering
+	NoiseThreshold  float64             // if positive, pixels stop sampling once this quiet (see RenderMulti), with SamplesPerPixel as the cap
+	MinSamples      int                 // samples an adaptive pixel takes before it may stop, 0 means DefaultMinSamples
+	SampleCounts    []int               // samples taken by each pixel, row by row, in the last adaptive render
+	Sampler         sampler.Kind        // how each pixel's samples are spread over the pixel, lens and bounces
+	Filter          filter.Filter       // how samples are weighted into nearby pixels, the zero value means a box over each pixel (AOVs always use that)
+	AOVs            *AOVs               // AOVs of the last render if RecordAOVs was set
 	Center          vec3.Point3
 	Pixel00_loc     vec3.Point3
 	PixelDeltaU     vec3.Vec3
@@ -34,157 +52,266 @@ type Camera struct {
 	U, V, W         vec3.Vec3
 }
 
-func (c *Camera) RayColor(r *vec3.Ray, depth int, world hittable.Hittable) vec3.Vec3 {
+func (c *Camera) RayColor(r *vec3.Ray, depth int, world hittable.Hittable, rnd utils.Random) vec3.Vec3 {
 	var rec hittable.HitRecord
 
 	if depth <= 0 {
 		return vec3.Vec3{X: 0, Y: 0, Z: 0}
 	}
 
-	if world.Hit(r, interval.Interval{Min: 0.001, Max: utils.INFINITY}, &rec) {
-		var scattered vec3.Ray
-		var attenuation vec3.Vec3
-		if (rec.Mat).Scatter(r, &rec, &attenuation, &scattered) {
-			return *attenuation.MultiplyVec(c.RayColor(&scattered, depth-1, world))
-		} else {
-			return vec3.Vec3{X: 0, Y: 0, Z: 0}
-		}
+	// Every bounce draws the number media use for their free path here, so
+	// the sampler dimensions a path uses don't depend on what the ray passes
+	// near, and asking the world about the same ray twice gives one answer
+	segment := *r
+	segment.FreePath = rnd.Float64()
+	r = &segment
+
+	if !world.Hit(r, interval.Interval{Min: 0.001, Max: utils.INFINITY}, &rec) {
+		return c.background().Value(r)
 	}
 
-	unit_direction := r.GetDirection().UnitVector()
-	a := 0.5 * (unit_direction.GetY() + 1.0)
-	startValue := vec3.Vec3{X: 1.0, Y: 1.0, Z: 1.0}
-	endValue := vec3.Vec3{X: 0.5, Y: 0.7, Z: 1.0}
-	computedValue := startValue.MultiplyFloat(1.0 - a).Add(*endValue.MultiplyFloat(a))
-	return computedValue
-}
+	emitted := (rec.Mat).Emitted(r, &rec)
+	var srec hittable.ScatterRecord
+	if !(rec.Mat).Scatter(r, &rec, &srec, rnd) {
+		return emitted
+	}
 
-func (c *Camera) computePixelColor(i, j int, world *hittable.Hittable) vec3.Vec3 {
-	var pixel_color vec3.Vec3
-	for sample := 0; sample < c.SamplesPerPixel; sample++ {
-		r := c.GetRay(i, j)
-		pixel_color.PlusEqual(c.RayColor(&r, c.MaxDepth, *world))
+	if srec.SkipPDF {
+		return emitted.Add(*srec.Attenuation.MultiplyVec(c.RayColor(&srec.SkipPDFRay, depth-1, world, rnd)))
 	}
-	return pixel_color
-}
 
-// Multi-threaded rendering
-type PixelJob struct {
-	i, j int
-}
+	// Send half the rays towards the lights and half where the material
+	// prefers, weighting by the combined density so the result stays unbiased
+	var p hittable.PDF = srec.PDF
+	if c.Lights != nil {
+		p = hittable.MixturePDF{P0: hittable.HittablePDF{Objects: c.Lights, Origin: rec.P}, P1: srec.PDF}
+	}
+
+	scattered := vec3.Ray{Origin: rec.P, Direction: p.Generate(rnd), Time: r.Time}
+	pdf_value := p.Value(scattered.Direction)
+	if pdf_value <= 0 {
+		return emitted
+	}
+	sample_color := c.RayColor(&scattered, depth-1, world, rnd)
+	if bsdf, ok := hittable.UntagMaterial(rec.Mat).(hittable.BSDF); ok {
+		color_from_scatter := bsdf.Eval(r, &rec, &scattered).MultiplyVec(sample_color).DivideFloat(pdf_value)
+		return emitted.Add(*color_from_scatter)
+	}
 
-type PixelResult struct {
-	i, j  int
-	color vec3.Vec3
+	scattering_pdf := (rec.Mat).ScatteringPDF(r, &rec, &scattered)
+	color_from_scatter := srec.Attenuation.MultiplyVec(sample_color).MultiplyFloat(scattering_pdf / pdf_value)
+	return emitted.Add(*color_from_scatter)
 }
 
-func (c *Camera) worker(jobs <-chan PixelJob, results chan<- PixelResult, world *hittable.Hittable, wg *sync.WaitGroup) {
-	defer wg.Done()
-	for job := range jobs {
-		color := c.computePixelColor(job.i, job.j, world)
-		results <- PixelResult{i: job.i, j: job.j, color: color}
+func (c *Camera) background() Background {
+	if c.Background == nil {
+		return DefaultBackground
 	}
+	return c.Background
 }
 
-func (c *Camera) RenderMulti(world hittable.Hittable) {
-	c.Initalize()
-	fmt.Println("P3")
-	fmt.Println(strconv.Itoa(c.ImageWidth) + " " + strconv.Itoa(c.ImageHeight))
-	fmt.Println("255")
-
-	numWorkers := runtime.NumCPU()
-	log.Println("Number of workers: ", numWorkers)
-
-	// Large channels take time to spin up...
-	jobs := make(chan PixelJob, c.ImageWidth*c.ImageHeight)
-	results := make(chan PixelResult, c.ImageWidth*c.ImageHeight)
+// Take the samples of pixel (i, j), SamplesPerPixel of them or fewer if
+// adaptive sampling decides the pixel is noise free sooner, and splat them
+// into fm
+func (c *Camera) renderPixel(i, j int, world hittable.Hittable, fm *film) {
+	smp := c.pixelSampler(c.Seed, i, j)
+	var aov *aovSample
+	if c.AOVs != nil {
+		aov = &aovSample{}
+	}
 
-	var wg sync.WaitGroup
-	for w := 0; w < numWorkers; w++ {
-		wg.Add(1)
-		go c.worker(jobs, results, &world, &wg)
+	n := c.SamplesPerPixel
+	if c.adaptive() {
+		var stats runningStats
+		c.samplePixelAdaptive(i, j, world, smp, &stats, c.SamplesPerPixel, aov, fm)
+		n = stats.n
+		c.SampleCounts[j*c.ImageWidth+i] = n
+	} else {
+		c.samplePixel(i, j, world, smp, 0, n, aov, fm)
 	}
 
-	go func() {
-		for j := 0; j < c.ImageHeight; j++ {
-			for i := 0; i < c.ImageWidth; i++ {
-				jobs <- PixelJob{i: i, j: j}
-			}
-		}
-		close(jobs)
-	}()
+	if aov != nil {
+		c.AOVs.set(i, j, aov.scaled(1/float64(n)))
+		c.setPixelIDs(c.AOVs, i, j, world)
+	}
+}
 
-	go func() {
-		wg.Wait()
-		close(results)
-	}()
+func (c *Camera) pixelSampler(seed int64, i, j int) sampler.Sampler {
+	return sampler.New(c.Sampler, utils.PixelSeed(seed, i, j), c.SamplesPerPixel)
+}
 
-	pixelColors := make([][]vec3.Vec3, c.ImageHeight)
-	for i := range pixelColors {
-		pixelColors[i] = make([]vec3.Vec3, c.ImageWidth)
+// Sum of samples first to first+n-1 of pixel (i, j), each of which is also
+// splatted into fm. If aov is not nil the samples' AOVs are added to it too.
+func (c *Camera) samplePixel(i, j int, world hittable.Hittable, smp sampler.Sampler, first, n int, aov *aovSample, fm *film) vec3.Vec3 {
+	var pixel_color vec3.Vec3
+	for sample := first; sample < first+n; sample++ {
+		smp.StartSample(sample)
+		r, px, py := c.sampleRay(i, j, smp)
+		sample_color := c.RayColor(&r, c.MaxDepth, world, smp)
+		pixel_color.PlusEqual(sample_color)
+		c.splat(fm, i, j, px, py, sample_color)
+		if aov != nil {
+			aov.add(c.firstHit(&r, world))
+		}
 	}
+	return pixel_color
+}
 
-	for result := range results {
-		pixelColors[result.j][result.i] = result.color
+// Allocate the AOVs and sample counts a render will fill in, if they are
+// wanted, dropping the last render's
+func (c *Camera) resetOutputs() {
+	c.AOVs = nil
+	if c.RecordAOVs {
+		c.AOVs = NewAOVs(c.ImageWidth, c.ImageHeight)
+	}
+	c.SampleCounts = nil
+	if c.adaptive() {
+		c.SampleCounts = make([]int, c.ImageWidth*c.ImageHeight)
 	}
+}
 
-	for j := 0; j < c.ImageHeight; j++ {
-		log.Println("Scanlines remaining:", c.ImageHeight-j)
-		for i := 0; i < c.ImageWidth; i++ {
-			fmt.Println(pixelColors[j][i].String(c.SamplesPerPixel))
-		}
+// Multi-threaded rendering: workers claim tiles of the image one at a time
+// and write their pixels straight into the shared framebuffer.
+//
+// With a NoiseThreshold set, each pixel (here and in RenderSingle) tracks the
+// running mean and variance of its samples' luminance and stops once the
+// standard error of the mean is below NoiseThreshold times the mean, or
+// SamplesPerPixel is reached. SampleCounts records how many each took.
+func (c *Camera) RenderMulti(world hittable.Hittable) (*framebuffer.Framebuffer, error) {
+	return c.RenderMultiContext(context.Background(), world)
+}
+
+// RenderMulti that stops once ctx is done: each worker finishes the pixel it
+// is on and takes no more. The image so far is returned along with ctx.Err(),
+// with the pixels never reached left black.
+func (c *Camera) RenderMultiContext(ctx context.Context, world hittable.Hittable) (*framebuffer.Framebuffer, error) {
+	if err := c.Initalize(); err != nil {
+		return nil, err
 	}
+	c.resetOutputs()
+
+	tiles := c.tiles()
+	log.Println("Number of workers: ", c.numWorkers())
+	log.Println("Number of tiles: ", len(tiles))
+
+	var done atomic.Int64
+	tf := c.newTiledFilm(tiles)
+	c.forEachTile(ctx, tiles, func(k int, t Tile) {
+		fm := tf.claim(t)
+		complete := c.renderTile(ctx, t, world, fm)
+		tf.finish(k, t, fm)
+		if !complete {
+			return
+		}
+		finished := done.Add(1)
+		if finished%progressInterval(len(tiles)) == 0 {
+			log.Println("Tiles remaining:", int64(len(tiles))-finished)
+		}
+	})
 
+	tf.mergeBorders()
+	fb := tf.image.resolve()
+	if done.Load() < int64(len(tiles)) {
+		log.Println("Stopped early:", ctx.Err())
+		return fb, ctx.Err()
+	}
 	log.Println("Done!")
+	return fb, nil
 }
 
 // No Multi-threading
-func (c *Camera) RenderSingle(world hittable.Hittable) {
-	c.Initalize()
-	fmt.Println("P3")
-	fmt.Println(strconv.Itoa(c.ImageWidth) + " " + strconv.Itoa(c.ImageHeight))
-	fmt.Println("255")
+func (c *Camera) RenderSingle(world hittable.Hittable) (*framebuffer.Framebuffer, error) {
+	return c.RenderSingleContext(context.Background(), world)
+}
+
+// RenderSingle that stops once ctx is done, returning the scanlines so far
+// along with ctx.Err() like RenderMultiContext
+func (c *Camera) RenderSingleContext(ctx context.Context, world hittable.Hittable) (*framebuffer.Framebuffer, error) {
+	if err := c.Initalize(); err != nil {
+		return nil, err
+	}
+	c.resetOutputs()
+	fm := c.imageFilm()
 	for j := 0; j < c.ImageHeight; j++ {
 		log.Println("Scanlines remaining: " + strconv.Itoa(c.ImageHeight-j))
-		for i := 0; i < c.ImageWidth; i++ {
-			pixel_color := c.computePixelColor(i, j, &world)
-			fmt.Println(pixel_color.String((*c).SamplesPerPixel))
+		if !c.renderTile(ctx, Tile{X0: 0, Y0: j, X1: c.ImageWidth, Y1: j + 1}, world, fm) {
+			log.Println("Stopped early:", ctx.Err())
+			return fm.resolve(), ctx.Err()
 		}
 	}
 	log.Println("Done!")
+	return fm.resolve(), nil
+}
+
+func (c *Camera) GetRay(i, j int, rnd utils.Random) vec3.Ray {
+	r, _, _ := c.sampleRay(i, j, rnd)
+	return r
 }
 
-func (c *Camera) GetRay(i, j int) vec3.Ray {
+// Ray through a random point of pixel (i, j), and that point's offset from
+// the pixel center in pixels
+func (c *Camera) sampleRay(i, j int, rnd utils.Random) (vec3.Ray, float64, float64) {
 	pixel_center := c.Pixel00_loc.Add(*c.PixelDeltaU.MultiplyFloat(float64(i))).Add(*c.PixelDeltaV.MultiplyFloat(float64(j)))
-	pixel_sample := pixel_center.Add(c.PixelSampleSquare())
+	px, py := pixelOffset(rnd)
+	pixel_sample := pixel_center.Add(c.PixelDeltaU.MultiplyFloat(px).Add(*c.PixelDeltaV.MultiplyFloat(py)))
 
 	ray_origin := vec3.Point3{X: 0, Y: 0, Z: 0}
 	if c.DefocusAngle <= 0 {
 		ray_origin = c.Center
 	} else {
-		ray_origin = c.DefocusDiskSample()
+		ray_origin = c.DefocusDiskSample(rnd)
 	}
 
 	ray_direction := pixel_sample.Subtract(ray_origin)
+	ray_time := c.ShutterOpen + rnd.Float64()*(c.ShutterClose-c.ShutterOpen)
 
-	return vec3.Ray{Origin: ray_origin, Direction: *ray_direction}
+	return vec3.Ray{Origin: ray_origin, Direction: *ray_direction, Time: ray_time}, px, py
 }
 
-func (c *Camera) DefocusDiskSample() vec3.Point3 {
-	p := c.LookAt.RandomInUnitDisk()
+func (c *Camera) DefocusDiskSample(rnd utils.Random) vec3.Point3 {
+	p := vec3.SampleUnitDisk(rnd)
 	return c.Center.Add(*c.DefocusDiskU.MultiplyFloat(p.IndexAt(0))).Add(*c.DefocusDiskV.MultiplyFloat(p.IndexAt(1)))
 }
 
-func (c *Camera) PixelSampleSquare() vec3.Vec3 {
-	px := -0.5 + utils.RandomDouble()
-	py := -0.5 + utils.RandomDouble()
-
+func (c *Camera) PixelSampleSquare(rnd utils.Random) vec3.Vec3 {
+	px, py := pixelOffset(rnd)
 	return c.PixelDeltaU.MultiplyFloat(px).Add(*c.PixelDeltaV.MultiplyFloat(py))
 }
 
-func (c *Camera) Initalize() {
-	(*c).ImageWidth = 400
-	(*c).ImageHeight = int(math.Max(float64((*c).ImageWidth)/(*c).AspectRatio, 1.0))
+// Random point in [-0.5, 0.5)^2, in pixels from a pixel's center
+func pixelOffset(rnd utils.Random) (float64, float64) {
+	px := -0.5 + rnd.Float64()
+	py := -0.5 + rnd.Float64()
+	return px, py
+}
+
+// Derive the viewport from the camera parameters. ImageWidth is required; if
+// ImageHeight is zero it is derived from AspectRatio, otherwise it is used as
+// given and AspectRatio is ignored.
+func (c *Camera) Initalize() error {
+	if c.ImageWidth <= 0 {
+		return fmt.Errorf("camera: image width must be positive, got %d", c.ImageWidth)
+	}
+	if c.ImageHeight < 0 {
+		return fmt.Errorf("camera: image height must not be negative, got %d", c.ImageHeight)
+	}
+	if c.ImageHeight == 0 {
+		if !(c.AspectRatio > 0) {
+			return fmt.Errorf("camera: aspect ratio must be positive, got %v", c.AspectRatio)
+		}
+		(*c).ImageHeight = int(math.Max(float64((*c).ImageWidth)/(*c).AspectRatio, 1.0))
+	}
+	if c.SamplesPerPixel <= 0 {
+		return fmt.Errorf("camera: samples per pixel must be positive, got %d", c.SamplesPerPixel)
+	}
+
+	view_direction := c.LookFrom.Subtract(c.LookAt)
+	if view_direction.NearZero() {
+		return fmt.Errorf("camera: look from and look at are the same point %v", c.LookFrom)
+	}
+	if c.ViewUp.Cross(*view_direction).NearZero() {
+		return fmt.Errorf("camera: view up %v is parallel to the view direction", c.ViewUp)
+	}
 
 	(*c).Center = c.LookFrom
 
@@ -210,4 +337,6 @@ func (c *Camera) Initalize() {
 	defocus_radius := c.FocusDistance * math.Tan(utils.DegreesToRadians(c.DefocusAngle/2))
 	(*c).DefocusDiskU = *c.U.MultiplyFloat(defocus_radius)
 	(*c).DefocusDiskV = *c.V.MultiplyFloat(defocus_radius)
+
+	return nil
 }
@@ -1,8 +1,19 @@
 package camera
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"go-tracer/src/filter"
+	"go-tracer/src/framebuffer"
+	"go-tracer/src/hittable"
+	"go-tracer/src/interval"
+	"go-tracer/src/sampler"
+	"go-tracer/src/texture"
+	"go-tracer/src/utils"
 	"go-tracer/src/vec3"
 	"math"
+	"sync/atomic"
 	"testing"
 )
 
@@ -16,10 +27,40 @@ func almostEqual(t *testing.T, got, want vec3.Vec3, msg string) {
 	}
 }
 
+// Small square camera at the origin looking down -Z with a 90 degree view,
+// for render tests; configure sets the fields a test is about
+func testCamera(configure func(c *Camera)) Camera {
+	cam := Camera{
+		AspectRatio:     1.0,
+		ImageWidth:      16,
+		VFOV:            90.0,
+		LookFrom:        vec3.Point3{X: 0, Y: 0, Z: 0},
+		LookAt:          vec3.Point3{X: 0, Y: 0, Z: -1},
+		ViewUp:          vec3.Vec3{X: 0, Y: 1, Z: 0},
+		FocusDistance:   1.0,
+		SamplesPerPixel: 4,
+		MaxDepth:        5,
+	}
+	if configure != nil {
+		configure(&cam)
+	}
+	return cam
+}
+
+// Mean luminance over the whole image
+func meanLuminance(fb *framebuffer.Framebuffer) float64 {
+	sum := 0.0
+	for _, p := range fb.Pixels {
+		sum += luminance(p)
+	}
+	return sum / float64(len(fb.Pixels))
+}
+
 func TestCameraInitialization(t *testing.T) {
 	// Create a basic camera setup
 	cam := Camera{
 		AspectRatio:     16.0 / 9.0,
+		ImageWidth:      400,
 		VFOV:            90.0,
 		LookFrom:        vec3.Point3{X: 0, Y: 0, Z: 0},
 		LookAt:          vec3.Point3{X: 0, Y: 0, Z: -1},
@@ -30,7 +71,9 @@ func TestCameraInitialization(t *testing.T) {
 		MaxDepth:        50,
 	}
 
-	cam.Initalize()
+	if err := cam.Initalize(); err != nil {
+		t.Fatalf("Initalize() returned error: %v", err)
+	}
 
 	t.Run("Image dimensions", func(t *testing.T) {
 		if cam.ImageWidth != 400 {
@@ -60,6 +103,7 @@ func TestCameraInitialization(t *testing.T) {
 func TestGetRay(t *testing.T) {
 	cam := Camera{
 		AspectRatio:     16.0 / 9.0,
+		ImageWidth:      400,
 		VFOV:            90.0,
 		LookFrom:        vec3.Point3{X: 0, Y: 0, Z: 0},
 		LookAt:          vec3.Point3{X: 0, Y: 0, Z: -1},
@@ -70,13 +114,15 @@ func TestGetRay(t *testing.T) {
 		MaxDepth:        50,
 	}
 
-	cam.Initalize()
+	if err := cam.Initalize(); err != nil {
+		t.Fatalf("Initalize() returned error: %v", err)
+	}
 
 	t.Run("Center ray bounds", func(t *testing.T) {
 		// Get ray from center of image
 		centerI := cam.ImageWidth / 2
 		centerJ := cam.ImageHeight / 2
-		ray := cam.GetRay(centerI, centerJ)
+		ray := cam.GetRay(centerI, centerJ, utils.GlobalRandom)
 
 		// The ray should be roughly pointing forward (-Z direction)
 		// but will have some variation due to pixel sampling
@@ -102,6 +148,7 @@ func TestGetRay(t *testing.T) {
 func TestDefocusDiskSample(t *testing.T) {
 	cam := Camera{
 		AspectRatio:     16.0 / 9.0,
+		ImageWidth:      400,
 		VFOV:            90.0,
 		LookFrom:        vec3.Point3{X: 0, Y: 0, Z: 0},
 		LookAt:          vec3.Point3{X: 0, Y: 0, Z: -1},
@@ -112,12 +159,14 @@ func TestDefocusDiskSample(t *testing.T) {
 		MaxDepth:        50,
 	}
 
-	cam.Initalize()
+	if err := cam.Initalize(); err != nil {
+		t.Fatalf("Initalize() returned error: %v", err)
+	}
 
 	t.Run("Defocus disk bounds", func(t *testing.T) {
 		// Sample multiple points and ensure they're within expected bounds
 		for i := 0; i < 100; i++ {
-			sample := cam.DefocusDiskSample()
+			sample := cam.DefocusDiskSample(utils.GlobalRandom)
 			distanceFromCenter := sample.Subtract(cam.Center).Length()
 
 			// The sample should be within the defocus disk radius
@@ -133,6 +182,7 @@ func TestDefocusDiskSample(t *testing.T) {
 func TestPixelSampleSquare(t *testing.T) {
 	cam := Camera{
 		AspectRatio:     16.0 / 9.0,
+		ImageWidth:      400,
 		VFOV:            90.0,
 		LookFrom:        vec3.Point3{X: 0, Y: 0, Z: 0},
 		LookAt:          vec3.Point3{X: 0, Y: 0, Z: -1},
@@ -143,12 +193,14 @@ func TestPixelSampleSquare(t *testing.T) {
 		MaxDepth:        50,
 	}
 
-	cam.Initalize()
+	if err := cam.Initalize(); err != nil {
+		t.Fatalf("Initalize() returned error: %v", err)
+	}
 
 	t.Run("Sample bounds", func(t *testing.T) {
 		// Test multiple samples to ensure they're within pixel bounds
 		for i := 0; i < 100; i++ {
-			sample := cam.PixelSampleSquare()
+			sample := cam.PixelSampleSquare(utils.GlobalRandom)
 
 			// Sample should be within one pixel delta in any direction
 			if math.Abs(sample.X) > cam.PixelDeltaU.Length() ||
@@ -158,3 +210,798 @@ func TestPixelSampleSquare(t *testing.T) {
 		}
 	})
 }
+
+func TestCameraExplicitHeight(t *testing.T) {
+	cam := Camera{
+		AspectRatio:     16.0 / 9.0,
+		ImageWidth:      1200,
+		ImageHeight:     300,
+		VFOV:            90.0,
+		LookFrom:        vec3.Point3{X: 0, Y: 0, Z: 0},
+		LookAt:          vec3.Point3{X: 0, Y: 0, Z: -1},
+		ViewUp:          vec3.Vec3{X: 0, Y: 1, Z: 0},
+		FocusDistance:   1.0,
+		SamplesPerPixel: 1,
+		MaxDepth:        50,
+	}
+
+	if err := cam.Initalize(); err != nil {
+		t.Fatalf("Initalize() returned error: %v", err)
+	}
+	if cam.ImageWidth != 1200 || cam.ImageHeight != 300 {
+		t.Errorf("Image size = %vx%v, want 1200x300", cam.ImageWidth, cam.ImageHeight)
+	}
+	// Pixels stay square, so the viewport follows the explicit size
+	if math.Abs(cam.PixelDeltaU.Length()-cam.PixelDeltaV.Length()) > EPSILON {
+		t.Errorf("Non-square pixels: du = %v, dv = %v", cam.PixelDeltaU.Length(), cam.PixelDeltaV.Length())
+	}
+}
+
+func TestCameraInitalizeErrors(t *testing.T) {
+	valid := Camera{
+		AspectRatio:     16.0 / 9.0,
+		ImageWidth:      400,
+		VFOV:            90.0,
+		LookFrom:        vec3.Point3{X: 0, Y: 0, Z: 0},
+		LookAt:          vec3.Point3{X: 0, Y: 0, Z: -1},
+		ViewUp:          vec3.Vec3{X: 0, Y: 1, Z: 0},
+		FocusDistance:   1.0,
+		SamplesPerPixel: 1,
+		MaxDepth:        50,
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *Camera)
+	}{
+		{"Zero width", func(c *Camera) { c.ImageWidth = 0 }},
+		{"Negative height", func(c *Camera) { c.ImageHeight = -1 }},
+		{"Zero aspect ratio", func(c *Camera) { c.AspectRatio = 0 }},
+		{"Negative aspect ratio", func(c *Camera) { c.AspectRatio = -1.5 }},
+		{"No samples", func(c *Camera) { c.SamplesPerPixel = 0 }},
+		{"LookFrom equals LookAt", func(c *Camera) { c.LookAt = c.LookFrom }},
+		{"ViewUp parallel to view direction", func(c *Camera) { c.ViewUp = vec3.Vec3{X: 0, Y: 0, Z: 2} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cam := valid
+			tt.modify(&cam)
+			if err := cam.Initalize(); err == nil {
+				t.Errorf("Expected Initalize() to return an error")
+			}
+		})
+	}
+}
+
+func TestTilesCoverImage(t *testing.T) {
+	cam := Camera{ImageWidth: 100, ImageHeight: 45, TileSize: 16}
+	covered := make([]int, cam.ImageWidth*cam.ImageHeight)
+
+	for _, tile := range cam.tiles() {
+		if tile.X1-tile.X0 > 16 || tile.Y1-tile.Y0 > 16 {
+			t.Errorf("Tile larger than TileSize: %+v", tile)
+		}
+		for j := tile.Y0; j < tile.Y1; j++ {
+			for i := tile.X0; i < tile.X1; i++ {
+				covered[j*cam.ImageWidth+i]++
+			}
+		}
+	}
+
+	for idx, count := range covered {
+		if count != 1 {
+			t.Fatalf("Pixel (%d, %d) covered %d times, want 1", idx%cam.ImageWidth, idx/cam.ImageWidth, count)
+		}
+	}
+}
+
+func TestRenderMultiWorkers(t *testing.T) {
+	var world hittable.HittableList
+	world.Append(hittable.Sphere{Center: vec3.Point3{X: 0, Y: 0, Z: -1}, Radius: 0.5, Mat: hittable.Lambertian{Albedo: vec3.Vec3{X: 0.5, Y: 0.5, Z: 0.5}}})
+
+	for _, workers := range []int{1, 3} {
+		cam := testCamera(func(c *Camera) {
+			c.AspectRatio = 2.0
+			c.ImageWidth = 40
+			c.SamplesPerPixel = 2
+			c.Workers = workers
+			c.TileSize = 7
+		})
+
+		fb, err := cam.RenderMulti(&world)
+		if err != nil {
+			t.Fatalf("RenderMulti() returned error: %v", err)
+		}
+		if fb.Width != 40 || fb.Height != 20 {
+			t.Fatalf("Framebuffer is %dx%d, want 40x20", fb.Width, fb.Height)
+		}
+		for idx, pixel := range fb.Pixels {
+			if pixel.LengthSquared() == 0 {
+				t.Fatalf("Workers = %d: pixel %d was never written", workers, idx)
+			}
+		}
+	}
+}
+
+func TestSeededRenderIsReproducible(t *testing.T) {
+	var world hittable.HittableList
+	world.Append(hittable.Sphere{Center: vec3.Point3{X: 0, Y: 0, Z: -1}, Radius: 0.5, Mat: hittable.Dielectric{Ir: 1.5}})
+	world.Append(hittable.Sphere{Center: vec3.Point3{X: 0, Y: -100.5, Z: -1}, Radius: 100, Mat: hittable.Lambertian{Albedo: vec3.Vec3{X: 0.5, Y: 0.5, Z: 0.5}}})
+
+	render := func(workers int, seed int64) []vec3.Vec3 {
+		cam := testCamera(func(c *Camera) {
+			c.AspectRatio = 2.0
+			c.ImageWidth = 32
+			c.DefocusAngle = 2.0
+			c.MaxDepth = 10
+			c.Workers = workers
+			c.TileSize = 5
+			c.Seed = seed
+		})
+		fb, err := cam.RenderMulti(&world)
+		if err != nil {
+			t.Fatalf("RenderMulti() returned error: %v", err)
+		}
+		return fb.Pixels
+	}
+
+	single := render(1, 7)
+	multi := render(4, 7)
+	for idx := range single {
+		if single[idx] != multi[idx] {
+			t.Fatalf("Pixel %d differs between 1 and 4 workers: %v vs %v", idx, single[idx], multi[idx])
+		}
+	}
+
+	other := render(4, 8)
+	same := true
+	for idx := range single {
+		if single[idx] != other[idx] {
+			same = false
+			break
+		}
+	}
+	if same {
+		t.Errorf("Expected a different seed to give a different image")
+	}
+}
+
+func TestRayColorBackgroundAndLights(t *testing.T) {
+	var world hittable.HittableList
+	light := hittable.DiffuseLight{Emit: vec3.Vec3{X: 2, Y: 3, Z: 4}}
+	world.Append(hittable.Quad{Q: vec3.Point3{X: -1, Y: -1, Z: -2}, U: vec3.Vec3{X: 2, Y: 0, Z: 0}, V: vec3.Vec3{X: 0, Y: 2, Z: 0}, Mat: light})
+
+	toLight := vec3.Ray{Origin: vec3.Point3{}, Direction: vec3.Vec3{X: 0, Y: 0, Z: -1}}
+	away := vec3.Ray{Origin: vec3.Point3{}, Direction: vec3.Vec3{X: 0, Y: 1, Z: 0}}
+
+	cam := Camera{Background: SolidBackground{}}
+	if got := cam.RayColor(&toLight, 10, &world, utils.GlobalRandom); got != light.Emit {
+		t.Errorf("Ray into the light = %v, want %v", got, light.Emit)
+	}
+	if got := cam.RayColor(&away, 10, &world, utils.GlobalRandom); got != (vec3.Vec3{}) {
+		t.Errorf("Escaping ray with no background = %v, want black", got)
+	}
+
+	cam.Background = GradientBackground{Bottom: vec3.Vec3{X: 1, Y: 0, Z: 0}, Top: vec3.Vec3{X: 0, Y: 0, Z: 1}}
+	almostEqual(t, cam.RayColor(&away, 10, &world, utils.GlobalRandom), vec3.Vec3{X: 0, Y: 0, Z: 1}, "Escaping ray straight up")
+
+	// Without a background the sky gradient is used, as before
+	cam.Background = nil
+	almostEqual(t, cam.RayColor(&away, 10, &world, utils.GlobalRandom), vec3.Vec3{X: 0.5, Y: 0.7, Z: 1.0}, "Default sky straight up")
+}
+
+func TestRenderProgressive(t *testing.T) {
+	var world hittable.HittableList
+	world.Append(hittable.Sphere{Center: vec3.Point3{X: 0, Y: 0, Z: -1}, Radius: 0.5, Mat: hittable.Lambertian{Albedo: vec3.Vec3{X: 0.5, Y: 0.5, Z: 0.5}}})
+
+	cam := testCamera(func(c *Camera) {
+		c.AspectRatio = 2.0
+		c.ImageWidth = 20
+		c.SamplesPerPixel = 10
+		c.SamplesPerPass = 4
+	})
+
+	var passes []int
+	fb, err := cam.RenderProgressive(&world, func(fb *framebuffer.Framebuffer, samples int) bool {
+		passes = append(passes, samples)
+		return true
+	})
+	if err != nil {
+		t.Fatalf("RenderProgressive() returned error: %v", err)
+	}
+	if len(passes) != 3 || passes[0] != 4 || passes[1] != 8 || passes[2] != 10 {
+		t.Errorf("Sample counts after each pass = %v, want [4 8 10]", passes)
+	}
+	// The sky pixels are averaged, not summed, so stay within the sky's range
+	if sky := fb.At(0, 0); sky.X <= 0 || sky.Z > 1.0+EPSILON {
+		t.Errorf("Corner pixel %v is not an averaged sky color", sky)
+	}
+
+	passes = nil
+	_, err = cam.RenderProgressive(&world, func(fb *framebuffer.Framebuffer, samples int) bool {
+		passes = append(passes, samples)
+		return false
+	})
+	if err != nil {
+		t.Fatalf("RenderProgressive() returned error: %v", err)
+	}
+	if len(passes) != 1 {
+		t.Errorf("Expected the render to stop after the first pass, got %d passes", len(passes))
+	}
+}
+
+func TestLightSamplingReducesNoise(t *testing.T) {
+	var world, lights hittable.HittableList
+	floor := hittable.Quad{Q: vec3.Point3{X: -5, Y: 0, Z: 5}, U: vec3.Vec3{X: 10, Y: 0, Z: 0}, V: vec3.Vec3{X: 0, Y: 0, Z: -10}, Mat: hittable.Lambertian{Albedo: vec3.Vec3{X: 0.7, Y: 0.7, Z: 0.7}}}
+	light := hittable.Quad{Q: vec3.Point3{X: -0.25, Y: 2, Z: -0.25}, U: vec3.Vec3{X: 0.5, Y: 0, Z: 0}, V: vec3.Vec3{X: 0, Y: 0, Z: 0.5}, Mat: hittable.DiffuseLight{Emit: vec3.Vec3{X: 20, Y: 20, Z: 20}}}
+	world.Append(floor)
+	world.Append(light)
+	lights.Append(light)
+
+	// Mean brightness of the image and the mean squared difference between pixels,
+	// which for a nearly flat floor is dominated by noise
+	measure := func(withLights bool) (float64, float64) {
+		cam := testCamera(func(c *Camera) {
+			c.VFOV = 20.0
+			c.LookFrom = vec3.Point3{X: 0, Y: 1, Z: 0.01}
+			c.LookAt = vec3.Point3{X: 0, Y: 0, Z: 0}
+			c.SamplesPerPixel = 64
+			c.Background = SolidBackground{}
+			c.Seed = 11
+			if withLights {
+				c.Lights = &lights
+			}
+		})
+		fb, err := cam.RenderMulti(&world)
+		if err != nil {
+			t.Fatalf("RenderMulti() returned error: %v", err)
+		}
+
+		mean := meanLuminance(fb)
+		variance := 0.0
+		for _, pixel := range fb.Pixels {
+			variance += (pixel.X - mean) * (pixel.X - mean)
+		}
+		return mean, variance / float64(len(fb.Pixels))
+	}
+
+	meanScatter, varianceScatter := measure(false)
+	meanLights, varianceLights := measure(true)
+
+	if math.Abs(meanScatter-meanLights) > 0.15*meanLights {
+		t.Errorf("Light sampling changed the image brightness: %v without, %v with", meanScatter, meanLights)
+	}
+	if varianceLights*4 > varianceScatter {
+		t.Errorf("Expected light sampling to cut noise substantially: variance %v without, %v with", varianceScatter, varianceLights)
+	}
+}
+
+func TestGetRayShutterTime(t *testing.T) {
+	cam := testCamera(func(c *Camera) {
+		c.ImageWidth = 10
+		c.SamplesPerPixel = 1
+		c.ShutterOpen = 2.0
+		c.ShutterClose = 3.0
+	})
+	if err := cam.Initalize(); err != nil {
+		t.Fatalf("Initalize() returned error: %v", err)
+	}
+
+	rnd := utils.NewRNG(1)
+	for i := 0; i < 100; i++ {
+		r := cam.GetRay(5, 5, rnd)
+		if r.Time < 2.0 || r.Time > 3.0 {
+			t.Fatalf("Ray time %v outside the shutter interval [2, 3]", r.Time)
+		}
+	}
+}
+
+func TestEnvironmentMap(t *testing.T) {
+	// Dim grey everywhere except one bright pixel, a "sun" just above the horizon
+	img := &texture.Image{Width: 16, Height: 8, Pixels: make([]vec3.Vec3, 16*8)}
+	for i := range img.Pixels {
+		img.Pixels[i] = vec3.Vec3{X: 0.1, Y: 0.1, Z: 0.1}
+	}
+	sun := 3*16 + 5
+	img.Pixels[sun] = vec3.Vec3{X: 500, Y: 400, Z: 300}
+	env := NewEnvironmentMap(img, 2, 30)
+
+	up := vec3.Ray{Direction: vec3.Vec3{X: 0, Y: 1, Z: 0}}
+	almostEqual(t, env.Value(&up), vec3.Vec3{X: 0.2, Y: 0.2, Z: 0.2}, "Intensity scales the map")
+
+	// Sampled directions round-trip to the pixel they were drawn from
+	rng := utils.NewRNG(3)
+	sunHits := 0
+	const n = 20000
+	for k := 0; k < n; k++ {
+		direction := env.Random(vec3.Point3{}, rng)
+		u, v := env.uv(direction)
+		if i, j := env.pixel(u, v); j*16+i == sun {
+			sunHits++
+		}
+	}
+	if sunHits < n*9/10 {
+		t.Errorf("Only %d of %d samples went towards the sun", sunHits, n)
+	}
+
+	// The density integrates to one over the sphere, and estimating the total
+	// light by importance sampling agrees with uniform sampling
+	integral, uniform, importance := 0.0, 0.0, 0.0
+	for k := 0; k < 400000; k++ {
+		direction := vec3.Vec3{}.RandomUnitVector(rng)
+		r := vec3.Ray{Direction: *direction}
+		integral += env.PDFValue(vec3.Point3{}, *direction) * 4 * math.Pi
+		uniform += env.Value(&r).X * 4 * math.Pi
+
+		sampled := vec3.Ray{Direction: env.Random(vec3.Point3{}, rng)}
+		importance += env.Value(&sampled).X / env.PDFValue(vec3.Point3{}, sampled.Direction)
+	}
+	if got := integral / 400000; math.Abs(got-1) > 0.02 {
+		t.Errorf("PDF integrates to %v, want 1", got)
+	}
+	if u, i := uniform/400000, importance/400000; math.Abs(u-i)/i > 0.05 {
+		t.Errorf("Uniform estimate %v disagrees with importance sampled %v", u, i)
+	}
+}
+
+func TestEnvironmentMapRotation(t *testing.T) {
+	img := &texture.Image{Width: 4, Height: 2, Pixels: make([]vec3.Vec3, 8)}
+	for i := 0; i < 4; i++ {
+		img.Pixels[i] = vec3.Vec3{X: float64(i), Y: 0, Z: 0}
+		img.Pixels[4+i] = vec3.Vec3{X: float64(i), Y: 0, Z: 0}
+	}
+	plain := NewEnvironmentMap(img, 1, 0)
+	turned := NewEnvironmentMap(img, 1, 90)
+
+	// Turning the map by 90 degrees shows each column a quarter turn further round
+	for _, d := range []vec3.Vec3{{X: 1, Y: 0.1, Z: 0.3}, {X: -0.2, Y: -0.5, Z: 1}} {
+		r := vec3.Ray{Direction: d}
+		rotated := vec3.Ray{Direction: vec3.Rotation(vec3.Vec3{X: 0, Y: 1, Z: 0}, 90).TransformVector(d)}
+		almostEqual(t, turned.Value(&rotated), plain.Value(&r), "Rotated lookup")
+	}
+
+	for _, uv := range [][2]float64{{0.1, 0.3}, {0.8, 0.9}} {
+		u, v := turned.uv(turned.direction(uv[0], uv[1]))
+		if math.Abs(u-uv[0]) > 1e-9 || math.Abs(v-uv[1]) > 1e-9 {
+			t.Errorf("direction(%v) maps back to (%v, %v)", uv, u, v)
+		}
+	}
+}
+
+func TestRecordAOVs(t *testing.T) {
+	albedo := vec3.Vec3{X: 0.2, Y: 0.4, Z: 0.6}
+	var world hittable.HittableList
+	world.Append(hittable.Sphere{Center: vec3.Point3{X: 0, Y: 0, Z: -1}, Radius: 0.5, Mat: hittable.TaggedMaterial{Material: hittable.Lambertian{Albedo: albedo}, ID: 7}})
+
+	newCam := func() Camera {
+		return testCamera(func(c *Camera) {
+			c.ImageWidth = 21
+			c.SamplesPerPass = 3
+			c.Background = SolidBackground{Color: vec3.Vec3{X: 2, Y: 0.5, Z: 0}}
+			c.Seed = 3
+		})
+	}
+	tagged := hittable.TagObjects(world)
+
+	plain := newCam()
+	want, err := plain.RenderMulti(&world)
+	if err != nil {
+		t.Fatalf("RenderMulti() returned error: %v", err)
+	}
+	if plain.AOVs != nil {
+		t.Errorf("AOVs were recorded without RecordAOVs")
+	}
+
+	check := func(name string, cam Camera, fb *framebuffer.Framebuffer) {
+		if cam.AOVs == nil {
+			t.Fatalf("%s: no AOVs recorded", name)
+		}
+		almostEqual(t, cam.AOVs.Albedo.At(10, 10), albedo, name+": albedo at the center")
+		if n := cam.AOVs.Normal.At(10, 10); n.Z < 0.99 {
+			t.Errorf("%s: normal at the center = %v, want about (0, 0, 1)", name, n)
+		}
+		almostEqual(t, cam.AOVs.Albedo.At(0, 0), vec3.Vec3{X: 1, Y: 0.5, Z: 0}, name+": albedo of the clamped background")
+		almostEqual(t, cam.AOVs.Normal.At(0, 0), vec3.Vec3{}, name+": normal of the background")
+		if d := cam.AOVs.Depth.At(10, 10).X; math.Abs(d-0.5) > 1e-3 {
+			t.Errorf("%s: depth at the center = %v, want about 0.5", name, d)
+		}
+		if p := cam.AOVs.Position.At(10, 10); math.Abs(p.Z+0.5) > 1e-3 {
+			t.Errorf("%s: position at the center = %v, want about (0, 0, -0.5)", name, p)
+		}
+		almostEqual(t, cam.AOVs.MaterialID.At(10, 10), vec3.Vec3{X: 7, Y: 7, Z: 7}, name+": material ID at the center")
+		almostEqual(t, cam.AOVs.ObjectID.At(10, 10), vec3.Vec3{X: 1, Y: 1, Z: 1}, name+": object ID at the center")
+		almostEqual(t, cam.AOVs.ObjectID.At(0, 0), vec3.Vec3{}, name+": object ID of the background")
+		for idx := range want.Pixels {
+			if fb.Pixels[idx] != want.Pixels[idx] {
+				t.Fatalf("%s: recording AOVs changed pixel %d: %v vs %v", name, idx, fb.Pixels[idx], want.Pixels[idx])
+			}
+		}
+	}
+
+	multi := newCam()
+	multi.RecordAOVs = true
+	fb, err := multi.RenderMulti(&tagged)
+	if err != nil {
+		t.Fatalf("RenderMulti() returned error: %v", err)
+	}
+	check("RenderMulti", multi, fb)
+
+	single := newCam()
+	single.RecordAOVs = true
+	if fb, err = single.RenderSingle(&tagged); err != nil {
+		t.Fatalf("RenderSingle() returned error: %v", err)
+	}
+	check("RenderSingle", single, fb)
+
+	progressive := newCam()
+	progressive.RecordAOVs = true
+	if _, err = progressive.RenderProgressive(&tagged, nil); err != nil {
+		t.Fatalf("RenderProgressive() returned error: %v", err)
+	}
+	almostEqual(t, progressive.AOVs.Albedo.At(10, 10), albedo, "RenderProgressive: albedo at the center")
+	almostEqual(t, progressive.AOVs.ObjectID.At(10, 10), vec3.Vec3{X: 1, Y: 1, Z: 1}, "RenderProgressive: object ID at the center")
+
+	t.Run("Display", func(t *testing.T) {
+		layers := map[string]*framebuffer.Framebuffer{}
+		for _, layer := range multi.AOVs.Layers() {
+			layers[layer.Name] = layer.Display()
+		}
+		almostEqual(t, layers["normal"].At(0, 0), vec3.Vec3{X: 0.5, Y: 0.5, Z: 0.5}, "Zero normal")
+		if d := layers["depth"].At(10, 10).X; d <= 0 || d > 1 {
+			t.Errorf("Displayed depth %v is outside (0, 1]", d)
+		}
+		almostEqual(t, layers["object_id"].At(0, 0), vec3.Vec3{}, "Background object ID")
+		if layers["object_id"].At(10, 10) == (vec3.Vec3{}) {
+			t.Errorf("Object ID 1 is displayed black")
+		}
+	})
+}
+
+func TestRunningStats(t *testing.T) {
+	values := []float64{2, 4, 4, 4, 5, 5, 7, 9}
+	var s runningStats
+	for _, v := range values {
+		s.add(v)
+	}
+	if math.Abs(s.mean-5) > EPSILON {
+		t.Errorf("mean = %v, want 5", s.mean)
+	}
+	// Sample variance: sum of squared deviations 32 over n-1 = 7
+	if math.Abs(s.variance()-32.0/7) > EPSILON {
+		t.Errorf("variance = %v, want %v", s.variance(), 32.0/7)
+	}
+}
+
+func TestAdaptiveSampling(t *testing.T) {
+	grey := hittable.Lambertian{Albedo: vec3.Vec3{X: 0.5, Y: 0.5, Z: 0.5}}
+	var world hittable.HittableList
+	world.Append(hittable.Sphere{Center: vec3.Point3{X: 0, Y: 0, Z: -1}, Radius: 0.5, Mat: grey})
+	world.Append(hittable.Sphere{Center: vec3.Point3{X: 0, Y: -100.5, Z: -1}, Radius: 100, Mat: grey})
+
+	newCam := func() Camera {
+		return testCamera(func(c *Camera) {
+			c.ImageWidth = 9
+			c.SamplesPerPixel = 64
+			c.SamplesPerPass = 8
+			c.Background = SolidBackground{Color: vec3.Vec3{X: 0.5, Y: 0.7, Z: 1}}
+			c.NoiseThreshold = 1e-4
+			c.MinSamples = 8
+		})
+	}
+
+	// The flat background converges as soon as it may; the diffuse sphere
+	// never gets quiet enough and runs to the cap
+	check := func(name string, cam Camera, fb *framebuffer.Framebuffer) {
+		if len(cam.SampleCounts) != 81 {
+			t.Fatalf("%s: %d sample counts, want 81", name, len(cam.SampleCounts))
+		}
+		if got := cam.SampleCounts[0]; got != 8 {
+			t.Errorf("%s: corner pixel took %d samples, want 8", name, got)
+		}
+		if got := cam.SampleCounts[4*9+4]; got != 64 {
+			t.Errorf("%s: center pixel took %d samples, want 64", name, got)
+		}
+		almostEqual(t, fb.At(0, 0), vec3.Vec3{X: 0.5, Y: 0.7, Z: 1}, name+": background pixel")
+		heatmap := cam.SampleHeatmap()
+		almostEqual(t, heatmap.At(4, 4), vec3.Vec3{X: 1, Y: 0, Z: 0}, name+": heatmap at the cap")
+		almostEqual(t, heatmap.At(0, 0), vec3.Vec3{X: 0, Y: 0.25, Z: 0.75}, name+": heatmap at 8/64")
+	}
+
+	multi := newCam()
+	fb, err := multi.RenderMulti(&world)
+	if err != nil {
+		t.Fatalf("RenderMulti() returned error: %v", err)
+	}
+	check("RenderMulti", multi, fb)
+
+	progressive := newCam()
+	if fb, err = progressive.RenderProgressive(&world, nil); err != nil {
+		t.Fatalf("RenderProgressive() returned error: %v", err)
+	}
+	check("RenderProgressive", progressive, fb)
+
+	plain := newCam()
+	plain.NoiseThreshold = 0
+	if _, err = plain.RenderMulti(&world); err != nil {
+		t.Fatalf("RenderMulti() returned error: %v", err)
+	}
+	if plain.SampleCounts != nil || plain.SampleHeatmap() != nil {
+		t.Errorf("Expected no sample counts without a noise threshold")
+	}
+
+	// With nothing but background every pixel is done after the first pass
+	var empty hittable.HittableList
+	passes := 0
+	sky := newCam()
+	if _, err = sky.RenderProgressive(&empty, func(fb *framebuffer.Framebuffer, samples int) bool {
+		passes++
+		return true
+	}); err != nil {
+		t.Fatalf("RenderProgressive() returned error: %v", err)
+	}
+	if passes != 1 {
+		t.Errorf("Converged render took %d passes, want 1", passes)
+	}
+}
+
+func TestSamplersAgree(t *testing.T) {
+	var world hittable.HittableList
+	world.Append(hittable.Sphere{Center: vec3.Point3{X: 0, Y: 0, Z: -1}, Radius: 0.5, Mat: hittable.Lambertian{Albedo: vec3.Vec3{X: 0.5, Y: 0.5, Z: 0.5}}})
+	world.Append(hittable.Sphere{Center: vec3.Point3{X: 0, Y: -100.5, Z: -1}, Radius: 100, Mat: hittable.Lambertian{Albedo: vec3.Vec3{X: 0.5, Y: 0.5, Z: 0.5}}})
+
+	render := func(kind sampler.Kind, progressive bool) *framebuffer.Framebuffer {
+		cam := testCamera(func(c *Camera) {
+			c.DefocusAngle = 2.0
+			c.SamplesPerPixel = 32
+			c.SamplesPerPass = 8
+			c.MaxDepth = 10
+			c.Sampler = kind
+		})
+		var fb *framebuffer.Framebuffer
+		var err error
+		if progressive {
+			fb, err = cam.RenderProgressive(&world, nil)
+		} else {
+			fb, err = cam.RenderMulti(&world)
+		}
+		if err != nil {
+			t.Fatalf("Render returned error: %v", err)
+		}
+		return fb
+	}
+	want := meanLuminance(render(sampler.Independent, false))
+	for _, kind := range []sampler.Kind{sampler.Stratified, sampler.Halton, sampler.Sobol} {
+		fb := render(kind, false)
+		if got := meanLuminance(fb); math.Abs(got-want) > 0.02*want {
+			t.Errorf("%v: mean brightness %v, want about %v", kind, got, want)
+		}
+		// The pattern of each pixel carries on across passes, so splitting
+		// the render up doesn't change it
+		progressive := render(kind, true)
+		for idx := range fb.Pixels {
+			if d := fb.Pixels[idx].Subtract(progressive.Pixels[idx]).Length(); d > 1e-9 {
+				t.Fatalf("%v: pixel %d differs between RenderMulti and RenderProgressive: %v vs %v", kind, idx, fb.Pixels[idx], progressive.Pixels[idx])
+			}
+		}
+	}
+}
+
+func TestFilmSplat(t *testing.T) {
+	cam := Camera{ImageWidth: 4, ImageHeight: 3, Filter: filter.Filter{Kind: filter.Tent}}
+	fm := cam.imageFilm()
+	white := vec3.Vec3{X: 1, Y: 1, Z: 1}
+
+	// A sample at the center of (1, 1) only reaches that pixel; one halfway
+	// to (2, 1) is shared evenly between the two
+	cam.splat(fm, 1, 1, 0, 0, white)
+	cam.splat(fm, 2, 1, -0.5, 0, *white.MultiplyFloat(3))
+	weights := []struct {
+		i, j int
+		want float64
+	}{
+		{1, 1, 1.5}, {2, 1, 0.5}, {0, 1, 0}, {3, 1, 0}, {1, 0, 0}, {2, 2, 0},
+	}
+	for _, w := range weights {
+		if got := fm.weight[fm.index(w.i, w.j)]; math.Abs(got-w.want) > EPSILON {
+			t.Errorf("Weight of (%d, %d) = %v, want %v", w.i, w.j, got, w.want)
+		}
+	}
+
+	fb := fm.resolve()
+	almostEqual(t, fb.At(1, 1), vec3.Vec3{X: 5.0 / 3, Y: 5.0 / 3, Z: 5.0 / 3}, "Pixel with both samples")
+	almostEqual(t, fb.At(2, 1), *white.MultiplyFloat(3), "Pixel with the second sample")
+	almostEqual(t, fb.At(0, 0), vec3.Vec3{}, "Pixel with no samples")
+
+	// Tile films cover their neighbors' edge pixels and add up to the same
+	// sums as splatting straight into the image, pass after pass
+	cam.TileSize = 2
+	tiles := cam.tiles()
+	tf := cam.newTiledFilm(tiles)
+	want := cam.imageFilm()
+	for pass := 1; pass <= 2; pass++ {
+		for k, tile := range tiles {
+			fm := tf.claim(tile)
+			for j := tile.Y0; j < tile.Y1; j++ {
+				for i := tile.X0; i < tile.X1; i++ {
+					cam.splat(fm, i, j, 0.25, -0.25, white)
+					cam.splat(want, i, j, 0.25, -0.25, white)
+				}
+			}
+			tf.finish(k, tile, fm)
+		}
+		tf.mergeBorders()
+		for idx := range want.weight {
+			if math.Abs(tf.image.weight[idx]-want.weight[idx]) > EPSILON {
+				t.Fatalf("Pass %d: tiled weight of pixel %d = %v, want %v", pass, idx, tf.image.weight[idx], want.weight[idx])
+			}
+		}
+	}
+	for idx, p := range tf.image.resolve().Pixels {
+		almostEqual(t, p, white, fmt.Sprintf("Merged pixel %d", idx))
+	}
+}
+
+func TestReconstructionFilters(t *testing.T) {
+	var world hittable.HittableList
+	world.Append(hittable.Sphere{Center: vec3.Point3{X: 0, Y: 0, Z: -1}, Radius: 0.5, Mat: hittable.Lambertian{Albedo: vec3.Vec3{X: 0.5, Y: 0.5, Z: 0.5}}})
+
+	newCam := func(f filter.Filter) Camera {
+		return testCamera(func(c *Camera) {
+			c.ImageWidth = 12
+			c.SamplesPerPixel = 8
+			c.SamplesPerPass = 3
+			c.TileSize = 5
+			c.Background = SolidBackground{Color: vec3.Vec3{X: 0.5, Y: 0.7, Z: 1}}
+			c.Filter = f
+		})
+	}
+
+	for _, kind := range []filter.Kind{filter.Box, filter.Tent, filter.Gaussian, filter.Mitchell, filter.Lanczos} {
+		for _, radius := range []float64{0, 2.5} {
+			f := filter.Filter{Kind: kind, Radius: radius}
+			name := fmt.Sprintf("%v radius %v", kind, f.Extent())
+
+			single := newCam(f)
+			want, err := single.RenderSingle(&world)
+			if err != nil {
+				t.Fatalf("%s: RenderSingle() returned error: %v", name, err)
+			}
+			// The weights are normalized, so flat background stays flat
+			almostEqual(t, want.At(0, 0), vec3.Vec3{X: 0.5, Y: 0.7, Z: 1}, name+": background corner")
+
+			multi := newCam(f)
+			multi.Workers = 3
+			got, err := multi.RenderMulti(&world)
+			if err != nil {
+				t.Fatalf("%s: RenderMulti() returned error: %v", name, err)
+			}
+			// Margins are merged in tile order, so the worker count doesn't
+			// change a single bit
+			serial := newCam(f)
+			serial.Workers = 1
+			again, err := serial.RenderMulti(&world)
+			if err != nil {
+				t.Fatalf("%s: RenderMulti() returned error: %v", name, err)
+			}
+			for idx := range got.Pixels {
+				if got.Pixels[idx] != again.Pixels[idx] {
+					t.Fatalf("%s: pixel %d differs between 3 workers and 1: %v vs %v", name, idx, got.Pixels[idx], again.Pixels[idx])
+				}
+			}
+			progressive := newCam(f)
+			passes, err := progressive.RenderProgressive(&world, nil)
+			if err != nil {
+				t.Fatalf("%s: RenderProgressive() returned error: %v", name, err)
+			}
+			for idx := range want.Pixels {
+				if d := want.Pixels[idx].Subtract(got.Pixels[idx]).Length(); d > 1e-9 {
+					t.Fatalf("%s: pixel %d differs between RenderSingle and RenderMulti: %v vs %v", name, idx, want.Pixels[idx], got.Pixels[idx])
+				}
+			}
+			// Progressive passes reseed independent samples, so only the
+			// overall brightness should match
+			if a, b := meanLuminance(want), meanLuminance(passes); math.Abs(a-b) > 0.05*a {
+				t.Errorf("%s: RenderProgressive mean brightness %v, RenderMulti %v", name, b, a)
+			}
+		}
+	}
+}
+
+// Scene that cancels a context once it has been hit-tested a number of times
+type cancelAfter struct {
+	hittable.Hittable
+	hits   atomic.Int64
+	limit  int64
+	cancel context.CancelFunc
+}
+
+func (c *cancelAfter) Hit(r *vec3.Ray, ray_t interval.Interval, rec *hittable.HitRecord) bool {
+	if c.hits.Add(1) == c.limit {
+		c.cancel()
+	}
+	return c.Hittable.Hit(r, ray_t, rec)
+}
+
+func TestRenderContext(t *testing.T) {
+	var world hittable.HittableList
+	world.Append(hittable.Sphere{Center: vec3.Point3{X: 0, Y: 0, Z: -1}, Radius: 0.5, Mat: hittable.Lambertian{Albedo: vec3.Vec3{X: 0.5, Y: 0.5, Z: 0.5}}})
+
+	newCam := func() Camera {
+		return testCamera(func(c *Camera) {
+			c.SamplesPerPass = 2
+			c.Workers = 2
+			c.TileSize = 4
+			c.RecordAOVs = true
+		})
+	}
+	renders := []struct {
+		name   string
+		render func(cam *Camera, ctx context.Context, world hittable.Hittable) (*framebuffer.Framebuffer, error)
+	}{
+		{"RenderMultiContext", func(cam *Camera, ctx context.Context, world hittable.Hittable) (*framebuffer.Framebuffer, error) {
+			return cam.RenderMultiContext(ctx, world)
+		}},
+		{"RenderSingleContext", func(cam *Camera, ctx context.Context, world hittable.Hittable) (*framebuffer.Framebuffer, error) {
+			return cam.RenderSingleContext(ctx, world)
+		}},
+		{"RenderProgressiveContext", func(cam *Camera, ctx context.Context, world hittable.Hittable) (*framebuffer.Framebuffer, error) {
+			return cam.RenderProgressiveContext(ctx, world, func(fb *framebuffer.Framebuffer, samples int) bool {
+				t.Errorf("onPass called for a cancelled pass")
+				return true
+			})
+		}},
+	}
+
+	unwritten := func(fb *framebuffer.Framebuffer) int {
+		n := 0
+		for _, p := range fb.Pixels {
+			if p.LengthSquared() == 0 {
+				n++
+			}
+		}
+		return n
+	}
+
+	for _, tt := range renders {
+		t.Run(tt.name, func(t *testing.T) {
+			// Already cancelled: nothing is rendered
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			cam := newCam()
+			fb, err := tt.render(&cam, ctx, &world)
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("Got error %v, want context.Canceled", err)
+			}
+			if fb == nil || unwritten(fb) != len(fb.Pixels) {
+				t.Fatalf("Expected an empty image from a cancelled render")
+			}
+
+			// Cancelled part way through the first pass: some pixels are
+			// done and the rest left black
+			ctx, cancel = context.WithCancel(context.Background())
+			defer cancel()
+			scene := &cancelAfter{Hittable: &world, limit: 300, cancel: cancel}
+			cam = newCam()
+			if fb, err = tt.render(&cam, ctx, scene); !errors.Is(err, context.Canceled) {
+				t.Fatalf("Got error %v, want context.Canceled", err)
+			}
+			if n := unwritten(fb); n == 0 || n == len(fb.Pixels) {
+				t.Errorf("%d of %d pixels unwritten, want some but not all", n, len(fb.Pixels))
+			}
+			if cam.AOVs == nil {
+				t.Errorf("Expected the AOVs of the partial image")
+			}
+		})
+	}
+
+	// Not cancelled: a full render and no error
+	cam := newCam()
+	fb, err := cam.RenderMultiContext(context.Background(), &world)
+	if err != nil {
+		t.Fatalf("RenderMultiContext() returned error: %v", err)
+	}
+	if n := unwritten(fb); n != 0 {
+		t.Errorf("%d pixels unwritten", n)
+	}
+}
@@ -0,0 +1,126 @@
+package camera
+
+import (
+	"go-tracer/src/texture"
+	"go-tracer/src/utils"
+	"go-tracer/src/vec3"
+	"math"
+	"sort"
+)
+
+// Equirectangular image surrounding the scene, e.g. an HDR photo of the sky.
+// It is also a light: Random picks directions towards bright pixels more
+// often, so small bright features like the sun converge quickly when the
+// environment is one of the camera's Lights.
+type EnvironmentMap struct {
+	Image     *texture.Image
+	Intensity float64 // multiplies every pixel
+	Rotation  float64 // degrees the map is turned about the vertical axis
+
+	// Cumulative distributions for picking a pixel in proportion to its
+	// brightness and the solid angle it covers: a row from rowCDF, then a
+	// column from that row's slice of colCDF
+	rowCDF []float64
+	colCDF []float64
+}
+
+func NewEnvironmentMap(img *texture.Image, intensity, rotation float64) *EnvironmentMap {
+	e := &EnvironmentMap{Image: img, Intensity: intensity, Rotation: rotation}
+	w, h := img.Width, img.Height
+
+	weights := make([]float64, w*h)
+	total := 0.0
+	for j := 0; j < h; j++ {
+		// Rows near the poles are squeezed into a small solid angle
+		sin_theta := math.Sin(math.Pi * (float64(j) + 0.5) / float64(h))
+		for i := 0; i < w; i++ {
+			weights[j*w+i] = luminance(img.Pixels[j*w+i]) * sin_theta
+			total += weights[j*w+i]
+		}
+	}
+	// A black map still needs a valid distribution
+	if total <= 0 {
+		for j := 0; j < h; j++ {
+			for i := 0; i < w; i++ {
+				weights[j*w+i] = math.Sin(math.Pi * (float64(j) + 0.5) / float64(h))
+			}
+		}
+	}
+
+	e.rowCDF = make([]float64, h+1)
+	e.colCDF = make([]float64, h*(w+1))
+	for j := 0; j < h; j++ {
+		row := e.colCDF[j*(w+1) : (j+1)*(w+1)]
+		for i := 0; i < w; i++ {
+			row[i+1] = row[i] + weights[j*w+i]
+		}
+		e.rowCDF[j+1] = e.rowCDF[j] + row[w]
+	}
+	return e
+}
+
+func luminance(c vec3.Vec3) float64 {
+	return 0.2126*c.X + 0.7152*c.Y + 0.0722*c.Z
+}
+
+// Map coordinates (u around the horizon, v from bottom to top) of a direction,
+// matching the sphere texture mapping
+func (e *EnvironmentMap) uv(direction vec3.Vec3) (float64, float64) {
+	d := *direction.UnitVector()
+	theta := math.Acos(math.Max(-1, math.Min(1, -d.Y)))
+	phi := math.Atan2(-d.Z, d.X) + math.Pi
+	u := phi/(2*math.Pi) - e.Rotation/360
+	return u - math.Floor(u), theta / math.Pi
+}
+
+func (e *EnvironmentMap) direction(u, v float64) vec3.Vec3 {
+	phi := 2 * math.Pi * (u + e.Rotation/360)
+	theta := math.Pi * v
+	return vec3.Vec3{X: -math.Cos(phi) * math.Sin(theta), Y: -math.Cos(theta), Z: math.Sin(phi) * math.Sin(theta)}
+}
+
+// Pixel column and row (from the top) that u, v fall in
+func (e *EnvironmentMap) pixel(u, v float64) (int, int) {
+	i := min(int(u*float64(e.Image.Width)), e.Image.Width-1)
+	j := min(int((1-v)*float64(e.Image.Height)), e.Image.Height-1)
+	return max(i, 0), max(j, 0)
+}
+
+func (e *EnvironmentMap) Value(r *vec3.Ray) vec3.Vec3 {
+	u, v := e.uv(r.GetDirection())
+	i, j := e.pixel(u, v)
+	return *e.Image.Pixels[j*e.Image.Width+i].MultiplyFloat(e.Intensity)
+}
+
+// Density of Random's directions: the chance of picking the pixel, spread
+// over the solid angle it covers
+func (e *EnvironmentMap) PDFValue(origin vec3.Point3, direction vec3.Vec3) float64 {
+	u, v := e.uv(direction)
+	sin_theta := math.Sin(math.Pi * v)
+	if sin_theta <= 0 {
+		return 0
+	}
+	w, h := e.Image.Width, e.Image.Height
+	i, j := e.pixel(u, v)
+	p_pixel := (e.colCDF[j*(w+1)+i+1] - e.colCDF[j*(w+1)+i]) / e.rowCDF[h]
+	return p_pixel * float64(w*h) / (2 * math.Pi * math.Pi * sin_theta)
+}
+
+func (e *EnvironmentMap) Random(origin vec3.Point3, rnd utils.Random) vec3.Vec3 {
+	w, h := e.Image.Width, e.Image.Height
+	j := sampleCDF(e.rowCDF, rnd.Float64())
+	i := sampleCDF(e.colCDF[j*(w+1):(j+1)*(w+1)], rnd.Float64())
+
+	u := (float64(i) + rnd.Float64()) / float64(w)
+	v := 1 - (float64(j)+rnd.Float64())/float64(h)
+	return e.direction(u, v)
+}
+
+// Index k of the bucket [cdf[k], cdf[k+1]) that x (in [0, 1)) of the total falls in
+func sampleCDF(cdf []float64, x float64) int {
+	target := x * cdf[len(cdf)-1]
+	// Searching for the first bound above the target skips zero-width
+	// buckets, so black pixels are never chosen
+	k := sort.Search(len(cdf), func(n int) bool { return cdf[n] > target }) - 1
+	return max(0, min(k, len(cdf)-2))
+}
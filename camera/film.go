@@ -0,0 +1,161 @@
+package camera
+
+import (
+	"go-tracer/src/framebuffer"
+	"go-tracer/src/vec3"
+	"math"
+	"sync"
+)
+
+// Filtered samples of a rectangle of pixels: each sample is added to every
+// pixel its filter reaches, weighted by the filter, and each pixel keeps the
+// weighted sum and the sum of the weights. Dividing one by the other gives
+// the filtered image.
+type film struct {
+	bounds Tile
+	color  []vec3.Vec3
+	weight []float64
+}
+
+func newFilm(bounds Tile) *film {
+	f := &film{}
+	f.reset(bounds)
+	return f
+}
+
+// Empty f and point it at bounds, reusing its buffers if they are big enough
+func (f *film) reset(bounds Tile) {
+	size := (bounds.X1 - bounds.X0) * (bounds.Y1 - bounds.Y0)
+	f.bounds = bounds
+	if cap(f.color) < size {
+		f.color = make([]vec3.Vec3, size)
+		f.weight = make([]float64, size)
+		return
+	}
+	f.color, f.weight = f.color[:size], f.weight[:size]
+	clear(f.color)
+	clear(f.weight)
+}
+
+// Pixels either side of its own a sample can reach with the camera's filter
+func (c *Camera) filterReach() int {
+	return int(math.Ceil(c.Filter.Extent() - 0.5))
+}
+
+func (c *Camera) imageFilm() *film {
+	return newFilm(Tile{X0: 0, Y0: 0, X1: c.ImageWidth, Y1: c.ImageHeight})
+}
+
+func (f *film) index(i, j int) int {
+	return (j-f.bounds.Y0)*(f.bounds.X1-f.bounds.X0) + i - f.bounds.X0
+}
+
+// Add a sample of pixel (i, j), taken px, py pixels from its center, to the
+// pixels around it
+func (c *Camera) splat(f *film, i, j int, px, py float64, sample vec3.Vec3) {
+	reach := c.filterReach()
+	for y := max(j-reach, f.bounds.Y0); y <= min(j+reach, f.bounds.Y1-1); y++ {
+		for x := max(i-reach, f.bounds.X0); x <= min(i+reach, f.bounds.X1-1); x++ {
+			w := c.Filter.Weight(float64(x-i)-px, float64(y-j)-py)
+			if w == 0 {
+				continue
+			}
+			idx := f.index(x, y)
+			f.color[idx].PlusEqual(*sample.MultiplyFloat(w))
+			f.weight[idx] += w
+		}
+	}
+}
+
+// The filtered image of a film covering the whole image. Filters with
+// negative lobes can ring below zero next to bright edges, so channels are
+// clamped at 0; pixels with no weight at all are black.
+func (f *film) resolve() *framebuffer.Framebuffer {
+	fb := framebuffer.New(f.bounds.X1-f.bounds.X0, f.bounds.Y1-f.bounds.Y0)
+	for idx, sum := range f.color {
+		if f.weight[idx] <= 0 {
+			continue
+		}
+		p := sum.DivideFloat(f.weight[idx])
+		fb.Pixels[idx] = vec3.Vec3{X: math.Max(p.X, 0), Y: math.Max(p.Y, 0), Z: math.Max(p.Z, 0)}
+	}
+	return fb
+}
+
+// The image film of a tiled render. Workers splat each tile into a film of
+// its own, taken from a pool when they claim the tile, so they never touch
+// each other's pixels. When the tile is done its own pixels, which no other
+// tile's film covers, go straight into the image; the margin its filter
+// reached past the tile's edge is held back until mergeBorders adds every
+// tile's margin in tile order, so the image doesn't depend on which worker
+// finished first.
+type tiledFilm struct {
+	image   *film
+	reach   int
+	borders []filmBorder // margin of each finished tile, by tile index
+	pool    sync.Pool
+}
+
+// Margin of one tile's film: image pixel indices and their sums
+type filmBorder struct {
+	pixels []int
+	color  []vec3.Vec3
+	weight []float64
+}
+
+func (c *Camera) newTiledFilm(tiles []Tile) *tiledFilm {
+	return &tiledFilm{image: c.imageFilm(), reach: c.filterReach(), borders: make([]filmBorder, len(tiles))}
+}
+
+// Empty film for everything the samples of tile t can reach: t grown by the
+// filter's reach, clipped to the image
+func (tf *tiledFilm) claim(t Tile) *film {
+	bounds := Tile{
+		X0: max(t.X0-tf.reach, 0),
+		Y0: max(t.Y0-tf.reach, 0),
+		X1: min(t.X1+tf.reach, tf.image.bounds.X1),
+		Y1: min(t.Y1+tf.reach, tf.image.bounds.Y1),
+	}
+	if f, ok := tf.pool.Get().(*film); ok {
+		f.reset(bounds)
+		return f
+	}
+	return newFilm(bounds)
+}
+
+// Hand back the film of tile k, which covers tile t
+func (tf *tiledFilm) finish(k int, t Tile, f *film) {
+	border := &tf.borders[k]
+	border.pixels, border.color, border.weight = border.pixels[:0], border.color[:0], border.weight[:0]
+	for y := f.bounds.Y0; y < f.bounds.Y1; y++ {
+		for x := f.bounds.X0; x < f.bounds.X1; x++ {
+			from := f.index(x, y)
+			if f.weight[from] == 0 && f.color[from] == (vec3.Vec3{}) {
+				continue
+			}
+			if x >= t.X0 && x < t.X1 && y >= t.Y0 && y < t.Y1 {
+				to := tf.image.index(x, y)
+				tf.image.color[to].PlusEqual(f.color[from])
+				tf.image.weight[to] += f.weight[from]
+				continue
+			}
+			border.pixels = append(border.pixels, tf.image.index(x, y))
+			border.color = append(border.color, f.color[from])
+			border.weight = append(border.weight, f.weight[from])
+		}
+	}
+	tf.pool.Put(f)
+}
+
+// Add the margins of the tiles finished since the last call to the image, in
+// tile order. Call once no tile is being rendered.
+func (tf *tiledFilm) mergeBorders() {
+	for k := range tf.borders {
+		border := &tf.borders[k]
+		for n, idx := range border.pixels {
+			tf.image.color[idx].PlusEqual(border.color[n])
+			tf.image.weight[idx] += border.weight[n]
+		}
+		border.pixels, border.color, border.weight = border.pixels[:0], border.color[:0], border.weight[:0]
+	}
+}
@@ -0,0 +1,131 @@
+package camera
+
+import (
+	"context"
+	"go-tracer/src/framebuffer"
+	"go-tracer/src/hittable"
+	"go-tracer/src/sampler"
+	"go-tracer/src/utils"
+	"log"
+	"sync/atomic"
+)
+
+// Render in passes of SamplesPerPass samples per pixel until SamplesPerPixel
+// is reached, accumulating the filtered samples into a running sum. After
+// each pass onPass gets the image so far and the number of samples per pixel
+// in it; returning false stops the render early. The last image produced is returned, and if
+// RecordAOVs is set c.AOVs is kept up to date with it before each onPass.
+//
+// With a NoiseThreshold set, pixels that have converged (see RenderMulti) are
+// skipped by later passes, and the render ends once every pixel has. The
+// samples passed to onPass are then those of the pixels still sampling.
+func (c *Camera) RenderProgressive(world hittable.Hittable, onPass func(fb *framebuffer.Framebuffer, samples int) bool) (*framebuffer.Framebuffer, error) {
+	return c.RenderProgressiveContext(context.Background(), world, onPass)
+}
+
+// RenderProgressive that stops once ctx is done, part way through a pass if
+// need be. The image so far, including whatever the interrupted pass added,
+// is returned along with ctx.Err(); onPass isn't called for that pass.
+func (c *Camera) RenderProgressiveContext(ctx context.Context, world hittable.Hittable, onPass func(fb *framebuffer.Framebuffer, samples int) bool) (*framebuffer.Framebuffer, error) {
+	if err := c.Initalize(); err != nil {
+		return nil, err
+	}
+
+	perPass := c.SamplesPerPass
+	if perPass <= 0 {
+		perPass = 1
+	}
+	tiles := c.tiles()
+	sum := c.newTiledFilm(tiles)
+	counts := make([]int, c.ImageWidth*c.ImageHeight)
+	var stats []runningStats
+	if c.adaptive() {
+		stats = make([]runningStats, len(counts))
+	}
+	c.AOVs = nil
+	c.SampleCounts = nil
+	var aovSum *AOVs
+	if c.RecordAOVs {
+		aovSum = NewAOVs(c.ImageWidth, c.ImageHeight)
+	}
+	log.Println("Number of workers: ", c.numWorkers())
+
+	var fb *framebuffer.Framebuffer
+	samples := 0
+	for pass := 0; samples < c.SamplesPerPixel; pass++ {
+		n := min(perPass, c.SamplesPerPixel-samples)
+		// Independent samples come fresh from each pass's seed; the other
+		// samplers keep one pattern per pixel and carry on along it
+		seed := c.Seed
+		if c.Sampler == sampler.Independent {
+			seed = utils.PassSeed(c.Seed, pass)
+		}
+		var active, finished atomic.Int64
+		c.forEachTile(ctx, tiles, func(k int, t Tile) {
+			fm := sum.claim(t)
+			defer sum.finish(k, t, fm)
+			for j := t.Y0; j < t.Y1; j++ {
+				for i := t.X0; i < t.X1; i++ {
+					if cancelled(ctx) {
+						return
+					}
+					idx := j*c.ImageWidth + i
+					if stats != nil && c.pixelConverged(&stats[idx]) {
+						continue
+					}
+					active.Add(1)
+
+					smp := c.pixelSampler(seed, i, j)
+					var aov *aovSample
+					if aovSum != nil {
+						pixel_aov := aovSum.at(i, j)
+						aov = &pixel_aov
+					}
+					if stats != nil {
+						c.samplePixelAdaptive(i, j, world, smp, &stats[idx], counts[idx]+n, aov, fm)
+						counts[idx] = stats[idx].n
+					} else {
+						c.samplePixel(i, j, world, smp, counts[idx], n, aov, fm)
+						counts[idx] += n
+					}
+					if aov != nil {
+						aovSum.set(i, j, *aov)
+						if pass == 0 {
+							c.setPixelIDs(aovSum, i, j, world)
+						}
+					}
+				}
+			}
+			finished.Add(1)
+		})
+		stopped := finished.Load() < int64(len(tiles))
+		if !stopped && active.Load() == 0 {
+			log.Println("Every pixel has converged")
+			break
+		}
+		if !stopped {
+			samples += n
+		}
+
+		sum.mergeBorders()
+		fb = sum.image.resolve()
+		if aovSum != nil {
+			c.AOVs = aovSum.averaged(counts)
+		}
+		if stats != nil {
+			c.SampleCounts = counts
+		}
+		if stopped {
+			log.Println("Stopped early:", ctx.Err())
+			return fb, ctx.Err()
+		}
+		log.Printf("Pass %d done, %d/%d samples per pixel", pass+1, samples, c.SamplesPerPixel)
+		if onPass != nil && !onPass(fb, samples) {
+			log.Println("Stopped early")
+			break
+		}
+	}
+
+	log.Println("Done!")
+	return fb, nil
+}
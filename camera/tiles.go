@@ -0,0 +1,90 @@
+package camera
+
+import (
+	"context"
+	"go-tracer/src/hittable"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+const DefaultTileSize = 32
+
+// Half-open rectangle of pixels [X0, X1) x [Y0, Y1)
+type Tile struct {
+	X0, Y0, X1, Y1 int
+}
+
+func (c *Camera) numWorkers() int {
+	if c.Workers > 0 {
+		return c.Workers
+	}
+	return runtime.NumCPU()
+}
+
+// Split the image into tiles in scanline order; edge tiles may be smaller
+func (c *Camera) tiles() []Tile {
+	size := c.TileSize
+	if size <= 0 {
+		size = DefaultTileSize
+	}
+
+	tiles := make([]Tile, 0, ((c.ImageWidth+size-1)/size)*((c.ImageHeight+size-1)/size))
+	for y := 0; y < c.ImageHeight; y += size {
+		for x := 0; x < c.ImageWidth; x += size {
+			tiles = append(tiles, Tile{X0: x, Y0: y, X1: min(x+size, c.ImageWidth), Y1: min(y+size, c.ImageHeight)})
+		}
+	}
+	return tiles
+}
+
+// Run fn over every tile, with its index, on c.numWorkers() goroutines, each
+// claiming the next unclaimed tile as soon as it finishes its last one. Once
+// ctx is done no more tiles are claimed.
+func (c *Camera) forEachTile(ctx context.Context, tiles []Tile, fn func(k int, t Tile)) {
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < c.numWorkers(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				claimed := int(next.Add(1) - 1)
+				if claimed >= len(tiles) || cancelled(ctx) {
+					return
+				}
+				fn(claimed, tiles[claimed])
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Render the pixels of t into fm, stopping part way if ctx is done. Returns
+// whether every pixel was rendered.
+func (c *Camera) renderTile(ctx context.Context, t Tile, world hittable.Hittable, fm *film) bool {
+	for j := t.Y0; j < t.Y1; j++ {
+		for i := t.X0; i < t.X1; i++ {
+			if cancelled(ctx) {
+				return false
+			}
+			c.renderPixel(i, j, world, fm)
+		}
+	}
+	return true
+}
+
+// Whether ctx is done, without waiting
+func cancelled(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+// Log roughly every 10% of the tiles rather than after each one
+func progressInterval(numTiles int) int64 {
+	return int64(max(numTiles/10, 1))
+}
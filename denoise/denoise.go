@@ -0,0 +1,183 @@
+package denoise
+
+import (
+	"fmt"
+	"go-tracer/src/framebuffer"
+	"go-tracer/src/vec3"
+	"math"
+	"runtime"
+	"sync"
+)
+
+// Settings of the edge-avoiding À-Trous wavelet filter (Dammertz et al. 2010).
+// Each iteration blurs with a 5x5 B-spline kernel whose taps are spread twice
+// as far apart as the last, and every tap is weighted down by how much its
+// color, normal and albedo differ from the pixel's, so edges stay sharp.
+// Zero fields take the Default value.
+type Options struct {
+	Iterations  int     // number of passes; the filter reaches 2^Iterations pixels
+	ColorSigma  float64 // tolerated color difference, halved each iteration
+	NormalSigma float64 // tolerated distance between unit normals
+	AlbedoSigma float64 // tolerated albedo difference
+}
+
+var Default = Options{Iterations: 5, ColorSigma: 0.5, NormalSigma: 0.3, AlbedoSigma: 0.1}
+
+// Albedos darker than this aren't divided out, as noise would blow up
+const minAlbedo = 1e-3
+
+// B3 spline weights for taps -2..2
+var kernel = [5]float64{1.0 / 16, 1.0 / 4, 3.0 / 8, 1.0 / 4, 1.0 / 16}
+
+func (o Options) withDefaults() Options {
+	if o.Iterations <= 0 {
+		o.Iterations = Default.Iterations
+	}
+	if o.ColorSigma <= 0 {
+		o.ColorSigma = Default.ColorSigma
+	}
+	if o.NormalSigma <= 0 {
+		o.NormalSigma = Default.NormalSigma
+	}
+	if o.AlbedoSigma <= 0 {
+		o.AlbedoSigma = Default.AlbedoSigma
+	}
+	return o
+}
+
+// Denoise a rendered image, guided by its albedo and normal AOVs (which must
+// be the same size). The albedo is divided out first so that textures aren't
+// blurred along with the noise in the lighting, then multiplied back in.
+func Denoise(color, albedo, normal *framebuffer.Framebuffer, opts Options) (*framebuffer.Framebuffer, error) {
+	for _, aux := range []*framebuffer.Framebuffer{albedo, normal} {
+		if aux.Width != color.Width || aux.Height != color.Height {
+			return nil, fmt.Errorf("denoise: AOV is %dx%d but the image is %dx%d", aux.Width, aux.Height, color.Width, color.Height)
+		}
+	}
+	opts = opts.withDefaults()
+
+	// Demodulate: filter the lighting rather than lighting times texture
+	irradiance := framebuffer.New(color.Width, color.Height)
+	for idx, c := range color.Pixels {
+		irradiance.Pixels[idx] = demodulate(c, albedo.Pixels[idx])
+	}
+
+	irradiance = clampFireflies(irradiance)
+	sigma := opts.ColorSigma
+	for it := 0; it < opts.Iterations; it++ {
+		irradiance = pass(irradiance, albedo, normal, 1<<it, sigma, opts)
+		sigma /= 2
+	}
+
+	out := framebuffer.New(color.Width, color.Height)
+	for idx, c := range irradiance.Pixels {
+		out.Pixels[idx] = remodulate(c, albedo.Pixels[idx])
+	}
+	return out, nil
+}
+
+func demodulate(c, a vec3.Vec3) vec3.Vec3 {
+	return vec3.Vec3{X: c.X / safeAlbedo(a.X), Y: c.Y / safeAlbedo(a.Y), Z: c.Z / safeAlbedo(a.Z)}
+}
+
+func remodulate(c, a vec3.Vec3) vec3.Vec3 {
+	return vec3.Vec3{X: c.X * safeAlbedo(a.X), Y: c.Y * safeAlbedo(a.Y), Z: c.Z * safeAlbedo(a.Z)}
+}
+
+// Channels too dark to divide by are left as they are
+func safeAlbedo(a float64) float64 {
+	if a < minAlbedo {
+		return 1
+	}
+	return a
+}
+
+// Clamp every pixel to the brightest of its 8 neighbours. A lone very bright
+// sample (a firefly) differs so much from its surroundings that the color
+// weights would keep it out of every average, leaving a white speck.
+func clampFireflies(in *framebuffer.Framebuffer) *framebuffer.Framebuffer {
+	out := framebuffer.New(in.Width, in.Height)
+	for j := 0; j < in.Height; j++ {
+		for i := 0; i < in.Width; i++ {
+			brightest := vec3.Vec3{X: -1, Y: -1, Z: -1}
+			for y := max(j-1, 0); y <= min(j+1, in.Height-1); y++ {
+				for x := max(i-1, 0); x <= min(i+1, in.Width-1); x++ {
+					if x == i && y == j {
+						continue
+					}
+					q := in.At(x, y)
+					brightest = vec3.Vec3{X: math.Max(brightest.X, q.X), Y: math.Max(brightest.Y, q.Y), Z: math.Max(brightest.Z, q.Z)}
+				}
+			}
+			c := in.At(i, j)
+			if brightest.X < 0 {
+				// A 1x1 image has no neighbours
+				out.Set(i, j, c)
+				continue
+			}
+			out.Set(i, j, vec3.Vec3{X: math.Min(c.X, brightest.X), Y: math.Min(c.Y, brightest.Y), Z: math.Min(c.Z, brightest.Z)})
+		}
+	}
+	return out
+}
+
+// Compress HDR colors into [0, 1) so one ColorSigma suits bright and dark
+// parts of the image alike
+func compress(c vec3.Vec3) vec3.Vec3 {
+	return vec3.Vec3{X: c.X / (1 + c.X), Y: c.Y / (1 + c.Y), Z: c.Z / (1 + c.Z)}
+}
+
+// One À-Trous iteration with taps step pixels apart, rows shared out between
+// one goroutine per CPU
+func pass(in, albedo, normal *framebuffer.Framebuffer, step int, sigma float64, opts Options) *framebuffer.Framebuffer {
+	out := framebuffer.New(in.Width, in.Height)
+	colorScale := 1 / (sigma * sigma)
+	normalScale := 1 / (opts.NormalSigma * opts.NormalSigma)
+	albedoScale := 1 / (opts.AlbedoSigma * opts.AlbedoSigma)
+
+	filterRow := func(j int) {
+		for i := 0; i < in.Width; i++ {
+			cp := compress(in.At(i, j))
+			np := normal.At(i, j)
+			ap := albedo.At(i, j)
+
+			var sum vec3.Vec3
+			total := 0.0
+			for dy := -2; dy <= 2; dy++ {
+				y := j + dy*step
+				if y < 0 || y >= in.Height {
+					continue
+				}
+				for dx := -2; dx <= 2; dx++ {
+					x := i + dx*step
+					if x < 0 || x >= in.Width {
+						continue
+					}
+					cq := in.At(x, y)
+					dc := compress(cq).Subtract(cp).LengthSquared()
+					dn := normal.At(x, y).Subtract(np).LengthSquared()
+					da := albedo.At(x, y).Subtract(ap).LengthSquared()
+					w := kernel[dx+2] * kernel[dy+2] * math.Exp(-dc*colorScale-dn*normalScale-da*albedoScale)
+					sum.PlusEqual(*cq.MultiplyFloat(w))
+					total += w
+				}
+			}
+			// The center tap always has weight, so total is never zero
+			out.Set(i, j, *sum.DivideFloat(total))
+		}
+	}
+
+	var wg sync.WaitGroup
+	workers := runtime.NumCPU()
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for j := w; j < in.Height; j += workers {
+				filterRow(j)
+			}
+		}(w)
+	}
+	wg.Wait()
+	return out
+}
@@ -0,0 +1,131 @@
+package denoise
+
+import (
+	"go-tracer/src/framebuffer"
+	"go-tracer/src/utils"
+	"go-tracer/src/vec3"
+	"math"
+	"testing"
+)
+
+const size = 32
+
+func filled(c vec3.Vec3) *framebuffer.Framebuffer {
+	fb := framebuffer.New(size, size)
+	for idx := range fb.Pixels {
+		fb.Pixels[idx] = c
+	}
+	return fb
+}
+
+func grey(v float64) vec3.Vec3 {
+	return vec3.Vec3{X: v, Y: v, Z: v}
+}
+
+// Mean and variance of the red channel over columns [x0, x1)
+func stats(fb *framebuffer.Framebuffer, x0, x1 int) (float64, float64) {
+	sum, sumSq, n := 0.0, 0.0, 0.0
+	for j := 0; j < fb.Height; j++ {
+		for i := x0; i < x1; i++ {
+			v := fb.At(i, j).X
+			sum += v
+			sumSq += v * v
+			n++
+		}
+	}
+	mean := sum / n
+	return mean, sumSq/n - mean*mean
+}
+
+func TestDenoiseSizeMismatch(t *testing.T) {
+	color := framebuffer.New(4, 4)
+	if _, err := Denoise(color, framebuffer.New(4, 4), framebuffer.New(4, 3), Default); err == nil {
+		t.Errorf("Expected an error for a normal buffer of the wrong size")
+	}
+}
+
+func TestDenoiseSmoothsNoise(t *testing.T) {
+	rnd := utils.NewRNG(1)
+	color := framebuffer.New(size, size)
+	for idx := range color.Pixels {
+		color.Pixels[idx] = grey(0.5 + 0.2*(rnd.Float64()-0.5))
+	}
+	out, err := Denoise(color, filled(grey(1)), filled(vec3.Vec3{X: 0, Y: 0, Z: 1}), Options{})
+	if err != nil {
+		t.Fatalf("Denoise() returned error: %v", err)
+	}
+
+	inMean, inVar := stats(color, 0, size)
+	outMean, outVar := stats(out, 0, size)
+	if math.Abs(outMean-inMean) > 0.01 {
+		t.Errorf("Mean changed from %v to %v", inMean, outMean)
+	}
+	if outVar > inVar/10 {
+		t.Errorf("Variance only dropped from %v to %v", inVar, outVar)
+	}
+}
+
+func TestDenoiseKeepsEdges(t *testing.T) {
+	// Two noisy walls meeting in a crease, told apart only by their normals
+	rnd := utils.NewRNG(2)
+	color := framebuffer.New(size, size)
+	normal := framebuffer.New(size, size)
+	for j := 0; j < size; j++ {
+		for i := 0; i < size; i++ {
+			base, n := 0.2, vec3.Vec3{X: 1, Y: 0, Z: 0}
+			if i >= size/2 {
+				base, n = 0.8, vec3.Vec3{X: 0, Y: 1, Z: 0}
+			}
+			color.Set(i, j, grey(base+0.1*(rnd.Float64()-0.5)))
+			normal.Set(i, j, n)
+		}
+	}
+	out, err := Denoise(color, filled(grey(1)), normal, Default)
+	if err != nil {
+		t.Fatalf("Denoise() returned error: %v", err)
+	}
+
+	if left, _ := stats(out, size/2-1, size/2); math.Abs(left-0.2) > 0.02 {
+		t.Errorf("Column left of the edge averages %v, want about 0.2", left)
+	}
+	if right, _ := stats(out, size/2, size/2+1); math.Abs(right-0.8) > 0.02 {
+		t.Errorf("Column right of the edge averages %v, want about 0.8", right)
+	}
+}
+
+func TestDenoiseKeepsTextures(t *testing.T) {
+	// Evenly lit checkerboard: the albedo is divided out, leaving nothing to blur
+	color := framebuffer.New(size, size)
+	albedo := framebuffer.New(size, size)
+	for j := 0; j < size; j++ {
+		for i := 0; i < size; i++ {
+			a := grey(0.1)
+			if (i/2+j/2)%2 == 0 {
+				a = grey(0.9)
+			}
+			albedo.Set(i, j, a)
+			color.Set(i, j, *a.MultiplyFloat(0.5))
+		}
+	}
+	out, err := Denoise(color, albedo, filled(vec3.Vec3{X: 0, Y: 0, Z: 1}), Default)
+	if err != nil {
+		t.Fatalf("Denoise() returned error: %v", err)
+	}
+	for idx := range color.Pixels {
+		if math.Abs(out.Pixels[idx].X-color.Pixels[idx].X) > 1e-9 {
+			t.Fatalf("Pixel %d changed from %v to %v", idx, color.Pixels[idx], out.Pixels[idx])
+		}
+	}
+}
+
+func TestDenoiseRemovesFireflies(t *testing.T) {
+	color := filled(grey(0.5))
+	color.Set(10, 10, grey(50))
+	out, err := Denoise(color, filled(grey(1)), filled(vec3.Vec3{X: 0, Y: 0, Z: 1}), Default)
+	if err != nil {
+		t.Fatalf("Denoise() returned error: %v", err)
+	}
+	if got := out.At(10, 10); math.Abs(got.X-0.5) > 0.01 {
+		t.Errorf("Firefly pixel = %v, want about 0.5", got)
+	}
+}
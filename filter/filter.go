@@ -0,0 +1,102 @@
+package filter
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+type Kind int
+
+const (
+	Box      Kind = iota // every sample within the radius counts the same
+	Tent                 // weight falls off linearly to zero at the radius
+	Gaussian             // smooth bell, slightly soft
+	Mitchell             // Mitchell-Netravali cubic (B = C = 1/3), sharp with faint ringing
+	Lanczos              // windowed sinc, sharpest, rings the most
+)
+
+var kindNames = []string{"box", "tent", "gaussian", "mitchell", "lanczos"}
+
+func (k Kind) String() string {
+	if k >= 0 && int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+func ParseKind(name string) (Kind, error) {
+	for k, n := range kindNames {
+		if strings.EqualFold(name, n) {
+			return Kind(k), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown filter %q (want %s)", name, strings.Join(kindNames, ", "))
+}
+
+// Radius each filter uses when none is given, in pixels
+var defaultRadii = []float64{0.5, 1, 1.5, 2, 2}
+
+// A pixel reconstruction filter: how much a sample taken dx, dy pixels from
+// the center of a pixel counts towards that pixel. The zero value is a box
+// over the pixel itself, which just averages the pixel's own samples.
+type Filter struct {
+	Kind   Kind
+	Radius float64 // half-width of the support in pixels, 0 means the kind's default
+}
+
+// Half-width of the support in pixels: samples further than this from a
+// pixel center along either axis don't touch it
+func (f Filter) Extent() float64 {
+	if f.Radius > 0 {
+		return f.Radius
+	}
+	if f.Kind >= 0 && int(f.Kind) < len(defaultRadii) {
+		return defaultRadii[f.Kind]
+	}
+	return 0.5
+}
+
+// Weight of a sample offset dx, dy pixels from the pixel center. Filters are
+// separable, the product of the 1D filter along each axis. Mitchell and
+// Lanczos go negative away from the center.
+func (f Filter) Weight(dx, dy float64) float64 {
+	r := f.Extent()
+	if math.Abs(dx) > r || math.Abs(dy) > r {
+		return 0
+	}
+	return f.weight1D(dx, r) * f.weight1D(dy, r)
+}
+
+func (f Filter) weight1D(x, r float64) float64 {
+	x = math.Abs(x)
+	switch f.Kind {
+	case Tent:
+		return 1 - x/r
+	case Gaussian:
+		// sigma = r/3, shifted down so the weight reaches 0 at the radius
+		alpha := 4.5 / (r * r)
+		return math.Exp(-alpha*x*x) - math.Exp(-alpha*r*r)
+	case Mitchell:
+		return mitchell(2 * x / r)
+	case Lanczos:
+		return sinc(x) * sinc(x/r)
+	}
+	return 1
+}
+
+// Mitchell-Netravali cubic with B = C = 1/3 over [0, 2)
+func mitchell(x float64) float64 {
+	const b, c = 1.0 / 3, 1.0 / 3
+	if x < 1 {
+		return ((12-9*b-6*c)*x*x*x + (-18+12*b+6*c)*x*x + (6 - 2*b)) / 6
+	}
+	return ((-b-6*c)*x*x*x + (6*b+30*c)*x*x + (-12*b-48*c)*x + (8*b + 24*c)) / 6
+}
+
+func sinc(x float64) float64 {
+	if math.Abs(x) < 1e-5 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
@@ -0,0 +1,97 @@
+package filter
+
+import (
+	"math"
+	"testing"
+)
+
+const EPSILON = 1e-7
+
+var kinds = []Kind{Box, Tent, Gaussian, Mitchell, Lanczos}
+
+func TestParseKind(t *testing.T) {
+	for _, k := range kinds {
+		got, err := ParseKind(k.String())
+		if err != nil || got != k {
+			t.Errorf("ParseKind(%q) = %v, %v", k.String(), got, err)
+		}
+	}
+	if _, err := ParseKind("sinc"); err == nil {
+		t.Errorf("Expected an error for an unknown filter")
+	}
+}
+
+func TestExtent(t *testing.T) {
+	tests := []struct {
+		f    Filter
+		want float64
+	}{
+		{Filter{}, 0.5},
+		{Filter{Kind: Tent}, 1},
+		{Filter{Kind: Gaussian}, 1.5},
+		{Filter{Kind: Mitchell}, 2},
+		{Filter{Kind: Lanczos}, 2},
+		{Filter{Kind: Gaussian, Radius: 3}, 3},
+	}
+	for _, tt := range tests {
+		if got := tt.f.Extent(); got != tt.want {
+			t.Errorf("%v Extent() = %v, want %v", tt.f.Kind, got, tt.want)
+		}
+	}
+}
+
+func TestWeight(t *testing.T) {
+	tests := []struct {
+		name   string
+		f      Filter
+		dx, dy float64
+		want   float64
+	}{
+		{"box center", Filter{}, 0, 0, 1},
+		{"box inside", Filter{}, 0.4, -0.3, 1},
+		{"box outside", Filter{}, 0.6, 0, 0},
+		{"wide box", Filter{Radius: 1.5}, 1.2, 1.4, 1},
+		{"tent center", Filter{Kind: Tent}, 0, 0, 1},
+		{"tent halfway", Filter{Kind: Tent}, 0.5, 0, 0.5},
+		{"tent both axes", Filter{Kind: Tent}, 0.5, -0.5, 0.25},
+		{"gaussian edge", Filter{Kind: Gaussian}, 1.5, 0, 0},
+		{"mitchell center", Filter{Kind: Mitchell}, 0, 0, (8.0 / 9) * (8.0 / 9)},
+		{"mitchell edge", Filter{Kind: Mitchell}, 2, 0, 0},
+		{"lanczos center", Filter{Kind: Lanczos}, 0, 0, 1},
+		{"lanczos at a neighbor", Filter{Kind: Lanczos}, 1, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.f.Weight(tt.dx, tt.dy); math.Abs(got-tt.want) > EPSILON {
+				t.Errorf("Weight(%v, %v) = %v, want %v", tt.dx, tt.dy, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWeightShape(t *testing.T) {
+	for _, k := range kinds {
+		t.Run(k.String(), func(t *testing.T) {
+			f := Filter{Kind: k}
+			r := f.Extent()
+			if f.Weight(r+0.01, 0) != 0 || f.Weight(0, -r-0.01) != 0 {
+				t.Errorf("Expected no weight outside the radius %v", r)
+			}
+			// Symmetric, largest at the center and continuous
+			prev := f.Weight(0, 0)
+			for x := 0.01; x < r; x += 0.01 {
+				w := f.Weight(x, 0)
+				if w != f.Weight(-x, 0) || w != f.Weight(0, x) {
+					t.Fatalf("Weight not symmetric at %v", x)
+				}
+				if w > f.Weight(0, 0) {
+					t.Fatalf("Weight at %v = %v, more than at the center", x, w)
+				}
+				if k != Box && math.Abs(w-prev) > 0.05 {
+					t.Fatalf("Weight jumps from %v to %v at %v", prev, w, x)
+				}
+				prev = w
+			}
+		})
+	}
+}
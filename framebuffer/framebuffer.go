@@ -0,0 +1,41 @@
+package framebuffer
+
+import (
+	"go-tracer/src/vec3"
+	"image"
+)
+
+// In-memory image of linear (not gamma corrected) pixel colors, stored row by row
+type Framebuffer struct {
+	Width  int
+	Height int
+	Pixels []vec3.Vec3
+}
+
+func New(width, height int) *Framebuffer {
+	return &Framebuffer{Width: width, Height: height, Pixels: make([]vec3.Vec3, width*height)}
+}
+
+func (fb *Framebuffer) At(i, j int) vec3.Vec3 {
+	return fb.Pixels[j*fb.Width+i]
+}
+
+func (fb *Framebuffer) Set(i, j int, c vec3.Vec3) {
+	fb.Pixels[j*fb.Width+i] = c
+}
+
+// Copy of the framebuffer with every pixel multiplied by scale, e.g. to turn
+// a sum of samples into their average
+func (fb *Framebuffer) Scaled(scale float64) *Framebuffer {
+	scaled := New(fb.Width, fb.Height)
+	for idx, pixel := range fb.Pixels {
+		scaled.Pixels[idx] = *pixel.MultiplyFloat(scale)
+	}
+	return scaled
+}
+
+// Convert to an 8-bit sRGB-ish image (gamma 2), ready for encoding. Colors
+// brighter than 1 are clipped; use ToneMapped to keep highlight detail.
+func (fb *Framebuffer) Image() *image.RGBA {
+	return fb.ToneMapped(Clamp, 0)
+}
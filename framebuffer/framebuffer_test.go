@@ -0,0 +1,91 @@
+package framebuffer
+
+import (
+	"go-tracer/src/vec3"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestSetAndAt(t *testing.T) {
+	fb := New(3, 2)
+	c := vec3.Vec3{X: 0.1, Y: 0.2, Z: 0.3}
+	fb.Set(2, 1, c)
+
+	if got := fb.At(2, 1); got != c {
+		t.Errorf("At(2, 1) = %v, want %v", got, c)
+	}
+	if got := fb.Pixels[5]; got != c {
+		t.Errorf("Pixels stored out of row-major order: Pixels[5] = %v", got)
+	}
+}
+
+func TestImage(t *testing.T) {
+	fb := New(2, 1)
+	fb.Set(0, 0, vec3.Vec3{X: 0.25, Y: 0, Z: 4.0})
+	fb.Set(1, 0, vec3.Vec3{X: 1, Y: 1, Z: 1})
+
+	img := fb.Image()
+	// 0.25 is gamma corrected to 0.5; values above one are clamped
+	if got, want := img.RGBAAt(0, 0), (color.RGBA{R: 128, G: 0, B: 255, A: 255}); got != want {
+		t.Errorf("Pixel (0, 0) = %v, want %v", got, want)
+	}
+	if got, want := img.RGBAAt(1, 0), (color.RGBA{R: 255, G: 255, B: 255, A: 255}); got != want {
+		t.Errorf("Pixel (1, 0) = %v, want %v", got, want)
+	}
+}
+
+func TestToneMappers(t *testing.T) {
+	tests := []struct {
+		name   string
+		mapper ToneMapper
+		in     vec3.Vec3
+		want   vec3.Vec3
+	}{
+		{"Clamp cuts highlights", Clamp, vec3.Vec3{X: 0.5, Y: 2, Z: -1}, vec3.Vec3{X: 0.5, Y: 1, Z: 0}},
+		{"Reinhard halves luminance 1", Reinhard, vec3.Vec3{X: 1, Y: 1, Z: 1}, vec3.Vec3{X: 0.5, Y: 0.5, Z: 0.5}},
+		{"Reinhard keeps hue", Reinhard, vec3.Vec3{X: 2, Y: 1, Z: 0.5}, vec3.Vec3{X: 2 / 2.1765, Y: 1 / 2.1765, Z: 0.5 / 2.1765}},
+		{"Reinhard black", Reinhard, vec3.Vec3{}, vec3.Vec3{}},
+		{"ACES black", ACES, vec3.Vec3{}, vec3.Vec3{}},
+		{"ACES saturates", ACES, vec3.Vec3{X: 1000, Y: 1000, Z: 1000}, vec3.Vec3{X: 1, Y: 1, Z: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.mapper.Map(tt.in)
+			if math.Abs(got.X-tt.want.X) > 1e-9 || math.Abs(got.Y-tt.want.Y) > 1e-9 || math.Abs(got.Z-tt.want.Z) > 1e-9 {
+				t.Errorf("%v.Map(%v) = %v, want %v", tt.mapper, tt.in, got, tt.want)
+			}
+		})
+	}
+
+	// Every mapper keeps bright values distinguishable except clamp
+	for _, mapper := range []ToneMapper{Reinhard, ACES} {
+		a := mapper.Map(vec3.Vec3{X: 2, Y: 2, Z: 2})
+		b := mapper.Map(vec3.Vec3{X: 4, Y: 4, Z: 4})
+		if !(a.X < b.X && b.X <= 1) {
+			t.Errorf("%v maps 2 to %v and 4 to %v, want increasing values up to 1", mapper, a.X, b.X)
+		}
+	}
+
+	for _, name := range []string{"clamp", "reinhard", "aces"} {
+		if mapper, err := ParseToneMapper(name); err != nil || mapper.String() != name {
+			t.Errorf("ParseToneMapper(%q) = %v, %v", name, mapper, err)
+		}
+	}
+	if _, err := ParseToneMapper("filmic"); err == nil {
+		t.Errorf("Expected an error for an unknown tone mapper")
+	}
+}
+
+func TestToneMappedExposure(t *testing.T) {
+	fb := New(1, 1)
+	fb.Set(0, 0, vec3.Vec3{X: 0.0625, Y: 0.0625, Z: 0.0625})
+
+	// Two stops up turns 1/16 into 1/4, which gamma 2 shows as half brightness
+	if got, want := fb.ToneMapped(Clamp, 2).RGBAAt(0, 0), (color.RGBA{R: 128, G: 128, B: 128, A: 255}); got != want {
+		t.Errorf("Exposure +2 gave %v, want %v", got, want)
+	}
+	if got, want := fb.ToneMapped(Clamp, 0), fb.Image(); got.RGBAAt(0, 0) != want.RGBAAt(0, 0) {
+		t.Errorf("Image() should match clamp tone mapping at exposure 0")
+	}
+}
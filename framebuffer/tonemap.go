@@ -0,0 +1,80 @@
+package framebuffer
+
+import (
+	"fmt"
+	"go-tracer/src/vec3"
+	"image"
+	"image/color"
+	"math"
+)
+
+// How radiance outside [0, 1] is squeezed into the displayable range
+type ToneMapper int
+
+const (
+	Clamp    ToneMapper = iota // cut off at 1, losing highlight detail
+	Reinhard                   // L / (1 + L) on luminance, which keeps hues
+	ACES                       // filmic curve fitted to the ACES reference transform
+)
+
+func (t ToneMapper) String() string {
+	switch t {
+	case Clamp:
+		return "clamp"
+	case Reinhard:
+		return "reinhard"
+	case ACES:
+		return "aces"
+	}
+	return fmt.Sprintf("ToneMapper(%d)", int(t))
+}
+
+func ParseToneMapper(name string) (ToneMapper, error) {
+	for _, t := range []ToneMapper{Clamp, Reinhard, ACES} {
+		if name == t.String() {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown tone mapper %q (want clamp, reinhard or aces)", name)
+}
+
+// Map a linear radiance to a linear display color, with channels in [0, 1]
+func (t ToneMapper) Map(c vec3.Vec3) vec3.Vec3 {
+	switch t {
+	case Reinhard:
+		l := 0.2126*c.X + 0.7152*c.Y + 0.0722*c.Z
+		if l <= 0 {
+			return vec3.Vec3{X: 0, Y: 0, Z: 0}
+		}
+		mapped := *c.MultiplyFloat(1 / (1 + l))
+		return vec3.Vec3{X: math.Min(mapped.X, 1), Y: math.Min(mapped.Y, 1), Z: math.Min(mapped.Z, 1)}
+	case ACES:
+		return vec3.Vec3{X: acesFilmic(c.X), Y: acesFilmic(c.Y), Z: acesFilmic(c.Z)}
+	}
+	return vec3.Vec3{X: clamp01(c.X), Y: clamp01(c.Y), Z: clamp01(c.Z)}
+}
+
+// Krzysztof Narkowicz's fit of the ACES filmic curve
+func acesFilmic(x float64) float64 {
+	x = math.Max(x, 0)
+	return clamp01((x * (2.51*x + 0.03)) / (x*(2.43*x+0.59) + 0.14))
+}
+
+func clamp01(x float64) float64 {
+	return math.Max(0, math.Min(x, 1))
+}
+
+// Convert to an 8-bit image for display: scale by 2^exposure (in stops), tone
+// map, then gamma correct
+func (fb *Framebuffer) ToneMapped(t ToneMapper, exposure float64) *image.RGBA {
+	scale := math.Exp2(exposure)
+	img := image.NewRGBA(image.Rect(0, 0, fb.Width, fb.Height))
+	for j := 0; j < fb.Height; j++ {
+		for i := 0; i < fb.Width; i++ {
+			mapped := t.Map(*fb.At(i, j).MultiplyFloat(scale))
+			r, g, b := mapped.RGB(1)
+			img.SetRGBA(i, j, color.RGBA{R: uint8(r), G: uint8(g), B: uint8(b), A: 255})
+		}
+	}
+	return img
+}
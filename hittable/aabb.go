@@ -0,0 +1,115 @@
+package hittable
+
+import (
+	"go-tracer/src/interval"
+	"go-tracer/src/vec3"
+	"math"
+)
+
+// Axis-aligned bounding box, stored as one interval per axis
+type AABB struct {
+	X, Y, Z interval.Interval
+}
+
+var EmptyAABB AABB = AABB{X: interval.EmptyInterval, Y: interval.EmptyInterval, Z: interval.EmptyInterval}
+
+// Minimum thickness along any axis, so flat shapes still have a volume to hit
+const aabbPadding = 0.0001
+
+func NewAABB(x, y, z interval.Interval) AABB {
+	box := AABB{X: x, Y: y, Z: z}
+	box.padToMinimums()
+	return box
+}
+
+// Treat a and b as extrema of the box, in any order
+func NewAABBFromPoints(a, b vec3.Point3) AABB {
+	return NewAABB(
+		interval.Interval{Min: math.Min(a.X, b.X), Max: math.Max(a.X, b.X)},
+		interval.Interval{Min: math.Min(a.Y, b.Y), Max: math.Max(a.Y, b.Y)},
+		interval.Interval{Min: math.Min(a.Z, b.Z), Max: math.Max(a.Z, b.Z)},
+	)
+}
+
+func EnclosingAABB(a, b AABB) AABB {
+	return AABB{
+		X: interval.Enclosing(a.X, b.X),
+		Y: interval.Enclosing(a.Y, b.Y),
+		Z: interval.Enclosing(a.Z, b.Z),
+	}
+}
+
+func (box *AABB) padToMinimums() {
+	if box.X.Size() < aabbPadding {
+		box.X = box.X.Expand(aabbPadding)
+	}
+	if box.Y.Size() < aabbPadding {
+		box.Y = box.Y.Expand(aabbPadding)
+	}
+	if box.Z.Size() < aabbPadding {
+		box.Z = box.Z.Expand(aabbPadding)
+	}
+}
+
+func (box AABB) AxisInterval(n int) interval.Interval {
+	if n == 1 {
+		return box.Y
+	}
+	if n == 2 {
+		return box.Z
+	}
+	return box.X
+}
+
+func (box AABB) LongestAxis() int {
+	if box.X.Size() > box.Y.Size() {
+		if box.X.Size() > box.Z.Size() {
+			return 0
+		}
+		return 2
+	}
+	if box.Y.Size() > box.Z.Size() {
+		return 1
+	}
+	return 2
+}
+
+func (box AABB) Centroid(axis int) float64 {
+	ax := box.AxisInterval(axis)
+	return 0.5 * (ax.Min + ax.Max)
+}
+
+// Slab test: the ray hits the box if its overlap with every axis slab is non-empty
+func (box AABB) Hit(r *vec3.Ray, ray_t interval.Interval) bool {
+	origin := r.GetOrigin()
+	direction := r.GetDirection()
+
+	for axis := 0; axis < 3; axis++ {
+		ax := box.AxisInterval(axis)
+		adinv := 1.0 / direction.IndexAt(axis)
+
+		t0 := (ax.Min - origin.IndexAt(axis)) * adinv
+		t1 := (ax.Max - origin.IndexAt(axis)) * adinv
+
+		if t0 < t1 {
+			if t0 > ray_t.Min {
+				ray_t.Min = t0
+			}
+			if t1 < ray_t.Max {
+				ray_t.Max = t1
+			}
+		} else {
+			if t1 > ray_t.Min {
+				ray_t.Min = t1
+			}
+			if t0 < ray_t.Max {
+				ray_t.Max = t0
+			}
+		}
+
+		if ray_t.Max <= ray_t.Min {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,40 @@
+package hittable
+
+import (
+	"go-tracer/src/interval"
+	"go-tracer/src/vec3"
+	"math"
+)
+
+// Axis-aligned box made of six quads, all facing outwards
+type Box struct {
+	Min, Max vec3.Point3
+	Sides    HittableList
+}
+
+// Box with opposite corners a and b, in any order
+func NewBox(a, b vec3.Point3, mat Material) Box {
+	min := vec3.Point3{X: math.Min(a.X, b.X), Y: math.Min(a.Y, b.Y), Z: math.Min(a.Z, b.Z)}
+	max := vec3.Point3{X: math.Max(a.X, b.X), Y: math.Max(a.Y, b.Y), Z: math.Max(a.Z, b.Z)}
+
+	dx := vec3.Vec3{X: max.X - min.X, Y: 0, Z: 0}
+	dy := vec3.Vec3{X: 0, Y: max.Y - min.Y, Z: 0}
+	dz := vec3.Vec3{X: 0, Y: 0, Z: max.Z - min.Z}
+
+	box := Box{Min: min, Max: max}
+	box.Sides.Append(Quad{Q: vec3.Point3{X: min.X, Y: min.Y, Z: max.Z}, U: dx, V: dy, Mat: mat})          // front
+	box.Sides.Append(Quad{Q: vec3.Point3{X: max.X, Y: min.Y, Z: max.Z}, U: dz.Negate(), V: dy, Mat: mat}) // right
+	box.Sides.Append(Quad{Q: vec3.Point3{X: max.X, Y: min.Y, Z: min.Z}, U: dx.Negate(), V: dy, Mat: mat}) // back
+	box.Sides.Append(Quad{Q: vec3.Point3{X: min.X, Y: min.Y, Z: min.Z}, U: dz, V: dy, Mat: mat})          // left
+	box.Sides.Append(Quad{Q: vec3.Point3{X: min.X, Y: max.Y, Z: max.Z}, U: dx, V: dz.Negate(), Mat: mat}) // top
+	box.Sides.Append(Quad{Q: vec3.Point3{X: min.X, Y: min.Y, Z: min.Z}, U: dx, V: dz, Mat: mat})          // bottom
+	return box
+}
+
+func (b Box) Hit(r *vec3.Ray, ray_t interval.Interval, rec *HitRecord) bool {
+	return b.Sides.Hit(r, ray_t, rec)
+}
+
+func (b Box) BoundingBox() AABB {
+	return NewAABBFromPoints(b.Min, b.Max)
+}
@@ -0,0 +1,77 @@
+package hittable
+
+import (
+	"go-tracer/src/interval"
+	"go-tracer/src/vec3"
+	"sort"
+)
+
+// Bounding volume hierarchy over a set of hittables. Each node splits its
+// objects in half along the longest axis of their combined bounding box, so a
+// ray only visits the subtrees whose boxes it actually passes through.
+type BVHNode struct {
+	Left  Hittable
+	Right Hittable
+	Bbox  AABB
+}
+
+// Build a BVH from the objects of a list. The list itself is left untouched.
+func NewBVH(list HittableList) *BVHNode {
+	objects := make([]Hittable, len(list.Objects))
+	copy(objects, list.Objects)
+	return newBVHNode(objects)
+}
+
+func newBVHNode(objects []Hittable) *BVHNode {
+	node := &BVHNode{Bbox: EmptyAABB}
+	for _, object := range objects {
+		node.Bbox = EnclosingAABB(node.Bbox, object.BoundingBox())
+	}
+
+	switch len(objects) {
+	case 0:
+		node.Left = HittableList{}
+		node.Right = HittableList{}
+		return node
+	case 1:
+		// Hit each object once: volumes would otherwise get two tries to scatter
+		node.Left = objects[0]
+		node.Right = HittableList{}
+		return node
+	case 2:
+		node.Left = objects[0]
+		node.Right = objects[1]
+		return node
+	}
+
+	// Sort by box centroid rather than the box minimum, so that huge objects
+	// (e.g. a ground sphere) don't drag their neighbours to one side
+	axis := node.Bbox.LongestAxis()
+	sort.Slice(objects, func(a, b int) bool {
+		return objects[a].BoundingBox().Centroid(axis) < objects[b].BoundingBox().Centroid(axis)
+	})
+
+	mid := len(objects) / 2
+	node.Left = newBVHNode(objects[:mid])
+	node.Right = newBVHNode(objects[mid:])
+	return node
+}
+
+func (n *BVHNode) Hit(r *vec3.Ray, ray_t interval.Interval, rec *HitRecord) bool {
+	if !n.Bbox.Hit(r, ray_t) {
+		return false
+	}
+
+	hitLeft := n.Left.Hit(r, ray_t, rec)
+	closestSoFar := ray_t.Max
+	if hitLeft {
+		closestSoFar = rec.T
+	}
+	hitRight := n.Right.Hit(r, interval.Interval{Min: ray_t.Min, Max: closestSoFar}, rec)
+
+	return hitLeft || hitRight
+}
+
+func (n *BVHNode) BoundingBox() AABB {
+	return n.Bbox
+}
@@ -0,0 +1,195 @@
+package hittable
+
+import (
+	"go-tracer/src/interval"
+	"go-tracer/src/utils"
+	"go-tracer/src/vec3"
+	"log"
+	"math"
+	"sync"
+)
+
+// Stretch of a ray inside a solid, between the boundary hits where it enters
+// and leaves
+type Span struct {
+	In, Out HitRecord
+}
+
+// Closed objects that can list every span of a ray's line (not just the part
+// in front of its origin) that lies inside them, sorted by T
+type Solid interface {
+	Hittable
+	Spans(r *vec3.Ray) []Span
+}
+
+type CSGOp int
+
+const (
+	CSGUnion CSGOp = iota
+	CSGIntersection
+	CSGDifference // A with B cut out of it
+)
+
+// Whether a point inside/outside each operand is inside the result
+func (op CSGOp) contains(inA, inB bool) bool {
+	switch op {
+	case CSGIntersection:
+		return inA && inB
+	case CSGDifference:
+		return inA && !inB
+	}
+	return inA || inB
+}
+
+// Constructive solid geometry: two closed objects combined by a boolean
+// operation. Surfaces keep the material of the operand they came from, so the
+// walls of a hole cut by B use B's material.
+type CSG struct {
+	Op   CSGOp
+	A, B Hittable
+}
+
+func (c CSG) Hit(r *vec3.Ray, ray_t interval.Interval, rec *HitRecord) bool {
+	for _, span := range c.spans(r, ray_t.Max) {
+		if span.In.T >= ray_t.Max {
+			break
+		}
+		if ray_t.Surrounds(span.In.T) {
+			*rec = span.In
+			return true
+		}
+		if ray_t.Surrounds(span.Out.T) {
+			*rec = span.Out
+			return true
+		}
+	}
+	return false
+}
+
+func (c CSG) BoundingBox() AABB {
+	a := c.A.BoundingBox()
+	switch c.Op {
+	case CSGIntersection:
+		b := c.B.BoundingBox()
+		return AABB{X: overlap(a.X, b.X), Y: overlap(a.Y, b.Y), Z: overlap(a.Z, b.Z)}
+	case CSGDifference:
+		return a
+	}
+	return EnclosingAABB(a, c.B.BoundingBox())
+}
+
+func overlap(a, b interval.Interval) interval.Interval {
+	return interval.Interval{Min: math.Max(a.Min, b.Min), Max: math.Min(a.Max, b.Max)}
+}
+
+func (c CSG) Spans(r *vec3.Ray) []Span {
+	return c.spans(r, utils.INFINITY)
+}
+
+// Sweep along the ray through the boundaries of both operands, starting a
+// span wherever the result goes from outside to inside and ending it on the
+// way back out. The sweep stops at the first span starting after limit, so
+// only spans starting before it are sure to be complete.
+func (c CSG) spans(r *vec3.Ray, limit float64) []Span {
+	a := solidSpans(c.A, r, limit)
+	b := solidSpans(c.B, r, limit)
+
+	var result []Span
+	var current Span
+	inA, inB, inside := false, false, false
+	i, j := 0, 0
+	for i < 2*len(a) || j < 2*len(b) {
+		var rec HitRecord
+		if j >= 2*len(b) || (i < 2*len(a) && spanBoundary(a, i).T <= spanBoundary(b, j).T) {
+			rec = spanBoundary(a, i)
+			inA = i%2 == 0
+			i++
+		} else {
+			rec = spanBoundary(b, j)
+			inB = j%2 == 0
+			j++
+		}
+
+		now := c.Op.contains(inA, inB)
+		if now && !inside {
+			if rec.T > limit {
+				break
+			}
+			current.In = rec
+			current.In.FrontFace = true
+		} else if !now && inside {
+			current.Out = rec
+			current.Out.FrontFace = false
+			result = append(result, current)
+		}
+		inside = now
+	}
+	return result
+}
+
+// The k-th boundary of a list of spans: In of span k/2 for even k, Out for odd
+func spanBoundary(spans []Span, k int) HitRecord {
+	if k%2 == 0 {
+		return spans[k/2].In
+	}
+	return spans[k/2].Out
+}
+
+// More boundaries than this along one ray are assumed to be a mesh that isn't
+// closed, and the rest are ignored
+const maxBoundaryHits = 64
+
+// Logs, once, that an operand had more than maxBoundaryHits boundaries, as
+// parts of the result will be missing
+var warnTooManyBoundaries sync.Once
+
+// Spans of any closed hittable, found by walking its surface hits along the
+// whole line of the ray, up to the first span starting after limit.
+// Front-face hits enter the object and back-face hits leave it; counting
+// depth keeps touching parts (e.g. the faces of a box meeting at an edge)
+// from splitting a span.
+func solidSpans(h Hittable, r *vec3.Ray, limit float64) []Span {
+	if c, ok := h.(CSG); ok {
+		return c.spans(r, limit)
+	}
+	if s, ok := h.(Solid); ok {
+		return s.Spans(r)
+	}
+
+	var spans []Span
+	var current Span
+	depth := 0
+	t_min := -utils.INFINITY
+	for n := 0; ; n++ {
+		if n == maxBoundaryHits {
+			warnTooManyBoundaries.Do(func() {
+				log.Printf("CSG operand has more than %d boundaries along a ray, ignoring the rest; is it a closed object?", maxBoundaryHits)
+			})
+			break
+		}
+		var rec HitRecord
+		if !h.Hit(r, interval.Interval{Min: t_min, Max: utils.INFINITY}, &rec) {
+			break
+		}
+		// Step past this hit so surfaces that include their boundary
+		// (e.g. quads) aren't found again
+		t_min = rec.T + 1e-9*math.Max(1, math.Abs(rec.T))
+
+		if rec.FrontFace {
+			if depth == 0 && rec.T > limit {
+				break
+			}
+			depth++
+			if depth == 1 {
+				current.In = rec
+			}
+		} else if depth > 0 {
+			depth--
+			if depth == 0 {
+				current.Out = rec
+				spans = append(spans, current)
+			}
+		}
+	}
+	return spans
+}
@@ -0,0 +1,185 @@
+package hittable
+
+import (
+	"go-tracer/src/interval"
+	"go-tracer/src/vec3"
+	"math"
+)
+
+// Finite cylinder from the centre of its base to the centre of its top. The
+// ends are closed by flat caps unless Open is set.
+type Cylinder struct {
+	Base, Top vec3.Point3
+	Radius    float64
+	Open      bool
+	Mat       Material
+}
+
+// Coordinates with the base at the origin and the axis along +Z, in which
+// cylinders and cones are simple quadrics
+type axisFrame struct {
+	base   vec3.Point3
+	onb    vec3.ONB
+	height float64
+}
+
+func newAxisFrame(base, top vec3.Point3) axisFrame {
+	axis := *top.Subtract(base)
+	return axisFrame{base: base, onb: vec3.NewONB(axis), height: axis.Length()}
+}
+
+func (f axisFrame) toLocal(r *vec3.Ray) (vec3.Vec3, vec3.Vec3) {
+	o := *r.GetOrigin().Subtract(f.base)
+	d := r.GetDirection()
+	return vec3.Vec3{X: o.Dot(f.onb.U), Y: o.Dot(f.onb.V), Z: o.Dot(f.onb.W)},
+		vec3.Vec3{X: d.Dot(f.onb.U), Y: d.Dot(f.onb.V), Z: d.Dot(f.onb.W)}
+}
+
+// Closest hit of a local-space ray with a cap of the given radius at height z,
+// if it is nearer than ray_t.Max
+func (f axisFrame) capHit(o, d vec3.Vec3, z, radius float64, ray_t interval.Interval) (float64, vec3.Vec3, bool) {
+	if math.Abs(d.Z) < 1e-12 {
+		return 0, vec3.Vec3{}, false
+	}
+	t := (z - o.Z) / d.Z
+	if !ray_t.Surrounds(t) {
+		return 0, vec3.Vec3{}, false
+	}
+	p := o.Add(*d.MultiplyFloat(t))
+	if p.X*p.X+p.Y*p.Y > radius*radius {
+		return 0, vec3.Vec3{}, false
+	}
+	return t, p, true
+}
+
+// Fill in rec from a hit found in local space
+func (f axisFrame) setHit(r *vec3.Ray, t float64, local_normal vec3.Vec3, u, v float64, mat Material, rec *HitRecord) {
+	outward_normal := *f.onb.Transform(local_normal).UnitVector()
+	(*rec).T = t
+	(*rec).P = r.At(t)
+	(*rec).U = u
+	(*rec).V = v
+	(*rec).Mat = mat
+	(*rec).SetFaceNormal(r, &outward_normal)
+}
+
+// Angle around the axis, as a texture coordinate in [0, 1]
+func aroundAxis(p vec3.Vec3) float64 {
+	return (math.Atan2(p.Y, p.X) + math.Pi) / (2 * math.Pi)
+}
+
+func (c Cylinder) Hit(r *vec3.Ray, ray_t interval.Interval, rec *HitRecord) bool {
+	frame := newAxisFrame(c.Base, c.Top)
+	o, d := frame.toLocal(r)
+	hit := false
+
+	// Side: x^2 + y^2 = R^2 for 0 <= z <= height
+	a := d.X*d.X + d.Y*d.Y
+	if a > 1e-12 {
+		half_b := o.X*d.X + o.Y*d.Y
+		c_term := o.X*o.X + o.Y*o.Y - c.Radius*c.Radius
+		discriminant := half_b*half_b - a*c_term
+		if discriminant >= 0 {
+			sqrtd := math.Sqrt(discriminant)
+			for _, t := range [2]float64{(-half_b - sqrtd) / a, (-half_b + sqrtd) / a} {
+				if !ray_t.Surrounds(t) {
+					continue
+				}
+				p := o.Add(*d.MultiplyFloat(t))
+				if p.Z < 0 || p.Z > frame.height {
+					continue
+				}
+				frame.setHit(r, t, vec3.Vec3{X: p.X, Y: p.Y, Z: 0}, aroundAxis(p), p.Z/frame.height, c.Mat, rec)
+				ray_t.Max = t
+				hit = true
+				break
+			}
+		}
+	}
+
+	if c.Open {
+		return hit
+	}
+	for _, end := range [2]struct{ z, normal float64 }{{0, -1}, {frame.height, 1}} {
+		if t, p, ok := frame.capHit(o, d, end.z, c.Radius, ray_t); ok {
+			radial := math.Sqrt(p.X*p.X+p.Y*p.Y) / c.Radius
+			frame.setHit(r, t, vec3.Vec3{X: 0, Y: 0, Z: end.normal}, aroundAxis(p), radial, c.Mat, rec)
+			ray_t.Max = t
+			hit = true
+		}
+	}
+	return hit
+}
+
+func (c Cylinder) BoundingBox() AABB {
+	axis := *c.Top.Subtract(c.Base).UnitVector()
+	return EnclosingAABB(diskAABB(c.Base, axis, c.Radius), diskAABB(c.Top, axis, c.Radius))
+}
+
+// Finite cone with a circular base of Radius narrowing to a point at Apex. The
+// base is closed by a flat cap unless Open is set.
+type Cone struct {
+	Base, Apex vec3.Point3
+	Radius     float64
+	Open       bool
+	Mat        Material
+}
+
+func (c Cone) Hit(r *vec3.Ray, ray_t interval.Interval, rec *HitRecord) bool {
+	frame := newAxisFrame(c.Base, c.Apex)
+	o, d := frame.toLocal(r)
+	hit := false
+
+	// Side: x^2 + y^2 = (R - k z)^2 for 0 <= z <= height, where k = R / height
+	k := c.Radius / frame.height
+	ro := c.Radius - k*o.Z
+	a := d.X*d.X + d.Y*d.Y - k*k*d.Z*d.Z
+	half_b := o.X*d.X + o.Y*d.Y + k*d.Z*ro
+	c_term := o.X*o.X + o.Y*o.Y - ro*ro
+
+	var roots []float64
+	if math.Abs(a) < 1e-12 {
+		// Ray parallel to the slope: the quadratic becomes linear
+		if math.Abs(half_b) > 1e-12 {
+			roots = []float64{-c_term / (2 * half_b)}
+		}
+	} else if discriminant := half_b*half_b - a*c_term; discriminant >= 0 {
+		sqrtd := math.Sqrt(discriminant)
+		t0, t1 := (-half_b-sqrtd)/a, (-half_b+sqrtd)/a
+		roots = []float64{math.Min(t0, t1), math.Max(t0, t1)}
+	}
+	for _, t := range roots {
+		if !ray_t.Surrounds(t) {
+			continue
+		}
+		p := o.Add(*d.MultiplyFloat(t))
+		if p.Z < 0 || p.Z > frame.height {
+			continue
+		}
+		// The gradient of the surface, scaled so the radial part is a unit vector
+		radial := math.Sqrt(p.X*p.X + p.Y*p.Y)
+		if radial == 0 {
+			continue // the apex itself has no well-defined normal
+		}
+		normal := vec3.Vec3{X: p.X / radial, Y: p.Y / radial, Z: k}
+		frame.setHit(r, t, normal, aroundAxis(p), p.Z/frame.height, c.Mat, rec)
+		ray_t.Max = t
+		hit = true
+		break
+	}
+
+	if c.Open {
+		return hit
+	}
+	if t, p, ok := frame.capHit(o, d, 0, c.Radius, ray_t); ok {
+		radial := math.Sqrt(p.X*p.X+p.Y*p.Y) / c.Radius
+		frame.setHit(r, t, vec3.Vec3{X: 0, Y: 0, Z: -1}, aroundAxis(p), radial, c.Mat, rec)
+		hit = true
+	}
+	return hit
+}
+
+func (c Cone) BoundingBox() AABB {
+	axis := *c.Apex.Subtract(c.Base).UnitVector()
+	return EnclosingAABB(diskAABB(c.Base, axis, c.Radius), NewAABBFromPoints(c.Apex, c.Apex))
+}
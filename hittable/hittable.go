@@ -2,41 +2,110 @@ package hittable
 
 import (
 	"go-tracer/src/interval"
+	"go-tracer/src/texture"
 	"go-tracer/src/utils"
 	"go-tracer/src/vec3"
 	"math"
 )
 
 type Material interface {
-	Scatter(r_in *vec3.Ray, rec *HitRecord, attenuation *vec3.Vec3, scattered *vec3.Ray) bool
+	// Describe how an incoming ray scatters, or return false if it is absorbed
+	Scatter(r_in *vec3.Ray, rec *HitRecord, srec *ScatterRecord, rnd utils.Random) bool
+	// Density with which the material scatters r_in into the direction of scattered
+	ScatteringPDF(r_in *vec3.Ray, rec *HitRecord, scattered *vec3.Ray) float64
+	// Light given off at the hit point, black for anything that isn't a light
+	Emitted(r_in *vec3.Ray, rec *HitRecord) vec3.Vec3
+}
+
+// Implemented by materials whose reflectance depends on both directions, so
+// it can't be split into a constant Attenuation times ScatteringPDF. The camera
+// uses Eval in place of that product.
+type BSDF interface {
+	// Reflectance times the cosine at the surface, for light arriving along
+	// scattered and leaving back along r_in
+	Eval(r_in *vec3.Ray, rec *HitRecord, scattered *vec3.Ray) vec3.Vec3
+}
+
+// Result of Material.Scatter. Diffuse materials fill in PDF, so the camera can
+// mix it with light sampling. Specular ones can't be importance sampled that
+// way; they set SkipPDF and give the single outgoing ray in SkipPDFRay.
+type ScatterRecord struct {
+	Attenuation vec3.Vec3
+	PDF         PDF
+	SkipPDF     bool
+	SkipPDFRay  vec3.Ray
 }
 
 type Lambertian struct {
 	Albedo vec3.Vec3
+	Tex    texture.Texture // if set, used instead of Albedo
 }
 
-func (l Lambertian) Scatter(r_in *vec3.Ray, rec *HitRecord, attenuation *vec3.Vec3, scattered *vec3.Ray) bool {
-	scatter_direction := rec.Normal.Add(*rec.Normal.RandomUnitVector())
-	if scatter_direction.NearZero() {
-		scatter_direction = rec.Normal
-	}
-
-	(*scattered) = vec3.Ray{Origin: rec.P, Direction: scatter_direction}
-	(*attenuation) = l.Albedo
+func (l Lambertian) Scatter(r_in *vec3.Ray, rec *HitRecord, srec *ScatterRecord, rnd utils.Random) bool {
+	(*srec).Attenuation = albedoAt(l.Albedo, l.Tex, rec)
+	(*srec).PDF = NewCosinePDF(rec.Normal)
+	(*srec).SkipPDF = false
 	return true
 }
 
+func (l Lambertian) ScatteringPDF(r_in *vec3.Ray, rec *HitRecord, scattered *vec3.Ray) float64 {
+	cos_theta := rec.Normal.Dot(*scattered.GetDirection().UnitVector())
+	return math.Max(0, cos_theta/math.Pi)
+}
+
+func (l Lambertian) Emitted(r_in *vec3.Ray, rec *HitRecord) vec3.Vec3 {
+	return vec3.Vec3{X: 0, Y: 0, Z: 0}
+}
+
 type Metal struct {
 	Albedo vec3.Vec3
+	Tex    texture.Texture // if set, used instead of Albedo
 	Fuzz   float64
 }
 
-func (m Metal) Scatter(r_in *vec3.Ray, rec *HitRecord, attenuation *vec3.Vec3, scattered *vec3.Ray) bool {
+func (m Metal) Scatter(r_in *vec3.Ray, rec *HitRecord, srec *ScatterRecord, rnd utils.Random) bool {
 	m.Fuzz = math.Min(m.Fuzz, 1.0)
 	reflected := r_in.GetDirection().UnitVector().Reflect(&rec.Normal)
-	(*scattered) = vec3.Ray{Origin: rec.P, Direction: reflected.Add(*r_in.Direction.RandomUnitVector().MultiplyFloat(m.Fuzz))}
-	(*attenuation) = m.Albedo
-	return (*scattered).GetDirection().Dot(rec.Normal) > 0
+	(*srec).Attenuation = albedoAt(m.Albedo, m.Tex, rec)
+	(*srec).PDF = nil
+	(*srec).SkipPDF = true
+	(*srec).SkipPDFRay = vec3.Ray{Origin: rec.P, Direction: reflected.Add(*r_in.Direction.RandomUnitVector(rnd).MultiplyFloat(m.Fuzz)), Time: r_in.Time}
+	return srec.SkipPDFRay.GetDirection().Dot(rec.Normal) > 0
+}
+
+func (m Metal) ScatteringPDF(r_in *vec3.Ray, rec *HitRecord, scattered *vec3.Ray) float64 {
+	return 0
+}
+
+func (m Metal) Emitted(r_in *vec3.Ray, rec *HitRecord) vec3.Vec3 {
+	return vec3.Vec3{X: 0, Y: 0, Z: 0}
+}
+
+func albedoAt(albedo vec3.Vec3, tex texture.Texture, rec *HitRecord) vec3.Vec3 {
+	if tex != nil {
+		return tex.Value(rec.U, rec.V, rec.P)
+	}
+	return albedo
+}
+
+// Color of the surface at rec before any lighting, as wanted by denoisers: the
+// albedo of diffuse and metallic materials, white for clear glass, and the
+// emission clamped to 1 for lights. Unknown materials count as white.
+func SurfaceAlbedo(rec *HitRecord) vec3.Vec3 {
+	switch m := UntagMaterial(rec.Mat).(type) {
+	case Lambertian:
+		return albedoAt(m.Albedo, m.Tex, rec)
+	case Metal:
+		return albedoAt(m.Albedo, m.Tex, rec)
+	case Isotropic:
+		return albedoAt(m.Albedo, m.Tex, rec)
+	case Principled:
+		return albedoAt(m.BaseColor, m.Tex, rec)
+	case DiffuseLight:
+		emit := albedoAt(m.Emit, m.Tex, rec)
+		return vec3.Vec3{X: math.Min(emit.X, 1), Y: math.Min(emit.Y, 1), Z: math.Min(emit.Z, 1)}
+	}
+	return vec3.Vec3{X: 1, Y: 1, Z: 1}
 }
 
 type Dielectric struct {
@@ -50,8 +119,10 @@ func Reflectance(cosine, ref_idx float64) float64 {
 	return r0 + (1-r0)*math.Pow((1-cosine), 5)
 }
 
-func (d Dielectric) Scatter(r_in *vec3.Ray, rec *HitRecord, attenuation *vec3.Vec3, scattered *vec3.Ray) bool {
-	(*attenuation) = vec3.Vec3{X: 1.0, Y: 1.0, Z: 1.0}
+func (d Dielectric) Scatter(r_in *vec3.Ray, rec *HitRecord, srec *ScatterRecord, rnd utils.Random) bool {
+	(*srec).Attenuation = vec3.Vec3{X: 1.0, Y: 1.0, Z: 1.0}
+	(*srec).PDF = nil
+	(*srec).SkipPDF = true
 	refraction_ratio := 0.0
 	if rec.FrontFace {
 		refraction_ratio = 1.0 / d.Ir
@@ -65,25 +136,80 @@ func (d Dielectric) Scatter(r_in *vec3.Ray, rec *HitRecord, attenuation *vec3.Ve
 
 	cannot_refract := refraction_ratio*sin_theta > 1.0
 	var direction vec3.Vec3
-	if cannot_refract || Reflectance(cos_theta, refraction_ratio) > utils.RandomDouble() {
+	if cannot_refract || Reflectance(cos_theta, refraction_ratio) > rnd.Float64() {
 		direction = unit_direction.Reflect(&rec.Normal)
 	} else {
 		direction = unit_direction.Refract(unit_direction, &rec.Normal, refraction_ratio)
 	}
-	(*scattered) = vec3.Ray{Origin: rec.P, Direction: direction}
+	(*srec).SkipPDFRay = vec3.Ray{Origin: rec.P, Direction: direction, Time: r_in.Time}
+	return true
+}
+
+func (d Dielectric) ScatteringPDF(r_in *vec3.Ray, rec *HitRecord, scattered *vec3.Ray) float64 {
+	return 0
+}
+
+func (d Dielectric) Emitted(r_in *vec3.Ray, rec *HitRecord) vec3.Vec3 {
+	return vec3.Vec3{X: 0, Y: 0, Z: 0}
+}
+
+// Emits light and absorbs everything that hits it. Only the front face emits
+// unless TwoSided is set, so an area light facing down doesn't light the ceiling.
+type DiffuseLight struct {
+	Emit     vec3.Vec3
+	Tex      texture.Texture // if set, used instead of Emit
+	TwoSided bool
+}
+
+func (dl DiffuseLight) Scatter(r_in *vec3.Ray, rec *HitRecord, srec *ScatterRecord, rnd utils.Random) bool {
+	return false
+}
+
+func (dl DiffuseLight) ScatteringPDF(r_in *vec3.Ray, rec *HitRecord, scattered *vec3.Ray) float64 {
+	return 0
+}
+
+func (dl DiffuseLight) Emitted(r_in *vec3.Ray, rec *HitRecord) vec3.Vec3 {
+	if !rec.FrontFace && !dl.TwoSided {
+		return vec3.Vec3{X: 0, Y: 0, Z: 0}
+	}
+	return albedoAt(dl.Emit, dl.Tex, rec)
+}
+
+// Scatters uniformly in every direction, the phase function of fog and smoke
+type Isotropic struct {
+	Albedo vec3.Vec3
+	Tex    texture.Texture // if set, used instead of Albedo
+}
+
+func (iso Isotropic) Scatter(r_in *vec3.Ray, rec *HitRecord, srec *ScatterRecord, rnd utils.Random) bool {
+	(*srec).Attenuation = albedoAt(iso.Albedo, iso.Tex, rec)
+	(*srec).PDF = SpherePDF{}
+	(*srec).SkipPDF = false
 	return true
 }
 
+func (iso Isotropic) ScatteringPDF(r_in *vec3.Ray, rec *HitRecord, scattered *vec3.Ray) float64 {
+	return 1 / (4 * math.Pi)
+}
+
+func (iso Isotropic) Emitted(r_in *vec3.Ray, rec *HitRecord) vec3.Vec3 {
+	return vec3.Vec3{X: 0, Y: 0, Z: 0}
+}
+
 type HitRecord struct {
 	P         vec3.Point3
 	Normal    vec3.Vec3
 	Mat       Material
 	T         float64
+	U, V      float64 // surface coordinates of the hit point
 	FrontFace bool
+	ObjectID  int // set by a Tagged wrapper, 0 for untagged objects
 }
 
 type Hittable interface {
 	Hit(r *vec3.Ray, ray_t interval.Interval, rec *HitRecord) bool
+	BoundingBox() AABB
 }
 
 type HittableList struct {
@@ -116,6 +242,54 @@ func (hl HittableList) Hit(r *vec3.Ray, ray_t interval.Interval, rec *HitRecord)
 	return hitAnything
 }
 
+func (hl HittableList) BoundingBox() AABB {
+	bbox := EmptyAABB
+	for _, object := range hl.Objects {
+		bbox = EnclosingAABB(bbox, object.BoundingBox())
+	}
+	return bbox
+}
+
+// Sampling a list picks one of its sampleable objects at random, so the
+// density is the average of theirs
+func (hl HittableList) PDFValue(origin vec3.Point3, direction vec3.Vec3) float64 {
+	count := 0
+	sum := 0.0
+	for _, object := range hl.Objects {
+		if light, ok := object.(Sampleable); ok {
+			count++
+			sum += light.PDFValue(origin, direction)
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return sum / float64(count)
+}
+
+func (hl HittableList) Random(origin vec3.Point3, rnd utils.Random) vec3.Vec3 {
+	count := 0
+	for _, object := range hl.Objects {
+		if _, ok := object.(Sampleable); ok {
+			count++
+		}
+	}
+	if count == 0 {
+		return vec3.Vec3{X: 1, Y: 0, Z: 0}
+	}
+	// Walk to the chosen one rather than collecting them, this runs every bounce
+	pick := int(rnd.Float64()*float64(count)) % count
+	for _, object := range hl.Objects {
+		if light, ok := object.(Sampleable); ok {
+			if pick == 0 {
+				return light.Random(origin, rnd)
+			}
+			pick--
+		}
+	}
+	return vec3.Vec3{X: 1, Y: 0, Z: 0}
+}
+
 // Define our shapes here
 type Sphere struct {
 	Hittable
@@ -158,7 +332,51 @@ func (s Sphere) Hit(r *vec3.Ray, ray_t interval.Interval, rec *HitRecord) bool {
 	(*rec).P = r.At(rec.T)
 	outwardNormal := *(*rec.P.Subtract(s.Center)).DivideFloat(s.Radius)
 	(*rec).SetFaceNormal(r, &outwardNormal)
+	(*rec).U, (*rec).V = sphereUV(*rec.P.Subtract(s.Center).DivideFloat(math.Abs(s.Radius)))
 	(*rec).Mat = s.Mat
 
 	return true
 }
+
+func (s Sphere) BoundingBox() AABB {
+	// Radius may be negative (hollow spheres), so size the box by its magnitude
+	rvec := vec3.Vec3{X: math.Abs(s.Radius), Y: math.Abs(s.Radius), Z: math.Abs(s.Radius)}
+	return NewAABBFromPoints(*s.Center.Subtract(rvec), s.Center.Add(rvec))
+}
+
+// Density of directions from origin sampled uniformly over the cone the sphere
+// subtends, or over all directions from inside it
+func (s Sphere) PDFValue(origin vec3.Point3, direction vec3.Vec3) float64 {
+	var rec HitRecord
+	r := vec3.Ray{Origin: origin, Direction: direction}
+	if !s.Hit(&r, interval.Interval{Min: 0.001, Max: utils.INFINITY}, &rec) {
+		return 0
+	}
+
+	distance_squared := s.Center.Subtract(origin).LengthSquared()
+	cos_theta_max := math.Sqrt(1 - s.Radius*s.Radius/distance_squared)
+	if math.IsNaN(cos_theta_max) {
+		// Origin is inside the sphere, where Random picks any direction
+		return 1 / (4 * math.Pi)
+	}
+	solid_angle := 2 * math.Pi * (1 - cos_theta_max)
+	return 1 / solid_angle
+}
+
+func (s Sphere) Random(origin vec3.Point3, rnd utils.Random) vec3.Vec3 {
+	direction := *s.Center.Subtract(origin)
+	distance_squared := direction.LengthSquared()
+	if distance_squared <= s.Radius*s.Radius {
+		return *direction.RandomUnitVector(rnd)
+	}
+	uvw := vec3.NewONB(direction)
+	return uvw.Transform(vec3.RandomToSphere(rnd, s.Radius, distance_squared))
+}
+
+// Map a point on the unit sphere to texture coordinates: u is the angle around
+// the Y axis from X=-1, v the angle from Y=-1 up to Y=+1, both scaled to [0, 1]
+func sphereUV(p vec3.Point3) (float64, float64) {
+	theta := math.Acos(-p.Y)
+	phi := math.Atan2(-p.Z, p.X) + math.Pi
+	return phi / (2 * math.Pi), theta / math.Pi
+}
@@ -1,7 +1,15 @@
 package hittable
 
 import (
+	"bytes"
+	"go-tracer/src/interval"
+	"go-tracer/src/texture"
+	"go-tracer/src/utils"
 	"go-tracer/src/vec3"
+	"log"
+	"math"
+	"math/rand"
+	"strings"
 	"testing"
 )
 
@@ -9,10 +17,9 @@ func TestLambertianScatter(t *testing.T) {
 	lambertian := Lambertian{Albedo: vec3.Vec3{X: 0.5, Y: 0.5, Z: 0.5}}
 	r_in := &vec3.Ray{}
 	rec := &HitRecord{}
-	attenuation := &vec3.Vec3{}
-	scattered := &vec3.Ray{}
+	srec := &ScatterRecord{}
 
-	result := lambertian.Scatter(r_in, rec, attenuation, scattered)
+	result := lambertian.Scatter(r_in, rec, srec, utils.GlobalRandom)
 
 	if !result {
 		t.Errorf("Expected true, but got false")
@@ -23,10 +30,9 @@ func TestMetalScatter(t *testing.T) {
 	metal := Metal{Albedo: vec3.Vec3{X: 0.7, Y: 0.7, Z: 0.7}, Fuzz: 0.1}
 	r_in := &vec3.Ray{}
 	rec := &HitRecord{}
-	attenuation := &vec3.Vec3{}
-	scattered := &vec3.Ray{}
+	srec := &ScatterRecord{}
 
-	result := metal.Scatter(r_in, rec, attenuation, scattered)
+	result := metal.Scatter(r_in, rec, srec, utils.GlobalRandom)
 
 	if result {
 		t.Errorf("Expected false, but got true")
@@ -37,12 +43,838 @@ func TestDielectricScatter(t *testing.T) {
 	dielectric := Dielectric{Ir: 1.5}
 	r_in := &vec3.Ray{}
 	rec := &HitRecord{}
-	attenuation := &vec3.Vec3{}
-	scattered := &vec3.Ray{}
+	srec := &ScatterRecord{}
 
-	result := dielectric.Scatter(r_in, rec, attenuation, scattered)
+	result := dielectric.Scatter(r_in, rec, srec, utils.GlobalRandom)
 
 	if !result {
 		t.Errorf("Expected true, but got false")
 	}
 }
+
+func TestAABBHit(t *testing.T) {
+	box := NewAABBFromPoints(vec3.Point3{X: -1, Y: -1, Z: -1}, vec3.Point3{X: 1, Y: 1, Z: 1})
+	ray_t := interval.Interval{Min: 0.001, Max: utils.INFINITY}
+
+	toward := vec3.Ray{Origin: vec3.Point3{X: 0, Y: 0, Z: 5}, Direction: vec3.Vec3{X: 0, Y: 0, Z: -1}}
+	if !box.Hit(&toward, ray_t) {
+		t.Errorf("Expected ray through the box to hit")
+	}
+
+	away := vec3.Ray{Origin: vec3.Point3{X: 0, Y: 0, Z: 5}, Direction: vec3.Vec3{X: 0, Y: 0, Z: 1}}
+	if box.Hit(&away, ray_t) {
+		t.Errorf("Expected ray pointing away from the box to miss")
+	}
+
+	beside := vec3.Ray{Origin: vec3.Point3{X: 3, Y: 0, Z: 5}, Direction: vec3.Vec3{X: 0, Y: 0, Z: -1}}
+	if box.Hit(&beside, ray_t) {
+		t.Errorf("Expected ray parallel to the box to miss")
+	}
+}
+
+func TestSphereBoundingBox(t *testing.T) {
+	hollow := Sphere{Center: vec3.Point3{X: 1, Y: 2, Z: 3}, Radius: -0.5}
+	bbox := hollow.BoundingBox()
+	if bbox.X.Min != 0.5 || bbox.X.Max != 1.5 || bbox.Z.Min != 2.5 || bbox.Z.Max != 3.5 {
+		t.Errorf("Unexpected bounding box for negative radius sphere: %+v", bbox)
+	}
+}
+
+func randomSphereWorld(rng *rand.Rand, count int) HittableList {
+	var world HittableList
+	for i := 0; i < count; i++ {
+		center := vec3.Point3{X: rng.Float64()*20 - 10, Y: rng.Float64()*20 - 10, Z: rng.Float64()*20 - 10}
+		world.Append(Sphere{Center: center, Radius: 0.1 + rng.Float64(), Mat: Lambertian{}})
+	}
+	return world
+}
+
+func TestBVHMatchesLinearList(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	world := randomSphereWorld(rng, 500)
+	bvh := NewBVH(world)
+	ray_t := interval.Interval{Min: 0.001, Max: utils.INFINITY}
+
+	hits := 0
+	for i := 0; i < 2000; i++ {
+		origin := vec3.Point3{X: rng.Float64()*30 - 15, Y: rng.Float64()*30 - 15, Z: rng.Float64()*30 - 15}
+		direction := vec3.Vec3{X: rng.Float64()*2 - 1, Y: rng.Float64()*2 - 1, Z: rng.Float64()*2 - 1}
+		r := vec3.Ray{Origin: origin, Direction: direction}
+
+		var linearRec, bvhRec HitRecord
+		linearHit := world.Hit(&r, ray_t, &linearRec)
+		bvhHit := bvh.Hit(&r, ray_t, &bvhRec)
+
+		if linearHit != bvhHit {
+			t.Fatalf("Ray %d: linear hit = %v, BVH hit = %v", i, linearHit, bvhHit)
+		}
+		if linearHit {
+			hits++
+			if linearRec.T != bvhRec.T || linearRec.P != bvhRec.P || linearRec.Normal != bvhRec.Normal {
+				t.Fatalf("Ray %d: linear hit %+v, BVH hit %+v", i, linearRec, bvhRec)
+			}
+		}
+	}
+
+	if hits == 0 {
+		t.Errorf("Expected at least some rays to hit the scene")
+	}
+}
+
+func TestBVHEmpty(t *testing.T) {
+	bvh := NewBVH(HittableList{})
+	r := vec3.Ray{Origin: vec3.Point3{}, Direction: vec3.Vec3{X: 0, Y: 0, Z: -1}}
+	var rec HitRecord
+	if bvh.Hit(&r, interval.Interval{Min: 0.001, Max: utils.INFINITY}, &rec) {
+		t.Errorf("Expected empty BVH to never be hit")
+	}
+}
+
+func TestTriangleHit(t *testing.T) {
+	tri := Triangle{
+		V0:  vec3.Point3{X: -1, Y: -1, Z: -2},
+		V1:  vec3.Point3{X: 1, Y: -1, Z: -2},
+		V2:  vec3.Point3{X: 0, Y: 1, Z: -2},
+		Mat: Lambertian{},
+	}
+	ray_t := interval.Interval{Min: 0.001, Max: utils.INFINITY}
+
+	var rec HitRecord
+	r := vec3.Ray{Origin: vec3.Point3{X: 0, Y: 0, Z: 0}, Direction: vec3.Vec3{X: 0, Y: 0, Z: -1}}
+	if !tri.Hit(&r, ray_t, &rec) {
+		t.Fatalf("Expected ray through the triangle to hit")
+	}
+	if rec.T != 2 || !rec.FrontFace || rec.Normal != (vec3.Vec3{X: 0, Y: 0, Z: 1}) {
+		t.Errorf("Unexpected hit record: %+v", rec)
+	}
+
+	miss := vec3.Ray{Origin: vec3.Point3{X: 0.9, Y: 0.9, Z: 0}, Direction: vec3.Vec3{X: 0, Y: 0, Z: -1}}
+	if tri.Hit(&miss, ray_t, &rec) {
+		t.Errorf("Expected ray outside the triangle to miss")
+	}
+
+	parallel := vec3.Ray{Origin: vec3.Point3{X: 0, Y: 0, Z: -2}, Direction: vec3.Vec3{X: 1, Y: 0, Z: 0}}
+	if tri.Hit(&parallel, ray_t, &rec) {
+		t.Errorf("Expected ray parallel to the triangle to miss")
+	}
+}
+
+func TestTriangleInterpolation(t *testing.T) {
+	tri := Triangle{
+		V0:  vec3.Point3{X: 0, Y: 0, Z: -1},
+		V1:  vec3.Point3{X: 1, Y: 0, Z: -1},
+		V2:  vec3.Point3{X: 0, Y: 1, Z: -1},
+		N0:  vec3.Vec3{X: 0, Y: 0, Z: 1},
+		N1:  vec3.Vec3{X: 1, Y: 0, Z: 1},
+		N2:  vec3.Vec3{X: 0, Y: 0, Z: 1},
+		UV0: TexCoord{U: 0, V: 0},
+		UV1: TexCoord{U: 1, V: 0},
+		UV2: TexCoord{U: 0, V: 1},
+	}
+
+	var rec HitRecord
+	r := vec3.Ray{Origin: vec3.Point3{X: 0.5, Y: 0.25, Z: 0}, Direction: vec3.Vec3{X: 0, Y: 0, Z: -1}}
+	if !tri.Hit(&r, interval.Interval{Min: 0.001, Max: utils.INFINITY}, &rec) {
+		t.Fatalf("Expected ray to hit the triangle")
+	}
+	if math.Abs(rec.U-0.5) > 1e-9 || math.Abs(rec.V-0.25) > 1e-9 {
+		t.Errorf("UV = (%v, %v), want (0.5, 0.25)", rec.U, rec.V)
+	}
+	// Halfway towards V1 the shading normal leans towards +X
+	if rec.Normal.X <= 0 || math.Abs(rec.Normal.Length()-1) > 1e-9 {
+		t.Errorf("Expected a unit shading normal leaning towards +X, got %v", rec.Normal)
+	}
+}
+
+func TestMeshMatchesTriangles(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	var triangles []Triangle
+	var list HittableList
+	for i := 0; i < 200; i++ {
+		base := vec3.Point3{X: rng.Float64()*10 - 5, Y: rng.Float64()*10 - 5, Z: rng.Float64()*10 - 5}
+		tri := Triangle{V0: base, V1: base.Add(*base.Random(rng)), V2: base.Add(*base.Random(rng)), Mat: Lambertian{}}
+		triangles = append(triangles, tri)
+		list.Append(tri)
+	}
+	mesh := NewMesh(triangles)
+	ray_t := interval.Interval{Min: 0.001, Max: utils.INFINITY}
+
+	for i := 0; i < 1000; i++ {
+		r := vec3.Ray{Origin: *vec3.Vec3{}.RandomRange(rng, -8, 8), Direction: *vec3.Vec3{}.RandomRange(rng, -1, 1)}
+		var listRec, meshRec HitRecord
+		listHit := list.Hit(&r, ray_t, &listRec)
+		meshHit := mesh.Hit(&r, ray_t, &meshRec)
+		if listHit != meshHit || (listHit && listRec.T != meshRec.T) {
+			t.Fatalf("Ray %d: list (%v, %v), mesh (%v, %v)", i, listHit, listRec.T, meshHit, meshRec.T)
+		}
+	}
+}
+
+func TestSphereUV(t *testing.T) {
+	tests := []struct {
+		p    vec3.Point3
+		u, v float64
+	}{
+		{vec3.Point3{X: 1, Y: 0, Z: 0}, 0.5, 0.5},
+		{vec3.Point3{X: 0, Y: 1, Z: 0}, 0.5, 1.0},
+		{vec3.Point3{X: 0, Y: 0, Z: 1}, 0.25, 0.5},
+		{vec3.Point3{X: 0, Y: 0, Z: -1}, 0.75, 0.5},
+	}
+	for _, tt := range tests {
+		u, v := sphereUV(tt.p)
+		if math.Abs(u-tt.u) > 1e-9 || math.Abs(v-tt.v) > 1e-9 {
+			t.Errorf("sphereUV(%v) = (%v, %v), want (%v, %v)", tt.p, u, v, tt.u, tt.v)
+		}
+	}
+}
+
+func TestLambertianTexture(t *testing.T) {
+	checker := texture.Checker{
+		Scale: 1.0,
+		Even:  texture.SolidColor{Albedo: vec3.Vec3{X: 1, Y: 1, Z: 1}},
+		Odd:   texture.SolidColor{Albedo: vec3.Vec3{X: 0, Y: 0, Z: 0}},
+	}
+	lambertian := Lambertian{Albedo: vec3.Vec3{X: 0.5, Y: 0.5, Z: 0.5}, Tex: checker}
+
+	var srec ScatterRecord
+	rec := HitRecord{P: vec3.Point3{X: 1.5, Y: 0.5, Z: 0.5}, Normal: vec3.Vec3{X: 0, Y: 1, Z: 0}}
+	lambertian.Scatter(&vec3.Ray{}, &rec, &srec, utils.GlobalRandom)
+
+	if srec.Attenuation != (vec3.Vec3{}) {
+		t.Errorf("Expected the texture's odd color to override Albedo, got %v", srec.Attenuation)
+	}
+}
+
+func TestQuadHit(t *testing.T) {
+	quad := Quad{Q: vec3.Point3{X: -1, Y: -1, Z: -3}, U: vec3.Vec3{X: 2, Y: 0, Z: 0}, V: vec3.Vec3{X: 0, Y: 2, Z: 0}}
+	ray_t := interval.Interval{Min: 0.001, Max: utils.INFINITY}
+
+	var rec HitRecord
+	r := vec3.Ray{Origin: vec3.Point3{X: 0.5, Y: -0.5, Z: 0}, Direction: vec3.Vec3{X: 0, Y: 0, Z: -1}}
+	if !quad.Hit(&r, ray_t, &rec) {
+		t.Fatalf("Expected ray through the quad to hit")
+	}
+	if rec.T != 3 || rec.U != 0.75 || rec.V != 0.25 || !rec.FrontFace {
+		t.Errorf("Unexpected hit record: %+v", rec)
+	}
+
+	outside := vec3.Ray{Origin: vec3.Point3{X: 1.5, Y: 0, Z: 0}, Direction: vec3.Vec3{X: 0, Y: 0, Z: -1}}
+	if quad.Hit(&outside, ray_t, &rec) {
+		t.Errorf("Expected ray beside the quad to miss")
+	}
+
+	// Flat in Z, but the bounding box is padded so it can still be hit
+	bbox := quad.BoundingBox()
+	if bbox.Z.Size() <= 0 || !bbox.Hit(&r, ray_t) {
+		t.Errorf("Expected a padded, hittable bounding box, got %+v", bbox)
+	}
+}
+
+func TestDiffuseLightEmitted(t *testing.T) {
+	light := DiffuseLight{Emit: vec3.Vec3{X: 4, Y: 4, Z: 4}}
+	var srec ScatterRecord
+
+	front := HitRecord{FrontFace: true}
+	if light.Scatter(&vec3.Ray{}, &front, &srec, utils.GlobalRandom) {
+		t.Errorf("Expected lights not to scatter")
+	}
+	if got := light.Emitted(&vec3.Ray{}, &front); got != light.Emit {
+		t.Errorf("Front face emitted %v, want %v", got, light.Emit)
+	}
+
+	back := HitRecord{FrontFace: false}
+	if got := light.Emitted(&vec3.Ray{}, &back); got != (vec3.Vec3{}) {
+		t.Errorf("Back face emitted %v, want black", got)
+	}
+	light.TwoSided = true
+	if got := light.Emitted(&vec3.Ray{}, &back); got != light.Emit {
+		t.Errorf("Two-sided back face emitted %v, want %v", got, light.Emit)
+	}
+
+	if got := (Lambertian{}).Emitted(&vec3.Ray{}, &front); got != (vec3.Vec3{}) {
+		t.Errorf("Lambertian emitted %v, want black", got)
+	}
+}
+
+// Estimate the integral of a PDF over all directions by uniform sampling; it should be one
+func integratePDF(pdf PDF, rng *rand.Rand, samples int) float64 {
+	sum := 0.0
+	for i := 0; i < samples; i++ {
+		sum += pdf.Value(*vec3.Vec3{}.RandomUnitVector(rng)) * 4 * math.Pi
+	}
+	return sum / float64(samples)
+}
+
+func TestPDFsIntegrateToOne(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	origin := vec3.Point3{X: 0, Y: 0, Z: 0}
+	light := Quad{Q: vec3.Point3{X: -1, Y: 2, Z: -1}, U: vec3.Vec3{X: 2, Y: 0, Z: 0}, V: vec3.Vec3{X: 0, Y: 0, Z: 2}}
+	ball := Sphere{Center: vec3.Point3{X: 0, Y: 0, Z: -3}, Radius: 1}
+
+	pdfs := map[string]PDF{
+		"Sphere":       SpherePDF{},
+		"Cosine":       NewCosinePDF(vec3.Vec3{X: 0, Y: 1, Z: 0}),
+		"Quad":         HittablePDF{Objects: light, Origin: origin},
+		"Sphere light": HittablePDF{Objects: ball, Origin: origin},
+		"Inside light": HittablePDF{Objects: Sphere{Center: origin, Radius: 2}, Origin: origin},
+		"Mixture":      MixturePDF{P0: HittablePDF{Objects: light, Origin: origin}, P1: NewCosinePDF(vec3.Vec3{X: 0, Y: 1, Z: 0})},
+	}
+	for name, pdf := range pdfs {
+		if got := integratePDF(pdf, rng, 200000); math.Abs(got-1) > 0.05 {
+			t.Errorf("%s PDF integrates to %v, want 1", name, got)
+		}
+	}
+}
+
+func TestLightSamplesHitTheLight(t *testing.T) {
+	rng := rand.New(rand.NewSource(4))
+	origin := vec3.Point3{X: 0, Y: 0, Z: 0}
+	var lights HittableList
+	lights.Append(Quad{Q: vec3.Point3{X: -1, Y: 2, Z: -1}, U: vec3.Vec3{X: 2, Y: 0, Z: 0}, V: vec3.Vec3{X: 0, Y: 0, Z: 2}})
+	lights.Append(Sphere{Center: vec3.Point3{X: 0, Y: 0, Z: -3}, Radius: 1})
+
+	for i := 0; i < 1000; i++ {
+		direction := lights.Random(origin, rng)
+		if lights.PDFValue(origin, direction) <= 0 {
+			t.Fatalf("Sampled direction %v has zero density", direction)
+		}
+	}
+}
+
+func TestMovingSphere(t *testing.T) {
+	sphere := MovingSphere{
+		Center0: vec3.Point3{X: 0, Y: 0, Z: -2},
+		Center1: vec3.Point3{X: 2, Y: 0, Z: -2},
+		Time0:   0,
+		Time1:   1,
+		Radius:  0.5,
+	}
+	ray_t := interval.Interval{Min: 0.001, Max: utils.INFINITY}
+	var rec HitRecord
+
+	atStart := vec3.Ray{Origin: vec3.Point3{X: 0, Y: 0, Z: 0}, Direction: vec3.Vec3{X: 0, Y: 0, Z: -1}, Time: 0}
+	if !sphere.Hit(&atStart, ray_t, &rec) {
+		t.Errorf("Expected a hit at the start position at time 0")
+	}
+	atEnd := atStart
+	atEnd.Time = 1
+	if sphere.Hit(&atEnd, ray_t, &rec) {
+		t.Errorf("Expected the sphere to have moved away by time 1")
+	}
+	halfway := vec3.Ray{Origin: vec3.Point3{X: 1, Y: 0, Z: 0}, Direction: vec3.Vec3{X: 0, Y: 0, Z: -1}, Time: 0.5}
+	if !sphere.Hit(&halfway, ray_t, &rec) || rec.T != 1.5 {
+		t.Errorf("Expected a hit at t = 1.5 halfway through the motion, got %+v", rec)
+	}
+
+	bbox := sphere.BoundingBox()
+	if bbox.X.Min != -0.5 || bbox.X.Max != 2.5 {
+		t.Errorf("Bounding box X = %+v, want [-0.5, 2.5]", bbox.X)
+	}
+	// Outside the motion interval the sphere stays within its bounding box
+	if center := sphere.Center(5); center != sphere.Center1 {
+		t.Errorf("Center(5) = %v, want %v", center, sphere.Center1)
+	}
+}
+
+func TestScatteredRaysKeepTime(t *testing.T) {
+	r_in := vec3.Ray{Origin: vec3.Point3{X: 0, Y: 1, Z: 0}, Direction: vec3.Vec3{X: 0, Y: -1, Z: 0}, Time: 0.25}
+	rec := HitRecord{P: vec3.Point3{}, Normal: vec3.Vec3{X: 0, Y: 1, Z: 0}, FrontFace: true}
+
+	for _, mat := range []Material{Metal{Albedo: vec3.Vec3{X: 1, Y: 1, Z: 1}}, Dielectric{Ir: 1.5}} {
+		var srec ScatterRecord
+		if !mat.Scatter(&r_in, &rec, &srec, utils.GlobalRandom) {
+			t.Fatalf("%T did not scatter", mat)
+		}
+		if srec.SkipPDFRay.Time != 0.25 {
+			t.Errorf("%T scattered ray time = %v, want 0.25", mat, srec.SkipPDFRay.Time)
+		}
+	}
+}
+
+func TestTransformMatchesMovedSphere(t *testing.T) {
+	unit := Sphere{Center: vec3.Point3{X: 0, Y: 0, Z: 0}, Radius: 1}
+	moved := Sphere{Center: vec3.Point3{X: 1, Y: 2, Z: -3}, Radius: 0.5}
+	scaled, err := NewScale(unit, vec3.Vec3{X: 0.5, Y: 0.5, Z: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	instance := NewTranslate(scaled, vec3.Vec3{X: 1, Y: 2, Z: -3})
+
+	if _, nested := instance.Object.(*Transform); nested {
+		t.Errorf("Expected nested transforms to be folded into one")
+	}
+
+	rng := rand.New(rand.NewSource(4))
+	ray_t := interval.Interval{Min: 0.001, Max: utils.INFINITY}
+	for i := 0; i < 200; i++ {
+		r := vec3.Ray{
+			Origin:    vec3.Point3{X: 0, Y: 0, Z: 2},
+			Direction: vec3.Vec3{X: rng.Float64()*2 - 1, Y: rng.Float64()*3 - 1, Z: -1},
+		}
+		var want, got HitRecord
+		hitWant := moved.Hit(&r, ray_t, &want)
+		hitGot := instance.Hit(&r, ray_t, &got)
+		if hitWant != hitGot {
+			t.Fatalf("Ray %v: hit = %v, want %v", r, hitGot, hitWant)
+		}
+		if !hitWant {
+			continue
+		}
+		if math.Abs(got.T-want.T) > 1e-9 || !got.P.Subtract(want.P).NearZero() || !got.Normal.Subtract(want.Normal).NearZero() {
+			t.Errorf("Ray %v: got %+v, want %+v", r, got, want)
+		}
+	}
+
+	bbox := instance.BoundingBox()
+	if math.Abs(bbox.X.Min-0.5) > 1e-9 || math.Abs(bbox.Z.Max+2.5) > 1e-9 {
+		t.Errorf("Bounding box = %+v, want X from 0.5 and Z up to -2.5", bbox)
+	}
+}
+
+func TestTransformNormalsUnderNonUniformScale(t *testing.T) {
+	// A 45 degree slope stretched 2x along X keeps normals perpendicular to
+	// the stretched surface rather than just stretching the normal
+	slope := Quad{Q: vec3.Point3{X: -1, Y: -1, Z: -1}, U: vec3.Vec3{X: 2, Y: 2, Z: 0}, V: vec3.Vec3{X: 0, Y: 0, Z: 2}}
+	instance, err := NewScale(slope, vec3.Vec3{X: 2, Y: 1, Z: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := vec3.Ray{Origin: vec3.Point3{X: 0, Y: 5, Z: 0}, Direction: vec3.Vec3{X: 0, Y: -1, Z: 0}}
+	var rec HitRecord
+	if !instance.Hit(&r, interval.Interval{Min: 0.001, Max: utils.INFINITY}, &rec) {
+		t.Fatalf("Expected a hit")
+	}
+	surface := vec3.Vec3{X: 2, Y: 1, Z: 0}
+	if d := rec.Normal.Dot(surface); math.Abs(d) > 1e-9 {
+		t.Errorf("Normal %v is not perpendicular to the surface (dot %v)", rec.Normal, d)
+	}
+	if math.Abs(rec.Normal.Length()-1) > 1e-9 {
+		t.Errorf("Normal %v is not unit length", rec.Normal)
+	}
+
+	if _, err := NewScale(slope, vec3.Vec3{X: 0, Y: 1, Z: 1}); err == nil {
+		t.Errorf("Expected an error for a zero scale")
+	}
+	if _, err := NewRotate(slope, vec3.Vec3{}, 30); err == nil {
+		t.Errorf("Expected an error for a zero rotation axis")
+	}
+}
+
+func TestConstantMediumTransmittance(t *testing.T) {
+	boundary := Sphere{Center: vec3.Point3{X: 0, Y: 0, Z: -5}, Radius: 1}
+	medium := NewConstantMedium(boundary, 0.5, vec3.Vec3{X: 1, Y: 1, Z: 1})
+	ray_t := interval.Interval{Min: 0.001, Max: utils.INFINITY}
+	far := Sphere{Center: vec3.Point3{X: 50, Y: 0, Z: 0}, Radius: 1}
+
+	// Rays through the centre travel 2 units inside, so a fraction
+	// 1 - exp(-density * 2) of them should scatter, whether the medium is
+	// hit directly or through a BVH, which may ask it about a ray more than once
+	worlds := []struct {
+		name  string
+		world Hittable
+	}{
+		{"direct", medium},
+		{"bvh of one", NewBVH(HittableList{Objects: []Hittable{medium}})},
+		{"bvh of three", NewBVH(HittableList{Objects: []Hittable{far, medium, far}})},
+	}
+	for _, tt := range worlds {
+		t.Run(tt.name, func(t *testing.T) {
+			rng := rand.New(rand.NewSource(6))
+			const n = 20000
+			hits := 0
+			for i := 0; i < n; i++ {
+				r := vec3.Ray{Origin: vec3.Point3{X: 0, Y: 0, Z: 0}, Direction: vec3.Vec3{X: 0, Y: 0, Z: -2}, FreePath: rng.Float64()}
+				var rec HitRecord
+				if tt.world.Hit(&r, ray_t, &rec) {
+					hits++
+					if rec.P.Z > -4 || rec.P.Z < -6 {
+						t.Fatalf("Scattered at %v, outside the boundary", rec.P)
+					}
+					if _, ok := rec.Mat.(Isotropic); !ok {
+						t.Fatalf("Expected the isotropic phase function, got %T", rec.Mat)
+					}
+				}
+			}
+			want := 1 - math.Exp(-1)
+			if got := float64(hits) / n; math.Abs(got-want) > 0.02 {
+				t.Errorf("Scattered fraction = %v, want %v", got, want)
+			}
+		})
+	}
+
+	// The same ray always scatters at the same place
+	r := vec3.Ray{Origin: vec3.Point3{X: 0, Y: 0, Z: 0}, Direction: vec3.Vec3{X: 0, Y: 0, Z: -1}, FreePath: 0.3}
+	var first, second HitRecord
+	medium.Hit(&r, ray_t, &first)
+	medium.Hit(&r, ray_t, &second)
+	if first.T != second.T {
+		t.Errorf("Hitting the same ray twice gave t = %v and %v", first.T, second.T)
+	}
+
+	// Two media in a row scatter independently, so rays get through both
+	// with probability exp(-1) * exp(-1)
+	behind := NewConstantMedium(Sphere{Center: vec3.Point3{X: 0, Y: 0, Z: -10}, Radius: 1}, 0.5, vec3.Vec3{})
+	both := NewBVH(HittableList{Objects: []Hittable{medium, behind}})
+	rng := rand.New(rand.NewSource(7))
+	const n = 20000
+	through := 0
+	for i := 0; i < n; i++ {
+		r := vec3.Ray{Origin: vec3.Point3{X: 0, Y: 0, Z: 0}, Direction: vec3.Vec3{X: 0, Y: 0, Z: -1}, FreePath: rng.Float64()}
+		var rec HitRecord
+		if !both.Hit(&r, ray_t, &rec) {
+			through++
+		}
+	}
+	if got, want := float64(through)/n, math.Exp(-2); math.Abs(got-want) > 0.02 {
+		t.Errorf("Fraction through both media = %v, want %v", got, want)
+	}
+
+	// Rays starting inside the volume scatter too, and ray_t still limits the hit
+	dense := NewConstantMedium(boundary, 1e6, vec3.Vec3{})
+	inside := vec3.Ray{Origin: vec3.Point3{X: 0, Y: 0, Z: -5}, Direction: vec3.Vec3{X: 0, Y: 0, Z: -1}}
+	if !dense.Hit(&inside, ray_t, &first) || first.T > 1e-3+0.001 {
+		t.Errorf("Expected a hit right away from inside a dense medium, got %+v", first)
+	}
+	if dense.Hit(&r, interval.Interval{Min: 0.001, Max: 3}, &first) {
+		t.Errorf("Expected no hit before the medium starts")
+	}
+}
+
+func TestIsotropicScatter(t *testing.T) {
+	mat := Isotropic{Albedo: vec3.Vec3{X: 0.2, Y: 0.4, Z: 0.6}}
+	r_in := vec3.Ray{Direction: vec3.Vec3{X: 0, Y: 0, Z: -1}}
+	var rec HitRecord
+	var srec ScatterRecord
+	if !mat.Scatter(&r_in, &rec, &srec, utils.GlobalRandom) || srec.SkipPDF {
+		t.Fatalf("Expected isotropic scattering through a PDF")
+	}
+	if srec.Attenuation != mat.Albedo {
+		t.Errorf("Attenuation = %v, want %v", srec.Attenuation, mat.Albedo)
+	}
+	if got := mat.ScatteringPDF(&r_in, &rec, &r_in); math.Abs(got-1/(4*math.Pi)) > 1e-12 {
+		t.Errorf("ScatteringPDF = %v, want 1/4pi", got)
+	}
+}
+
+func TestPrimitiveHits(t *testing.T) {
+	down := vec3.Vec3{X: 0, Y: -1, Z: 0}
+	side := vec3.Vec3{X: -1, Y: 0, Z: 0}
+	tests := []struct {
+		name       string
+		object     Hittable
+		origin     vec3.Point3
+		direction  vec3.Vec3
+		wantHit    bool
+		wantT      float64
+		wantNormal vec3.Vec3
+		wantFront  bool
+	}{
+		{"Plane from above", Plane{Normal: vec3.Vec3{X: 0, Y: 1, Z: 0}}, vec3.Point3{X: 3, Y: 2, Z: -7}, down, true, 2, vec3.Vec3{X: 0, Y: 1, Z: 0}, true},
+		{"Plane from below", Plane{Normal: vec3.Vec3{X: 0, Y: 1, Z: 0}}, vec3.Point3{X: 0, Y: -2, Z: 0}, vec3.Vec3{X: 0, Y: 1, Z: 0}, true, 2, down, false},
+		{"Plane parallel", Plane{Normal: vec3.Vec3{X: 0, Y: 1, Z: 0}}, vec3.Point3{X: 0, Y: 2, Z: 0}, side, false, 0, vec3.Vec3{}, false},
+		{"Disk centre", Disk{Normal: vec3.Vec3{X: 0, Y: 2, Z: 0}, Radius: 1}, vec3.Point3{X: 0.5, Y: 1, Z: 0.5}, down, true, 1, vec3.Vec3{X: 0, Y: 1, Z: 0}, true},
+		{"Disk outside radius", Disk{Normal: vec3.Vec3{X: 0, Y: 1, Z: 0}, Radius: 1}, vec3.Point3{X: 0.8, Y: 1, Z: 0.8}, down, false, 0, vec3.Vec3{}, false},
+		{"Box top", NewBox(vec3.Point3{X: 1, Y: 1, Z: 1}, vec3.Point3{X: -1, Y: -1, Z: -1}, nil), vec3.Point3{X: 0.5, Y: 3, Z: 0}, down, true, 2, vec3.Vec3{X: 0, Y: 1, Z: 0}, true},
+		{"Box right", NewBox(vec3.Point3{X: -1, Y: -1, Z: -1}, vec3.Point3{X: 1, Y: 1, Z: 1}, nil), vec3.Point3{X: 4, Y: 0.2, Z: 0.3}, side, true, 3, vec3.Vec3{X: 1, Y: 0, Z: 0}, true},
+		{"Box from inside", NewBox(vec3.Point3{X: -1, Y: -1, Z: -1}, vec3.Point3{X: 1, Y: 1, Z: 1}, nil), vec3.Point3{}, down, true, 1, vec3.Vec3{X: 0, Y: 1, Z: 0}, false},
+		{"Cylinder side", Cylinder{Top: vec3.Point3{X: 0, Y: 2, Z: 0}, Radius: 1}, vec3.Point3{X: 3, Y: 1, Z: 0}, side, true, 2, vec3.Vec3{X: 1, Y: 0, Z: 0}, true},
+		{"Cylinder top cap", Cylinder{Top: vec3.Point3{X: 0, Y: 2, Z: 0}, Radius: 1}, vec3.Point3{X: 0.5, Y: 5, Z: 0}, down, true, 3, vec3.Vec3{X: 0, Y: 1, Z: 0}, true},
+		{"Cylinder open top", Cylinder{Top: vec3.Point3{X: 0, Y: 2, Z: 0}, Radius: 1, Open: true}, vec3.Point3{X: 0.5, Y: 5, Z: 0}, down, false, 0, vec3.Vec3{}, false},
+		{"Cylinder above", Cylinder{Top: vec3.Point3{X: 0, Y: 2, Z: 0}, Radius: 1}, vec3.Point3{X: 3, Y: 2.5, Z: 0}, side, false, 0, vec3.Vec3{}, false},
+		{"Cylinder tilted axis", Cylinder{Base: vec3.Point3{X: -1, Y: 0, Z: 0}, Top: vec3.Point3{X: 1, Y: 0, Z: 0}, Radius: 0.5}, vec3.Point3{X: 0, Y: 3, Z: 0}, down, true, 2.5, vec3.Vec3{X: 0, Y: 1, Z: 0}, true},
+		{"Cone side", Cone{Apex: vec3.Point3{X: 0, Y: 1, Z: 0}, Radius: 1}, vec3.Point3{X: 3, Y: 0.5, Z: 0}, side, true, 2.5, *vec3.Vec3{X: 1, Y: 1, Z: 0}.UnitVector(), true},
+		{"Cone base cap", Cone{Apex: vec3.Point3{X: 0, Y: 1, Z: 0}, Radius: 1}, vec3.Point3{X: 0.2, Y: -1, Z: 0}, vec3.Vec3{X: 0, Y: 1, Z: 0}, true, 1, down, true},
+		{"Cone beside apex", Cone{Apex: vec3.Point3{X: 0, Y: 1, Z: 0}, Radius: 1}, vec3.Point3{X: 3, Y: 0.9, Z: 0.5}, side, false, 0, vec3.Vec3{}, false},
+	}
+
+	ray_t := interval.Interval{Min: 0.001, Max: utils.INFINITY}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := vec3.Ray{Origin: tt.origin, Direction: tt.direction}
+			var rec HitRecord
+			hit := tt.object.Hit(&r, ray_t, &rec)
+			if hit != tt.wantHit {
+				t.Fatalf("Hit = %v, want %v (%+v)", hit, tt.wantHit, rec)
+			}
+			if !hit {
+				return
+			}
+			if math.Abs(rec.T-tt.wantT) > 1e-9 || !rec.Normal.Subtract(tt.wantNormal).NearZero() || rec.FrontFace != tt.wantFront {
+				t.Errorf("Got T %v, normal %v, front %v; want %v, %v, %v", rec.T, rec.Normal, rec.FrontFace, tt.wantT, tt.wantNormal, tt.wantFront)
+			}
+			if rec.U < 0 || rec.U > 1 || rec.V < 0 || rec.V > 1 {
+				t.Errorf("UV (%v, %v) outside [0, 1]", rec.U, rec.V)
+			}
+		})
+	}
+}
+
+func TestPrimitiveHitsInsideBoundingBox(t *testing.T) {
+	objects := []Hittable{
+		Disk{Center: vec3.Point3{X: 1, Y: 0, Z: -2}, Normal: vec3.Vec3{X: 1, Y: 2, Z: 3}, Radius: 0.7},
+		NewBox(vec3.Point3{X: 0, Y: 0, Z: -3}, vec3.Point3{X: 1, Y: 2, Z: -2}, nil),
+		Cylinder{Base: vec3.Point3{X: 0, Y: -1, Z: -3}, Top: vec3.Point3{X: 1, Y: 1, Z: -2}, Radius: 0.4},
+		Cone{Base: vec3.Point3{X: -1, Y: 0, Z: -2}, Apex: vec3.Point3{X: 0, Y: 1, Z: -4}, Radius: 0.6},
+	}
+	rng := rand.New(rand.NewSource(8))
+	ray_t := interval.Interval{Min: 0.001, Max: utils.INFINITY}
+	for _, object := range objects {
+		bbox := object.BoundingBox()
+		hits := 0
+		for i := 0; i < 2000; i++ {
+			r := vec3.Ray{Direction: vec3.Vec3{X: rng.Float64()*2 - 1, Y: rng.Float64()*2 - 1, Z: -1}}
+			var rec HitRecord
+			if !object.Hit(&r, ray_t, &rec) {
+				continue
+			}
+			hits++
+			if !bbox.X.Contains(rec.P.X) || !bbox.Y.Contains(rec.P.Y) || !bbox.Z.Contains(rec.P.Z) {
+				t.Fatalf("%T hit at %v, outside its bounding box %+v", object, rec.P, bbox)
+			}
+			if !bbox.Hit(&r, ray_t) {
+				t.Fatalf("%T was hit by %v but its bounding box was not", object, r)
+			}
+		}
+		if hits == 0 {
+			t.Errorf("%T was never hit", object)
+		}
+	}
+
+	plane := Plane{Point: vec3.Point3{X: 0, Y: -1, Z: 0}, Normal: vec3.Vec3{X: 0, Y: 1, Z: 0}}
+	bbox := plane.BoundingBox()
+	if !bbox.Y.Contains(-1) || bbox.Y.Size() > 0.001 || bbox.X.Max < utils.INFINITY {
+		t.Errorf("Expected a ground plane box thin in Y only, got %+v", bbox)
+	}
+
+	// Transformed planes stay unbounded rather than turning into NaNs
+	tilted, err := NewRotate(plane, vec3.Vec3{X: 1, Y: 0, Z: 0}, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if box := tilted.BoundingBox(); box.Y.Max < utils.INFINITY || math.IsNaN(box.Z.Min) {
+		t.Errorf("Expected a rotated plane to have an unbounded box, got %+v", box)
+	}
+}
+
+func TestCSG(t *testing.T) {
+	unit := Sphere{Center: vec3.Point3{X: 0, Y: 0, Z: 0}, Radius: 1}
+	small := Sphere{Center: vec3.Point3{X: 0, Y: 0, Z: 0}, Radius: 0.5}
+	shifted := Sphere{Center: vec3.Point3{X: 0, Y: 0, Z: -1}, Radius: 1}
+	cube := NewBox(vec3.Point3{X: -0.8, Y: -0.8, Z: -0.8}, vec3.Point3{X: 0.8, Y: 0.8, Z: 0.8}, nil)
+
+	fromFront := vec3.Vec3{X: 0, Y: 0, Z: 3}
+	tests := []struct {
+		name      string
+		object    Hittable
+		origin    vec3.Point3
+		wantHit   bool
+		wantT     float64
+		wantFront bool
+	}{
+		{"Union hits the nearer sphere", CSG{Op: CSGUnion, A: shifted, B: unit}, fromFront, true, 2, true},
+		{"Union from inside the overlap", CSG{Op: CSGUnion, A: shifted, B: unit}, vec3.Point3{X: 0, Y: 0, Z: -0.5}, true, 1.5, false},
+		{"Intersection is a lens", CSG{Op: CSGIntersection, A: shifted, B: unit}, fromFront, true, 3, true},
+		{"Difference hits the outside", CSG{Op: CSGDifference, A: unit, B: small}, fromFront, true, 2, true},
+		{"Difference from the cavity", CSG{Op: CSGDifference, A: unit, B: small}, vec3.Point3{}, true, 0.5, true},
+		{"Difference enters through the cut", CSG{Op: CSGDifference, A: unit, B: Sphere{Center: vec3.Point3{X: 0, Y: 0, Z: 1}, Radius: 1}}, fromFront, true, 3, true},
+		{"Box minus a sphere through its centre", CSG{Op: CSGDifference, A: cube, B: unit}, fromFront, false, 0, false},
+		{"Rounded cube", CSG{Op: CSGIntersection, A: cube, B: unit}, fromFront, true, 2.2, true},
+		{"Nested", CSG{Op: CSGDifference, A: CSG{Op: CSGUnion, A: unit, B: shifted}, B: small}, vec3.Point3{}, true, 0.5, true},
+		{"Transformed operand", CSG{Op: CSGDifference, A: unit, B: NewTranslate(small, vec3.Vec3{X: 0, Y: 0, Z: 1})}, fromFront, true, 2.5, true},
+	}
+
+	ray_t := interval.Interval{Min: 0.001, Max: utils.INFINITY}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := vec3.Ray{Origin: tt.origin, Direction: vec3.Vec3{X: 0, Y: 0, Z: -1}}
+			var rec HitRecord
+			hit := tt.object.Hit(&r, ray_t, &rec)
+			if hit != tt.wantHit {
+				t.Fatalf("Hit = %v, want %v (%+v)", hit, tt.wantHit, rec)
+			}
+			if !hit {
+				return
+			}
+			if math.Abs(rec.T-tt.wantT) > 1e-6 || rec.FrontFace != tt.wantFront {
+				t.Errorf("Got T %v, front %v; want %v, %v", rec.T, rec.FrontFace, tt.wantT, tt.wantFront)
+			}
+			if rec.Normal.Dot(r.Direction) >= 0 {
+				t.Errorf("Normal %v should face against the ray", rec.Normal)
+			}
+		})
+	}
+
+	bbox := CSG{Op: CSGIntersection, A: shifted, B: unit}.BoundingBox()
+	if bbox.Z.Min != -1 || bbox.Z.Max != 0 {
+		t.Errorf("Intersection bounding box Z = %+v, want [-1, 0]", bbox.Z)
+	}
+
+	// A row of spheres along the ray, 4 units apart
+	row := func(n int) HittableList {
+		var list HittableList
+		for k := 1; k <= n; k++ {
+			list.Objects = append(list.Objects, Sphere{Center: vec3.Point3{X: 0, Y: 0, Z: float64(-4 * k)}, Radius: 1})
+		}
+		return list
+	}
+
+	// Hit only walks the operands as far as ray_t reaches
+	spheres := &countingHittable{Hittable: row(10)}
+	union := CSG{Op: CSGUnion, A: spheres, B: small}
+	r := vec3.Ray{Origin: vec3.Point3{}, Direction: vec3.Vec3{X: 0, Y: 0, Z: -1}}
+	var rec HitRecord
+	if !union.Hit(&r, interval.Interval{Min: 1, Max: 4}, &rec) || rec.T != 3 {
+		t.Fatalf("Expected a hit at t = 3, got %v", rec.T)
+	}
+	if spheres.calls > 3 {
+		t.Errorf("Hit asked the operand %d times for a hit 3 units away", spheres.calls)
+	}
+
+	// Operands with too many boundaries are reported rather than silently cut short
+	var logged bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&logged)
+	CSG{Op: CSGUnion, A: row(maxBoundaryHits), B: small}.Spans(&r)
+	if !strings.Contains(logged.String(), "boundaries") {
+		t.Errorf("Expected a warning about too many boundaries, got %q", logged.String())
+	}
+}
+
+// Hittable that counts how often it is hit
+type countingHittable struct {
+	Hittable
+	calls int
+}
+
+func (c *countingHittable) Hit(r *vec3.Ray, ray_t interval.Interval, rec *HitRecord) bool {
+	c.calls++
+	return c.Hittable.Hit(r, ray_t, rec)
+}
+
+func TestPrincipledSamplingMatchesEval(t *testing.T) {
+	// Estimate the reflected fraction of light two ways: by sampling the
+	// material's own PDF and by sampling directions uniformly. They only agree
+	// if Generate really draws directions with density Value.
+	r_in := vec3.Ray{Direction: *vec3.Vec3{X: 0.6, Y: -0.8, Z: 0}.UnitVector()}
+	rec := HitRecord{Normal: vec3.Vec3{X: 0, Y: 1, Z: 0}, FrontFace: true}
+
+	for _, mat := range []Principled{
+		{BaseColor: vec3.Vec3{X: 1, Y: 1, Z: 1}, Roughness: 0.5, Specular: 0.5},
+		{BaseColor: vec3.Vec3{X: 1, Y: 1, Z: 1}, Roughness: 0.4, Metallic: 1},
+		{BaseColor: vec3.Vec3{X: 0.8, Y: 0.5, Z: 0.2}, Roughness: 0.7, Metallic: 0.5, Specular: 1},
+	} {
+		rng := rand.New(rand.NewSource(10))
+		var srec ScatterRecord
+		if !mat.Scatter(&r_in, &rec, &srec, rng) || srec.SkipPDF {
+			t.Fatalf("%+v: expected an opaque scatter with a PDF", mat)
+		}
+
+		const n = 200000
+		importance, uniform := 0.0, 0.0
+		for i := 0; i < n; i++ {
+			dir := srec.PDF.Generate(rng)
+			if pdf := srec.PDF.Value(dir); pdf > 0 {
+				scattered := vec3.Ray{Direction: dir}
+				importance += mat.Eval(&r_in, &rec, &scattered).X / pdf
+			}
+			scattered := vec3.Ray{Direction: *vec3.Vec3{}.RandomUnitVector(rng)}
+			uniform += mat.Eval(&r_in, &rec, &scattered).X * 4 * math.Pi
+		}
+		importance /= n
+		uniform /= n
+
+		if math.Abs(importance-uniform) > 0.03 {
+			t.Errorf("%+v: importance sampled %v, uniform %v", mat, importance, uniform)
+		}
+		// A white surface can't reflect more light than it receives
+		if importance > 1.01 {
+			t.Errorf("%+v: reflects %v of incoming light", mat, importance)
+		}
+		if got := mat.ScatteringPDF(&r_in, &rec, &vec3.Ray{Direction: vec3.Vec3{X: 0, Y: 1, Z: 0}}); got <= 0 {
+			t.Errorf("%+v: ScatteringPDF towards the normal = %v, want positive", mat, got)
+		}
+	}
+}
+
+func TestPrincipledSmoothGlass(t *testing.T) {
+	glass := Principled{BaseColor: vec3.Vec3{X: 1, Y: 0.5, Z: 0.5}, Transmission: 1, IOR: 1.5}
+	r_in := vec3.Ray{Direction: vec3.Vec3{X: 0, Y: -1, Z: 0}, Time: 0.5}
+	rec := HitRecord{Normal: vec3.Vec3{X: 0, Y: 1, Z: 0}, FrontFace: true}
+
+	rng := rand.New(rand.NewSource(12))
+	refracted := 0
+	for i := 0; i < 1000; i++ {
+		var srec ScatterRecord
+		if !glass.Scatter(&r_in, &rec, &srec, rng) || !srec.SkipPDF {
+			t.Fatalf("Expected glass to scatter a single ray")
+		}
+		if srec.SkipPDFRay.Time != 0.5 {
+			t.Fatalf("Scattered ray time = %v, want 0.5", srec.SkipPDFRay.Time)
+		}
+		if srec.SkipPDFRay.Direction.Y < 0 {
+			refracted++
+			if srec.SkipPDFRay.Direction.UnitVector().Dot(r_in.Direction) < 0.99 {
+				t.Fatalf("Expected a smooth surface to pass a perpendicular ray straight through, got %v", srec.SkipPDFRay.Direction)
+			}
+			if math.Abs(srec.Attenuation.Y-0.5) > 1e-6 {
+				t.Fatalf("Expected refracted light to take the base color, got %v", srec.Attenuation)
+			}
+		}
+	}
+	// About 4% is reflected at normal incidence
+	if refracted < 930 || refracted > 990 {
+		t.Errorf("Refracted %d of 1000 rays, want about 960", refracted)
+	}
+}
+
+func TestSurfaceAlbedo(t *testing.T) {
+	color := vec3.Vec3{X: 0.2, Y: 0.4, Z: 0.6}
+	tests := []struct {
+		name string
+		mat  Material
+		want vec3.Vec3
+	}{
+		{"lambertian", Lambertian{Albedo: color}, color},
+		{"metal", Metal{Albedo: color, Fuzz: 0.3}, color},
+		{"principled", Principled{BaseColor: color, Roughness: 0.5}, color},
+		{"glass is white", Dielectric{Ir: 1.5}, vec3.Vec3{X: 1, Y: 1, Z: 1}},
+		{"light is clamped", DiffuseLight{Emit: vec3.Vec3{X: 4, Y: 0.5, Z: 0}}, vec3.Vec3{X: 1, Y: 0.5, Z: 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := HitRecord{Mat: tt.mat, FrontFace: true}
+			if got := SurfaceAlbedo(&rec); got != tt.want {
+				t.Errorf("SurfaceAlbedo() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTagObjects(t *testing.T) {
+	var list HittableList
+	list.Append(Sphere{Center: vec3.Point3{X: 0, Y: 0, Z: -1}, Radius: 0.5, Mat: Lambertian{}})
+	list.Append(Sphere{Center: vec3.Point3{X: 0, Y: 0, Z: -3}, Radius: 0.5, Mat: Lambertian{}})
+	world := NewBVH(TagObjects(list))
+
+	tests := []struct {
+		name   string
+		origin vec3.Point3
+		want   int
+	}{
+		{"front sphere", vec3.Point3{X: 0, Y: 0, Z: 0}, 1},
+		{"back sphere from behind the front one", vec3.Point3{X: 0, Y: 0, Z: -2}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := vec3.Ray{Origin: tt.origin, Direction: vec3.Vec3{X: 0, Y: 0, Z: -1}}
+			var rec HitRecord
+			if !world.Hit(&r, interval.Interval{Min: 0.001, Max: utils.INFINITY}, &rec) {
+				t.Fatalf("Expected a hit")
+			}
+			if rec.ObjectID != tt.want {
+				t.Errorf("ObjectID = %d, want %d", rec.ObjectID, tt.want)
+			}
+		})
+	}
+}
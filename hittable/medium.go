@@ -0,0 +1,73 @@
+package hittable
+
+import (
+	"go-tracer/src/interval"
+	"go-tracer/src/utils"
+	"go-tracer/src/vec3"
+	"math"
+)
+
+// Volume of constant density inside a closed boundary (e.g. a sphere or box),
+// for fog and smoke. A ray passing through it scatters after a random distance
+// that is more likely to be short the denser the medium.
+type ConstantMedium struct {
+	Boundary      Hittable
+	Density       float64
+	PhaseFunction Material // usually Isotropic
+}
+
+func NewConstantMedium(boundary Hittable, density float64, albedo vec3.Vec3) ConstantMedium {
+	return ConstantMedium{Boundary: boundary, Density: density, PhaseFunction: Isotropic{Albedo: albedo}}
+}
+
+func (cm ConstantMedium) Hit(r *vec3.Ray, ray_t interval.Interval, rec *HitRecord) bool {
+	// Find where the ray enters and leaves the boundary, even if it starts inside
+	var rec1, rec2 HitRecord
+	if !cm.Boundary.Hit(r, interval.UniverseInterval, &rec1) {
+		return false
+	}
+	if !cm.Boundary.Hit(r, interval.Interval{Min: rec1.T + 0.0001, Max: utils.INFINITY}, &rec2) {
+		return false
+	}
+
+	entry := rec1.T
+	rec1.T = math.Max(rec1.T, ray_t.Min)
+	rec2.T = math.Min(rec2.T, ray_t.Max)
+	if rec1.T >= rec2.T {
+		return false
+	}
+	rec1.T = math.Max(rec1.T, 0)
+
+	direction := r.GetDirection()
+	ray_length := direction.Length()
+	distance_inside_boundary := (rec2.T - rec1.T) * ray_length
+	hit_distance := -math.Log(1-freePathRandom(r, entry)) / cm.Density
+	if hit_distance > distance_inside_boundary {
+		return false
+	}
+
+	(*rec).T = rec1.T + hit_distance/ray_length
+	(*rec).P = r.At(rec.T)
+	// Normal and facing are meaningless inside a volume
+	(*rec).Normal = vec3.Vec3{X: 1, Y: 0, Z: 0}
+	(*rec).FrontFace = true
+	(*rec).U, (*rec).V = 0, 0
+	(*rec).Mat = cm.PhaseFunction
+	return true
+}
+
+func (cm ConstantMedium) BoundingBox() AABB {
+	return cm.Boundary.BoundingBox()
+}
+
+// Uniform number in [0, 1) for the distance r travels before scattering in a
+// medium whose boundary it enters at entry. It mixes the number the
+// integrator drew for r with the entry point, so media along one ray scatter
+// independently, yet hitting the same medium with the same ray always gives
+// the same distance: a BVH or CSG may ask more than once.
+func freePathRandom(r *vec3.Ray, entry float64) float64 {
+	var rng utils.RNG
+	rng.Seed(math.Float64bits(r.FreePath))
+	rng.Seed(rng.Uint64() ^ math.Float64bits(entry))
+	return rng.Float64()
+}
@@ -0,0 +1,29 @@
+package hittable
+
+import (
+	"go-tracer/src/interval"
+	"go-tracer/src/vec3"
+)
+
+// A triangle mesh with its own BVH, so it can be placed in a scene as a single object
+type Mesh struct {
+	Triangles []Triangle
+	bvh       *BVHNode
+}
+
+func NewMesh(triangles []Triangle) *Mesh {
+	var list HittableList
+	list.Objects = make([]Hittable, len(triangles))
+	for i, tri := range triangles {
+		list.Objects[i] = tri
+	}
+	return &Mesh{Triangles: triangles, bvh: NewBVH(list)}
+}
+
+func (m *Mesh) Hit(r *vec3.Ray, ray_t interval.Interval, rec *HitRecord) bool {
+	return m.bvh.Hit(r, ray_t, rec)
+}
+
+func (m *Mesh) BoundingBox() AABB {
+	return m.bvh.BoundingBox()
+}
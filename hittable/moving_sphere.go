@@ -0,0 +1,38 @@
+package hittable
+
+import (
+	"go-tracer/src/interval"
+	"go-tracer/src/vec3"
+)
+
+// Sphere moving in a straight line from Center0 at Time0 to Center1 at Time1.
+// It rests at the nearer end outside that interval.
+type MovingSphere struct {
+	Center0, Center1 vec3.Point3
+	Time0, Time1     float64
+	Radius           float64
+	Mat              Material
+}
+
+func (s MovingSphere) Center(time float64) vec3.Point3 {
+	if s.Time1 == s.Time0 {
+		return s.Center0
+	}
+	unit := interval.Interval{Min: 0, Max: 1}
+	fraction := unit.Clamp((time - s.Time0) / (s.Time1 - s.Time0))
+	return s.Center0.Add(*s.Center1.Subtract(s.Center0).MultiplyFloat(fraction))
+}
+
+// The sphere where it is at the given time
+func (s MovingSphere) At(time float64) Sphere {
+	return Sphere{Center: s.Center(time), Radius: s.Radius, Mat: s.Mat}
+}
+
+func (s MovingSphere) Hit(r *vec3.Ray, ray_t interval.Interval, rec *HitRecord) bool {
+	return s.At(r.GetTime()).Hit(r, ray_t, rec)
+}
+
+// Covers the whole path, so BVHs work for rays at any time
+func (s MovingSphere) BoundingBox() AABB {
+	return EnclosingAABB(s.At(s.Time0).BoundingBox(), s.At(s.Time1).BoundingBox())
+}
@@ -0,0 +1,102 @@
+package hittable
+
+import (
+	"go-tracer/src/utils"
+	"go-tracer/src/vec3"
+	"math"
+)
+
+// Probability density over directions, used to importance sample rays
+type PDF interface {
+	// Density of the given direction
+	Value(direction vec3.Vec3) float64
+	// Draw a direction with this density
+	Generate(rnd utils.Random) vec3.Vec3
+}
+
+// Hittables that can be sampled as light sources: they can generate directions
+// from an origin towards themselves and give the density of such directions
+type Sampleable interface {
+	PDFValue(origin vec3.Point3, direction vec3.Vec3) float64
+	Random(origin vec3.Point3, rnd utils.Random) vec3.Vec3
+}
+
+// Uniform over all directions
+type SpherePDF struct{}
+
+func (SpherePDF) Value(direction vec3.Vec3) float64 {
+	return 1 / (4 * math.Pi)
+}
+
+func (SpherePDF) Generate(rnd utils.Random) vec3.Vec3 {
+	return *vec3.Vec3{}.RandomUnitVector(rnd)
+}
+
+// Cosine-weighted hemisphere around a surface normal, matching Lambertian scattering
+type CosinePDF struct {
+	UVW vec3.ONB
+}
+
+func NewCosinePDF(w vec3.Vec3) CosinePDF {
+	return CosinePDF{UVW: vec3.NewONB(w)}
+}
+
+func (p CosinePDF) Value(direction vec3.Vec3) float64 {
+	cosine_theta := direction.UnitVector().Dot(p.UVW.W)
+	return math.Max(0, cosine_theta/math.Pi)
+}
+
+func (p CosinePDF) Generate(rnd utils.Random) vec3.Vec3 {
+	return p.UVW.Transform(vec3.RandomCosineDirection(rnd))
+}
+
+// Directions from Origin towards a light source
+type HittablePDF struct {
+	Objects Sampleable
+	Origin  vec3.Point3
+}
+
+func (p HittablePDF) Value(direction vec3.Vec3) float64 {
+	return p.Objects.PDFValue(p.Origin, direction)
+}
+
+func (p HittablePDF) Generate(rnd utils.Random) vec3.Vec3 {
+	return p.Objects.Random(p.Origin, rnd)
+}
+
+// Even mix of two densities: picks either one to generate a direction
+type MixturePDF struct {
+	P0, P1 PDF
+}
+
+func (p MixturePDF) Value(direction vec3.Vec3) float64 {
+	return 0.5*p.P0.Value(direction) + 0.5*p.P1.Value(direction)
+}
+
+func (p MixturePDF) Generate(rnd utils.Random) vec3.Vec3 {
+	if rnd.Float64() < 0.5 {
+		return p.P0.Generate(rnd)
+	}
+	return p.P1.Generate(rnd)
+}
+
+// Several light sources sampled as one, picking each with equal probability
+type SampleableList []Sampleable
+
+func (sl SampleableList) PDFValue(origin vec3.Point3, direction vec3.Vec3) float64 {
+	if len(sl) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, light := range sl {
+		sum += light.PDFValue(origin, direction)
+	}
+	return sum / float64(len(sl))
+}
+
+func (sl SampleableList) Random(origin vec3.Point3, rnd utils.Random) vec3.Vec3 {
+	if len(sl) == 0 {
+		return vec3.Vec3{X: 1, Y: 0, Z: 0}
+	}
+	return sl[int(rnd.Float64()*float64(len(sl)))%len(sl)].Random(origin, rnd)
+}
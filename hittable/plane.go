@@ -0,0 +1,138 @@
+package hittable
+
+import (
+	"go-tracer/src/interval"
+	"go-tracer/src/utils"
+	"go-tracer/src/vec3"
+	"math"
+)
+
+// Infinite plane through Point. The front face is the side Normal points to.
+type Plane struct {
+	Point  vec3.Point3
+	Normal vec3.Vec3
+	Mat    Material
+}
+
+func (p Plane) Hit(r *vec3.Ray, ray_t interval.Interval, rec *HitRecord) bool {
+	normal := *p.Normal.UnitVector()
+	denom := normal.Dot(r.GetDirection())
+	if math.Abs(denom) < 1e-8 {
+		return false
+	}
+
+	t := normal.Dot(*p.Point.Subtract(r.GetOrigin())) / denom
+	if !ray_t.Contains(t) {
+		return false
+	}
+
+	// UVs are the position along two tangents, wrapped so textures repeat
+	// every unit
+	intersection := r.At(t)
+	frame := vec3.NewONB(normal)
+	offset := *intersection.Subtract(p.Point)
+	u := offset.Dot(frame.U)
+	v := offset.Dot(frame.V)
+
+	(*rec).T = t
+	(*rec).P = intersection
+	(*rec).U = u - math.Floor(u)
+	(*rec).V = v - math.Floor(v)
+	(*rec).Mat = p.Mat
+	(*rec).SetFaceNormal(r, &normal)
+
+	return true
+}
+
+// Unbounded, except along the normal when the plane is axis-aligned
+func (p Plane) BoundingBox() AABB {
+	box := AABB{X: interval.UniverseInterval, Y: interval.UniverseInterval, Z: interval.UniverseInterval}
+	normal := *p.Normal.UnitVector()
+	switch {
+	case math.Abs(normal.X) == 1:
+		box.X = interval.Interval{Min: p.Point.X, Max: p.Point.X}
+	case math.Abs(normal.Y) == 1:
+		box.Y = interval.Interval{Min: p.Point.Y, Max: p.Point.Y}
+	case math.Abs(normal.Z) == 1:
+		box.Z = interval.Interval{Min: p.Point.Z, Max: p.Point.Z}
+	}
+	box.padToMinimums()
+	return box
+}
+
+// Flat circle around Center, facing Normal
+type Disk struct {
+	Center vec3.Point3
+	Normal vec3.Vec3
+	Radius float64
+	Mat    Material
+}
+
+func (d Disk) Hit(r *vec3.Ray, ray_t interval.Interval, rec *HitRecord) bool {
+	normal := *d.Normal.UnitVector()
+	denom := normal.Dot(r.GetDirection())
+	if math.Abs(denom) < 1e-8 {
+		return false
+	}
+
+	t := normal.Dot(*d.Center.Subtract(r.GetOrigin())) / denom
+	if !ray_t.Contains(t) {
+		return false
+	}
+
+	intersection := r.At(t)
+	offset := *intersection.Subtract(d.Center)
+	if offset.LengthSquared() > d.Radius*d.Radius {
+		return false
+	}
+
+	// U goes around the disk and V out from the centre
+	frame := vec3.NewONB(normal)
+	phi := math.Atan2(offset.Dot(frame.V), offset.Dot(frame.U))
+
+	(*rec).T = t
+	(*rec).P = intersection
+	(*rec).U = (phi + math.Pi) / (2 * math.Pi)
+	(*rec).V = offset.Length() / d.Radius
+	(*rec).Mat = d.Mat
+	(*rec).SetFaceNormal(r, &normal)
+
+	return true
+}
+
+func (d Disk) BoundingBox() AABB {
+	return diskAABB(d.Center, *d.Normal.UnitVector(), d.Radius)
+}
+
+// Tight box around a disk: along each axis it reaches radius * sin of the
+// angle between that axis and the normal
+func diskAABB(center vec3.Point3, normal vec3.Vec3, radius float64) AABB {
+	extent := vec3.Vec3{
+		X: radius * math.Sqrt(math.Max(0, 1-normal.X*normal.X)),
+		Y: radius * math.Sqrt(math.Max(0, 1-normal.Y*normal.Y)),
+		Z: radius * math.Sqrt(math.Max(0, 1-normal.Z*normal.Z)),
+	}
+	return NewAABBFromPoints(*center.Subtract(extent), center.Add(extent))
+}
+
+// Density of directions from origin towards uniformly chosen points on the
+// disk, converted from area to solid angle
+func (d Disk) PDFValue(origin vec3.Point3, direction vec3.Vec3) float64 {
+	var rec HitRecord
+	r := vec3.Ray{Origin: origin, Direction: direction}
+	if !d.Hit(&r, interval.Interval{Min: 0.001, Max: utils.INFINITY}, &rec) {
+		return 0
+	}
+
+	area := math.Pi * d.Radius * d.Radius
+	distance_squared := rec.T * rec.T * direction.LengthSquared()
+	cosine := math.Abs(direction.Dot(rec.Normal) / direction.Length())
+	return distance_squared / (cosine * area)
+}
+
+func (d Disk) Random(origin vec3.Point3, rnd utils.Random) vec3.Vec3 {
+	frame := vec3.NewONB(d.Normal)
+	p := vec3.SampleUnitDisk(rnd)
+	on_disk := d.Center.Add(frame.Transform(*p.MultiplyFloat(d.Radius)))
+	return *on_disk.Subtract(origin)
+}
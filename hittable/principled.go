@@ -0,0 +1,207 @@
+package hittable
+
+import (
+	"go-tracer/src/texture"
+	"go-tracer/src/utils"
+	"go-tracer/src/vec3"
+	"math"
+)
+
+// Physically based material in the style of the Disney/glTF "principled"
+// models: a diffuse base under a GGX microfacet specular layer, blending into a
+// tinted metal as Metallic goes to 1 and into rough glass as Transmission does.
+type Principled struct {
+	BaseColor    vec3.Vec3
+	Tex          texture.Texture // if set, used instead of BaseColor
+	Roughness    float64         // 0 is polished, 1 fully rough
+	Metallic     float64
+	Specular     float64 // dielectric reflectance at normal incidence, scaled so 0.5 is 4%
+	Transmission float64 // how much of the non-metallic part refracts like glass
+	IOR          float64 // index of refraction for transmission, 0 means 1.5
+}
+
+// Below this the GGX distribution is too sharp to evaluate reliably
+const minAlpha = 1e-3
+
+func (p Principled) alpha() float64 {
+	return math.Max(p.Roughness*p.Roughness, minAlpha)
+}
+
+// Reflectance at normal incidence: a grey 0-8% for dielectrics, the base color for metals
+func (p Principled) f0(base vec3.Vec3) vec3.Vec3 {
+	dielectric := 0.08 * p.Specular
+	return vec3.Vec3{
+		X: dielectric + (base.X-dielectric)*p.Metallic,
+		Y: dielectric + (base.Y-dielectric)*p.Metallic,
+		Z: dielectric + (base.Z-dielectric)*p.Metallic,
+	}
+}
+
+func (p Principled) pdf(r_in *vec3.Ray, rec *HitRecord) principledPDF {
+	return principledPDF{
+		UVW:            vec3.NewONB(rec.Normal),
+		Wo:             r_in.GetDirection().UnitVector().Negate(),
+		Alpha:          p.alpha(),
+		SpecularWeight: p.Metallic + (1-p.Metallic)*math.Min(p.Specular, 1)*0.5,
+	}
+}
+
+func (p Principled) Scatter(r_in *vec3.Ray, rec *HitRecord, srec *ScatterRecord, rnd utils.Random) bool {
+	(*srec).Attenuation = albedoAt(p.BaseColor, p.Tex, rec)
+
+	// Pick the glass or the opaque part in proportion to their weights, so
+	// neither needs scaling
+	if rnd.Float64() < p.Transmission*(1-p.Metallic) {
+		return p.scatterTransmission(r_in, rec, srec, rnd)
+	}
+
+	(*srec).PDF = p.pdf(r_in, rec)
+	(*srec).SkipPDF = false
+	return true
+}
+
+// Rough glass: reflect or refract about a microfacet normal drawn from the
+// GGX distribution, weighted as in Walter et al. 2007
+func (p Principled) scatterTransmission(r_in *vec3.Ray, rec *HitRecord, srec *ScatterRecord, rnd utils.Random) bool {
+	ior := p.IOR
+	if ior <= 0 {
+		ior = 1.5
+	}
+	refraction_ratio := ior
+	if rec.FrontFace {
+		refraction_ratio = 1 / ior
+	}
+
+	alpha := p.alpha()
+	unit_direction := *r_in.GetDirection().UnitVector()
+	wo := unit_direction.Negate()
+	m := vec3.NewONB(rec.Normal).Transform(sampleGGXNormal(rnd, alpha))
+	cos_o := wo.Dot(m)
+	if cos_o <= 0 {
+		m = rec.Normal
+		cos_o = wo.Dot(m)
+	}
+	sin_o := math.Sqrt(math.Max(0, 1-cos_o*cos_o))
+
+	attenuation := vec3.Vec3{X: 1, Y: 1, Z: 1}
+	var direction vec3.Vec3
+	if refraction_ratio*sin_o > 1 || Reflectance(cos_o, refraction_ratio) > rnd.Float64() {
+		direction = unit_direction.Reflect(&m)
+		if direction.Dot(rec.Normal) <= 0 {
+			return false
+		}
+	} else {
+		direction = unit_direction.Refract(&unit_direction, &m, refraction_ratio)
+		if direction.Dot(rec.Normal) >= 0 {
+			return false
+		}
+		attenuation = srec.Attenuation
+	}
+
+	n_dot_o := wo.Dot(rec.Normal)
+	n_dot_i := math.Abs(direction.UnitVector().Dot(rec.Normal))
+	weight := cos_o * smithG1(n_dot_o, alpha) * smithG1(n_dot_i, alpha) / (n_dot_o * m.Dot(rec.Normal))
+
+	(*srec).Attenuation = *attenuation.MultiplyFloat(weight)
+	(*srec).PDF = nil
+	(*srec).SkipPDF = true
+	(*srec).SkipPDFRay = vec3.Ray{Origin: rec.P, Direction: direction, Time: r_in.Time}
+	return true
+}
+
+func (p Principled) ScatteringPDF(r_in *vec3.Ray, rec *HitRecord, scattered *vec3.Ray) float64 {
+	return p.pdf(r_in, rec).Value(scattered.GetDirection())
+}
+
+// Diffuse plus GGX specular reflection, times the cosine at the light
+func (p Principled) Eval(r_in *vec3.Ray, rec *HitRecord, scattered *vec3.Ray) vec3.Vec3 {
+	wo := r_in.GetDirection().UnitVector().Negate()
+	wi := *scattered.GetDirection().UnitVector()
+	n_dot_o := rec.Normal.Dot(wo)
+	n_dot_i := rec.Normal.Dot(wi)
+	if n_dot_o <= 0 || n_dot_i <= 0 {
+		return vec3.Vec3{X: 0, Y: 0, Z: 0}
+	}
+
+	base := albedoAt(p.BaseColor, p.Tex, rec)
+	alpha := p.alpha()
+	h := *wo.Add(wi).UnitVector()
+	fresnel := schlickVec(p.f0(base), wi.Dot(h))
+	specular := ggxD(rec.Normal.Dot(h), alpha) * smithG1(n_dot_o, alpha) * smithG1(n_dot_i, alpha) / (4 * n_dot_o * n_dot_i)
+
+	// Light that isn't reflected at the surface reaches the diffuse base,
+	// which metals don't have
+	kd := (1 - p.Metallic) / math.Pi
+	return vec3.Vec3{
+		X: (kd*base.X*(1-fresnel.X) + specular*fresnel.X) * n_dot_i,
+		Y: (kd*base.Y*(1-fresnel.Y) + specular*fresnel.Y) * n_dot_i,
+		Z: (kd*base.Z*(1-fresnel.Z) + specular*fresnel.Z) * n_dot_i,
+	}
+}
+
+func (p Principled) Emitted(r_in *vec3.Ray, rec *HitRecord) vec3.Vec3 {
+	return vec3.Vec3{X: 0, Y: 0, Z: 0}
+}
+
+// Mixture of cosine-weighted diffuse and GGX reflection directions for an
+// outgoing direction Wo
+type principledPDF struct {
+	UVW            vec3.ONB
+	Wo             vec3.Vec3
+	Alpha          float64
+	SpecularWeight float64 // chance of sampling the specular lobe
+}
+
+func (pp principledPDF) Value(direction vec3.Vec3) float64 {
+	wi := *direction.UnitVector()
+	cos_theta := wi.Dot(pp.UVW.W)
+	if cos_theta <= 0 {
+		return 0
+	}
+	h := *pp.Wo.Add(wi).UnitVector()
+	n_dot_h := h.Dot(pp.UVW.W)
+	// Density of the half vector, changed to the density of the reflected direction
+	specular := ggxD(n_dot_h, pp.Alpha) * n_dot_h / (4 * math.Abs(pp.Wo.Dot(h)))
+	return (1-pp.SpecularWeight)*cos_theta/math.Pi + pp.SpecularWeight*specular
+}
+
+func (pp principledPDF) Generate(rnd utils.Random) vec3.Vec3 {
+	if rnd.Float64() < pp.SpecularWeight {
+		m := pp.UVW.Transform(sampleGGXNormal(rnd, pp.Alpha))
+		return pp.Wo.Negate().Reflect(&m)
+	}
+	return pp.UVW.Transform(vec3.RandomCosineDirection(rnd))
+}
+
+// GGX (Trowbridge-Reitz) distribution of microfacet normals
+func ggxD(n_dot_h, alpha float64) float64 {
+	if n_dot_h <= 0 {
+		return 0
+	}
+	a2 := alpha * alpha
+	d := n_dot_h*n_dot_h*(a2-1) + 1
+	return a2 / (math.Pi * d * d)
+}
+
+// Smith masking for one direction, the fraction of microfacets visible from it
+func smithG1(n_dot_v, alpha float64) float64 {
+	a2 := alpha * alpha
+	return 2 * n_dot_v / (n_dot_v + math.Sqrt(a2+(1-a2)*n_dot_v*n_dot_v))
+}
+
+// Microfacet normal around +Z with density D(m) * cos(theta_m)
+func sampleGGXNormal(rnd utils.Random, alpha float64) vec3.Vec3 {
+	r1 := rnd.Float64()
+	r2 := rnd.Float64()
+	tan2_theta := alpha * alpha * r1 / (1 - r1)
+	cos_theta := 1 / math.Sqrt(1+tan2_theta)
+	sin_theta := math.Sqrt(math.Max(0, 1-cos_theta*cos_theta))
+	phi := 2 * math.Pi * r2
+	return vec3.Vec3{X: sin_theta * math.Cos(phi), Y: sin_theta * math.Sin(phi), Z: cos_theta}
+}
+
+// Schlick's approximation with a per-channel reflectance at normal incidence
+func schlickVec(f0 vec3.Vec3, cosine float64) vec3.Vec3 {
+	k := math.Pow(1-math.Max(0, cosine), 5)
+	return vec3.Vec3{X: f0.X + (1-f0.X)*k, Y: f0.Y + (1-f0.Y)*k, Z: f0.Z + (1-f0.Z)*k}
+}
@@ -0,0 +1,79 @@
+package hittable
+
+import (
+	"go-tracer/src/interval"
+	"go-tracer/src/utils"
+	"go-tracer/src/vec3"
+	"math"
+)
+
+// Parallelogram with corner Q and edges U and V, so its corners are Q, Q+U,
+// Q+V and Q+U+V. The front face is the side U x V points to.
+type Quad struct {
+	Q    vec3.Point3
+	U, V vec3.Vec3
+	Mat  Material
+}
+
+func (q Quad) Hit(r *vec3.Ray, ray_t interval.Interval, rec *HitRecord) bool {
+	n := *q.U.Cross(q.V)
+	normal := *n.UnitVector()
+	denom := normal.Dot(r.GetDirection())
+
+	// No hit if the ray is parallel to the plane
+	if math.Abs(denom) < 1e-8 {
+		return false
+	}
+
+	// Intersect the plane containing the quad, then check the hit is inside it
+	t := (normal.Dot(q.Q) - normal.Dot(r.GetOrigin())) / denom
+	if !ray_t.Contains(t) {
+		return false
+	}
+
+	intersection := r.At(t)
+	planar_hitpt := intersection.Subtract(q.Q)
+	w := *n.DivideFloat(n.Dot(n))
+	alpha := w.Dot(*planar_hitpt.Cross(q.V))
+	beta := w.Dot(*q.U.Cross(*planar_hitpt))
+
+	unit := interval.Interval{Min: 0, Max: 1}
+	if !unit.Contains(alpha) || !unit.Contains(beta) {
+		return false
+	}
+
+	(*rec).T = t
+	(*rec).P = intersection
+	(*rec).U = alpha
+	(*rec).V = beta
+	(*rec).Mat = q.Mat
+	(*rec).SetFaceNormal(r, &normal)
+
+	return true
+}
+
+func (q Quad) BoundingBox() AABB {
+	diagonal1 := NewAABBFromPoints(q.Q, q.Q.Add(q.U).Add(q.V))
+	diagonal2 := NewAABBFromPoints(q.Q.Add(q.U), q.Q.Add(q.V))
+	return EnclosingAABB(diagonal1, diagonal2)
+}
+
+// Density of directions from origin towards uniformly chosen points on the quad,
+// converted from area to solid angle
+func (q Quad) PDFValue(origin vec3.Point3, direction vec3.Vec3) float64 {
+	var rec HitRecord
+	r := vec3.Ray{Origin: origin, Direction: direction}
+	if !q.Hit(&r, interval.Interval{Min: 0.001, Max: utils.INFINITY}, &rec) {
+		return 0
+	}
+
+	area := q.U.Cross(q.V).Length()
+	distance_squared := rec.T * rec.T * direction.LengthSquared()
+	cosine := math.Abs(direction.Dot(rec.Normal) / direction.Length())
+	return distance_squared / (cosine * area)
+}
+
+func (q Quad) Random(origin vec3.Point3, rnd utils.Random) vec3.Vec3 {
+	p := q.Q.Add(*q.U.MultiplyFloat(rnd.Float64())).Add(*q.V.MultiplyFloat(rnd.Float64()))
+	return *p.Subtract(origin)
+}
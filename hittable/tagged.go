@@ -0,0 +1,59 @@
+package hittable
+
+import (
+	"go-tracer/src/interval"
+	"go-tracer/src/vec3"
+)
+
+// Stamps an ID on every hit of the wrapped object, e.g. for object ID AOVs.
+// When tags are nested the outermost one wins.
+type Tagged struct {
+	Object Hittable
+	ID     int
+}
+
+func (t Tagged) Hit(r *vec3.Ray, ray_t interval.Interval, rec *HitRecord) bool {
+	if !t.Object.Hit(r, ray_t, rec) {
+		return false
+	}
+	(*rec).ObjectID = t.ID
+	return true
+}
+
+func (t Tagged) BoundingBox() AABB {
+	return t.Object.BoundingBox()
+}
+
+// Copy of a list with each object tagged with its position, counting from 1
+// so that 0 still means no object
+func TagObjects(list HittableList) HittableList {
+	tagged := HittableList{Objects: make([]Hittable, len(list.Objects))}
+	for i, object := range list.Objects {
+		tagged.Objects[i] = Tagged{Object: object, ID: i + 1}
+	}
+	return tagged
+}
+
+// A material carrying the ID the material ID AOV shows for it, so that two
+// materials with the same parameters can still be told apart. It scatters and
+// emits exactly like the material it wraps.
+type TaggedMaterial struct {
+	Material
+	ID int
+}
+
+// ID of a TaggedMaterial, 0 for any other material
+func MaterialID(m Material) int {
+	if t, ok := m.(TaggedMaterial); ok {
+		return t.ID
+	}
+	return 0
+}
+
+// The material inside a TaggedMaterial, for code that needs its concrete type
+func UntagMaterial(m Material) Material {
+	if t, ok := m.(TaggedMaterial); ok {
+		return t.Material
+	}
+	return m
+}
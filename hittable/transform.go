@@ -0,0 +1,110 @@
+package hittable
+
+import (
+	"errors"
+	"go-tracer/src/interval"
+	"go-tracer/src/utils"
+	"go-tracer/src/vec3"
+	"math"
+)
+
+// Instance of another hittable placed in the world by an affine transform.
+// Rays are moved into the object's own space to be intersected, and the hit is
+// moved back out, so many instances can share one copy of the geometry.
+type Transform struct {
+	Object        Hittable
+	ObjectToWorld vec3.Mat4
+	WorldToObject vec3.Mat4
+	bbox          AABB
+}
+
+// Place object in the world with the matrix m. Transforms of transforms are
+// folded into a single matrix.
+func NewTransform(object Hittable, m vec3.Mat4) (*Transform, error) {
+	if inner, ok := object.(*Transform); ok {
+		object = inner.Object
+		m = m.Multiply(inner.ObjectToWorld)
+	}
+
+	inverse, ok := m.Inverse()
+	if !ok {
+		return nil, errors.New("transform matrix is not invertible")
+	}
+
+	t := &Transform{Object: object, ObjectToWorld: m, WorldToObject: inverse}
+	t.bbox = transformAABB(object.BoundingBox(), m)
+	return t, nil
+}
+
+func NewTranslate(object Hittable, offset vec3.Vec3) *Transform {
+	// Translations are always invertible
+	t, _ := NewTransform(object, vec3.Translation(offset))
+	return t
+}
+
+// Rotate by degrees about an axis through the origin
+func NewRotate(object Hittable, axis vec3.Vec3, degrees float64) (*Transform, error) {
+	if axis.NearZero() {
+		return nil, errors.New("rotation axis must not be zero")
+	}
+	return NewTransform(object, vec3.Rotation(axis, degrees))
+}
+
+// Scale about the origin by a factor per axis
+func NewScale(object Hittable, factors vec3.Vec3) (*Transform, error) {
+	return NewTransform(object, vec3.Scaling(factors))
+}
+
+func (t *Transform) Hit(r *vec3.Ray, ray_t interval.Interval, rec *HitRecord) bool {
+	// The direction is not renormalised, so distances along the ray (T) are
+	// the same in both spaces
+	object_r := vec3.Ray{
+		Origin:    t.WorldToObject.TransformPoint(r.GetOrigin()),
+		Direction: t.WorldToObject.TransformVector(r.GetDirection()),
+		Time:      r.GetTime(),
+		FreePath:  r.FreePath,
+	}
+
+	if !t.Object.Hit(&object_r, ray_t, rec) {
+		return false
+	}
+
+	// Normals transform by the inverse transpose, which keeps them
+	// perpendicular to the surface under non-uniform scaling
+	(*rec).P = t.ObjectToWorld.TransformPoint(rec.P)
+	(*rec).Normal = *t.WorldToObject.Transpose().TransformVector(rec.Normal).UnitVector()
+
+	return true
+}
+
+func (t *Transform) BoundingBox() AABB {
+	return t.bbox
+}
+
+// Box around the eight transformed corners of box
+func transformAABB(box AABB, m vec3.Mat4) AABB {
+	for _, ax := range []interval.Interval{box.X, box.Y, box.Z} {
+		if math.Abs(ax.Min) >= utils.INFINITY || math.Abs(ax.Max) >= utils.INFINITY {
+			// Unbounded objects stay unbounded in any orientation
+			return AABB{X: interval.UniverseInterval, Y: interval.UniverseInterval, Z: interval.UniverseInterval}
+		}
+	}
+
+	lo := vec3.Point3{X: utils.INFINITY, Y: utils.INFINITY, Z: utils.INFINITY}
+	hi := vec3.Point3{X: -utils.INFINITY, Y: -utils.INFINITY, Z: -utils.INFINITY}
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 2; j++ {
+			for k := 0; k < 2; k++ {
+				corner := vec3.Point3{
+					X: [2]float64{box.X.Min, box.X.Max}[i],
+					Y: [2]float64{box.Y.Min, box.Y.Max}[j],
+					Z: [2]float64{box.Z.Min, box.Z.Max}[k],
+				}
+				p := m.TransformPoint(corner)
+				lo = vec3.Point3{X: math.Min(lo.X, p.X), Y: math.Min(lo.Y, p.Y), Z: math.Min(lo.Z, p.Z)}
+				hi = vec3.Point3{X: math.Max(hi.X, p.X), Y: math.Max(hi.Y, p.Y), Z: math.Max(hi.Z, p.Z)}
+			}
+		}
+	}
+	return NewAABBFromPoints(lo, hi)
+}
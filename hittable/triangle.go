@@ -0,0 +1,97 @@
+package hittable
+
+import (
+	"go-tracer/src/interval"
+	"go-tracer/src/vec3"
+	"math"
+)
+
+// Texture coordinate of a vertex
+type TexCoord struct {
+	U, V float64
+}
+
+type Triangle struct {
+	V0, V1, V2 vec3.Point3
+	// Per-vertex normals for smooth shading. Leave all three zero to shade
+	// with the flat face normal.
+	N0, N1, N2 vec3.Vec3
+	// Per-vertex texture coordinates. Leave all three zero to use the
+	// barycentric coordinates of the hit instead.
+	UV0, UV1, UV2 TexCoord
+	Mat           Material
+}
+
+const triangleEpsilon = 1e-12
+
+func (tri Triangle) hasNormals() bool {
+	return !(tri.N0.NearZero() && tri.N1.NearZero() && tri.N2.NearZero())
+}
+
+func (tri Triangle) hasUVs() bool {
+	var zero TexCoord
+	return tri.UV0 != zero || tri.UV1 != zero || tri.UV2 != zero
+}
+
+// Möller–Trumbore ray/triangle intersection
+func (tri Triangle) Hit(r *vec3.Ray, ray_t interval.Interval, rec *HitRecord) bool {
+	edge1 := *tri.V1.Subtract(tri.V0)
+	edge2 := *tri.V2.Subtract(tri.V0)
+	direction := r.GetDirection()
+
+	pvec := direction.Cross(edge2)
+	det := edge1.Dot(*pvec)
+	if math.Abs(det) < triangleEpsilon {
+		// Ray is parallel to the triangle's plane
+		return false
+	}
+	inv_det := 1.0 / det
+
+	tvec := r.GetOrigin().Subtract(tri.V0)
+	u := tvec.Dot(*pvec) * inv_det
+	if u < 0 || u > 1 {
+		return false
+	}
+
+	qvec := tvec.Cross(edge1)
+	v := direction.Dot(*qvec) * inv_det
+	if v < 0 || u+v > 1 {
+		return false
+	}
+
+	t := edge2.Dot(*qvec) * inv_det
+	if !ray_t.Surrounds(t) {
+		return false
+	}
+
+	(*rec).T = t
+	(*rec).P = r.At(t)
+	(*rec).Mat = tri.Mat
+
+	// Decide the facing with the true geometric normal, then swap in the
+	// interpolated shading normal (flipped to the same side) if we have one
+	outwardNormal := *edge1.Cross(edge2).UnitVector()
+	(*rec).SetFaceNormal(r, &outwardNormal)
+	w := 1 - u - v
+	if tri.hasNormals() {
+		shading := *tri.N0.MultiplyFloat(w).Add(*tri.N1.MultiplyFloat(u)).Add(*tri.N2.MultiplyFloat(v)).UnitVector()
+		if !rec.FrontFace {
+			shading = shading.Negate()
+		}
+		(*rec).Normal = shading
+	}
+
+	if tri.hasUVs() {
+		(*rec).U = w*tri.UV0.U + u*tri.UV1.U + v*tri.UV2.U
+		(*rec).V = w*tri.UV0.V + u*tri.UV1.V + v*tri.UV2.V
+	} else {
+		(*rec).U = u
+		(*rec).V = v
+	}
+
+	return true
+}
+
+func (tri Triangle) BoundingBox() AABB {
+	return EnclosingAABB(NewAABBFromPoints(tri.V0, tri.V1), NewAABBFromPoints(tri.V0, tri.V2))
+}
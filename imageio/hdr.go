@@ -0,0 +1,78 @@
+package imageio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"go-tracer/src/framebuffer"
+	"io"
+	"math"
+	"os"
+)
+
+// Encode the framebuffer's linear radiance without tone mapping, so nothing
+// brighter than 1 is lost
+func EncodeHDR(w io.Writer, fb *framebuffer.Framebuffer, format Format) error {
+	switch format {
+	case PFM:
+		return EncodePFM(w, fb)
+	case RadianceHDR:
+		return EncodeRGBE(w, fb)
+	}
+	return fmt.Errorf("%v is not an HDR format", format)
+}
+
+// Like Save, for the HDR formats
+func SaveHDR(path string, fb *framebuffer.Framebuffer, format Format) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := EncodeHDR(f, fb, format); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Write a colour PFM: little-endian float32 RGB, rows from the bottom up
+func EncodePFM(w io.Writer, fb *framebuffer.Framebuffer) error {
+	bw := bufio.NewWriter(w)
+	// A negative scale marks the data as little-endian
+	fmt.Fprintf(bw, "PF\n%d %d\n-1.0\n", fb.Width, fb.Height)
+
+	row := make([]byte, 12*fb.Width)
+	for j := fb.Height - 1; j >= 0; j-- {
+		for i := 0; i < fb.Width; i++ {
+			c := fb.At(i, j)
+			binary.LittleEndian.PutUint32(row[12*i:], math.Float32bits(float32(c.X)))
+			binary.LittleEndian.PutUint32(row[12*i+4:], math.Float32bits(float32(c.Y)))
+			binary.LittleEndian.PutUint32(row[12*i+8:], math.Float32bits(float32(c.Z)))
+		}
+		bw.Write(row)
+	}
+	return bw.Flush()
+}
+
+// Write a Radiance .hdr file with uncompressed scanlines
+func EncodeRGBE(w io.Writer, fb *framebuffer.Framebuffer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n\n-Y %d +X %d\n", fb.Height, fb.Width)
+
+	for j := 0; j < fb.Height; j++ {
+		for i := 0; i < fb.Width; i++ {
+			c := fb.At(i, j)
+			r, g, b := math.Max(c.X, 0), math.Max(c.Y, 0), math.Max(c.Z, 0)
+			brightest := math.Max(r, math.Max(g, b))
+			if brightest < 1e-32 {
+				bw.Write([]byte{0, 0, 0, 0})
+				continue
+			}
+			// Share the exponent of the brightest channel
+			mantissa, exponent := math.Frexp(brightest)
+			scale := mantissa * 256 / brightest
+			bw.Write([]byte{byte(r * scale), byte(g * scale), byte(b * scale), byte(exponent + 128)})
+		}
+	}
+	return bw.Flush()
+}
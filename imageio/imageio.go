@@ -0,0 +1,125 @@
+package imageio
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type Format int
+
+const (
+	PNG      Format = iota
+	PPM             // binary PPM (P6)
+	PPMPlain        // ASCII PPM (P3), one pixel per line
+	JPEG
+	PFM         // portable float map, 32-bit float per channel
+	RadianceHDR // Radiance RGBE (.hdr), 8-bit mantissas with a shared exponent
+)
+
+const jpegQuality = 95
+
+func (f Format) String() string {
+	switch f {
+	case PNG:
+		return "PNG"
+	case PPM:
+		return "PPM (P6)"
+	case PPMPlain:
+		return "PPM (P3)"
+	case JPEG:
+		return "JPEG"
+	case PFM:
+		return "PFM"
+	case RadianceHDR:
+		return "Radiance HDR"
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// Whether the format stores linear radiance (written with EncodeHDR) rather
+// than 8-bit display colors
+func (f Format) HDR() bool {
+	return f == PFM || f == RadianceHDR
+}
+
+// Pick an output format from a file extension. PPM files are written in the
+// binary P6 flavour; use PPMPlain explicitly for P3.
+func FormatFromPath(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png":
+		return PNG, nil
+	case ".ppm":
+		return PPM, nil
+	case ".jpg", ".jpeg":
+		return JPEG, nil
+	case ".pfm":
+		return PFM, nil
+	case ".hdr":
+		return RadianceHDR, nil
+	case ".exr":
+		return 0, fmt.Errorf("OpenEXR output is not supported, use .hdr or .pfm for HDR images")
+	}
+	return 0, fmt.Errorf("unsupported image extension %q (want .png, .ppm, .jpg, .jpeg, .pfm or .hdr)", filepath.Ext(path))
+}
+
+func Encode(w io.Writer, img image.Image, format Format) error {
+	switch format {
+	case PNG:
+		return png.Encode(w, img)
+	case PPM:
+		return EncodePPM(w, img, false)
+	case PPMPlain:
+		return EncodePPM(w, img, true)
+	case JPEG:
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: jpegQuality})
+	}
+	if format.HDR() {
+		return fmt.Errorf("%v needs linear radiance, use EncodeHDR", format)
+	}
+	return fmt.Errorf("unknown image format %v", format)
+}
+
+// Encode an image to the given path, creating or truncating the file
+func Save(path string, img image.Image, format Format) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := Encode(f, img, format); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Write a PPM image with a max value of 255, either binary (P6) or plain text (P3)
+func EncodePPM(w io.Writer, img image.Image, plain bool) error {
+	bw := bufio.NewWriter(w)
+	bounds := img.Bounds()
+
+	magic := "P6"
+	if plain {
+		magic = "P3"
+	}
+	fmt.Fprintf(bw, "%s\n%d %d\n255\n", magic, bounds.Dx(), bounds.Dy())
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			// RGBA() returns 16-bit channels
+			r, g, b, _ := img.At(x, y).RGBA()
+			if plain {
+				fmt.Fprintf(bw, "%d %d %d\n", r>>8, g>>8, b>>8)
+			} else {
+				bw.Write([]byte{byte(r >> 8), byte(g >> 8), byte(b >> 8)})
+			}
+		}
+	}
+	return bw.Flush()
+}
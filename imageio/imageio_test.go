@@ -0,0 +1,150 @@
+package imageio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"go-tracer/src/framebuffer"
+	"go-tracer/src/texture"
+	"go-tracer/src/vec3"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testImage() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.SetRGBA(0, 0, color.RGBA{R: 255, G: 0, B: 10, A: 255})
+	img.SetRGBA(1, 0, color.RGBA{R: 1, G: 2, B: 3, A: 255})
+	return img
+}
+
+func TestFormatFromPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want Format
+	}{
+		{"out.png", PNG},
+		{"images/out.PPM", PPM},
+		{"out.jpg", JPEG},
+		{"out.jpeg", JPEG},
+		{"out.pfm", PFM},
+		{"render.HDR", RadianceHDR},
+	}
+	for _, tt := range tests {
+		got, err := FormatFromPath(tt.path)
+		if err != nil || got != tt.want {
+			t.Errorf("FormatFromPath(%q) = %v, %v; want %v", tt.path, got, err, tt.want)
+		}
+	}
+
+	if _, err := FormatFromPath("out.gif"); err == nil {
+		t.Errorf("Expected an error for an unsupported extension")
+	}
+	if _, err := FormatFromPath("out.exr"); err == nil || !strings.Contains(err.Error(), "OpenEXR") {
+		t.Errorf("Expected a clear error for OpenEXR, got %v", err)
+	}
+}
+
+func TestEncodePPM(t *testing.T) {
+	var plain bytes.Buffer
+	if err := EncodePPM(&plain, testImage(), true); err != nil {
+		t.Fatalf("EncodePPM() returned error: %v", err)
+	}
+	if got, want := plain.String(), "P3\n2 1\n255\n255 0 10\n1 2 3\n"; got != want {
+		t.Errorf("Plain PPM = %q, want %q", got, want)
+	}
+
+	var binary bytes.Buffer
+	if err := EncodePPM(&binary, testImage(), false); err != nil {
+		t.Fatalf("EncodePPM() returned error: %v", err)
+	}
+	want := append([]byte("P6\n2 1\n255\n"), 255, 0, 10, 1, 2, 3)
+	if !bytes.Equal(binary.Bytes(), want) {
+		t.Errorf("Binary PPM = %v, want %v", binary.Bytes(), want)
+	}
+}
+
+func TestSavePNGRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.png")
+	if err := Save(path, testImage(), PNG); err != nil {
+		t.Fatalf("Save() returned error: %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	decoded, err := png.Decode(f)
+	if err != nil {
+		t.Fatalf("Decoding saved PNG: %v", err)
+	}
+	r, g, b, _ := decoded.At(0, 0).RGBA()
+	if r>>8 != 255 || g>>8 != 0 || b>>8 != 10 {
+		t.Errorf("Round-tripped pixel = (%d, %d, %d), want (255, 0, 10)", r>>8, g>>8, b>>8)
+	}
+}
+
+func hdrTestFramebuffer() *framebuffer.Framebuffer {
+	fb := framebuffer.New(3, 2)
+	fb.Set(0, 0, vec3.Vec3{X: 12.5, Y: 0.5, Z: 0})
+	fb.Set(2, 0, vec3.Vec3{X: 0.001, Y: 0.002, Z: 0.003})
+	fb.Set(1, 1, vec3.Vec3{X: 1000, Y: 250, Z: 1})
+	return fb
+}
+
+func TestEncodePFM(t *testing.T) {
+	fb := hdrTestFramebuffer()
+	var buf bytes.Buffer
+	if err := EncodeHDR(&buf, fb, PFM); err != nil {
+		t.Fatalf("EncodeHDR() returned error: %v", err)
+	}
+
+	header := "PF\n3 2\n-1.0\n"
+	if !strings.HasPrefix(buf.String(), header) {
+		t.Fatalf("Unexpected header: %q", buf.String()[:len(header)])
+	}
+	data := buf.Bytes()[len(header):]
+	if len(data) != 3*2*12 {
+		t.Fatalf("Got %d bytes of pixels, want %d", len(data), 3*2*12)
+	}
+	// Rows are stored bottom up, so the top-left pixel starts the second row
+	red := math.Float32frombits(binary.LittleEndian.Uint32(data[3*12:]))
+	if red != 12.5 {
+		t.Errorf("Top-left red = %v, want 12.5", red)
+	}
+	bright := math.Float32frombits(binary.LittleEndian.Uint32(data[12:]))
+	if bright != 1000 {
+		t.Errorf("Bottom-middle red = %v, want 1000", bright)
+	}
+}
+
+func TestEncodeRGBERoundTrip(t *testing.T) {
+	fb := hdrTestFramebuffer()
+	path := filepath.Join(t.TempDir(), "out.hdr")
+	if err := SaveHDR(path, fb, RadianceHDR); err != nil {
+		t.Fatalf("SaveHDR() returned error: %v", err)
+	}
+
+	img, err := texture.LoadHDR(path)
+	if err != nil {
+		t.Fatalf("LoadHDR() returned error: %v", err)
+	}
+	for idx, want := range fb.Pixels {
+		got := img.Pixels[idx]
+		// RGBE keeps about 8 bits of precision relative to the brightest channel
+		tolerance := 0.01 * math.Max(want.X, math.Max(want.Y, want.Z))
+		if math.Abs(got.X-want.X) > tolerance || math.Abs(got.Y-want.Y) > tolerance || math.Abs(got.Z-want.Z) > tolerance {
+			t.Errorf("Pixel %d = %v, want %v", idx, got, want)
+		}
+	}
+
+	if err := Encode(&bytes.Buffer{}, fb.Image(), PFM); err == nil {
+		t.Errorf("Expected Encode to refuse an 8-bit image for an HDR format")
+	}
+}
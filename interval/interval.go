@@ -1,6 +1,9 @@
 package interval
 
-import "go-tracer/src/utils"
+import (
+	"go-tracer/src/utils"
+	"math"
+)
 
 type Interval struct {
 	Min float64
@@ -25,5 +28,20 @@ func (i *Interval) Clamp(value float64) float64 {
 	return value
 }
 
+func (i *Interval) Size() float64 {
+	return i.Max - i.Min
+}
+
+// Expand pads the interval by delta, split evenly on both ends
+func (i *Interval) Expand(delta float64) Interval {
+	padding := delta / 2
+	return Interval{Min: i.Min - padding, Max: i.Max + padding}
+}
+
+// Enclosing returns the tightest interval containing both a and b
+func Enclosing(a, b Interval) Interval {
+	return Interval{Min: math.Min(a.Min, b.Min), Max: math.Max(a.Max, b.Max)}
+}
+
 var EmptyInterval Interval = Interval{Min: utils.INFINITY, Max: -utils.INFINITY}
 var UniverseInterval Interval = Interval{Min: -utils.INFINITY, Max: utils.INFINITY}
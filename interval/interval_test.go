@@ -32,3 +32,20 @@ func Test(t *testing.T) {
 		t.Errorf("interval.Clamp(0.0) = %f; expected %f", resultClamp, expectedClamp)
 	}
 }
+
+func TestExpandAndEnclosing(t *testing.T) {
+	interval := Interval{Min: 1.0, Max: 3.0}
+
+	expanded := interval.Expand(2.0)
+	if expanded.Min != 0.0 || expanded.Max != 4.0 {
+		t.Errorf("interval.Expand(2.0) = %v; expected {0 4}", expanded)
+	}
+
+	enclosing := Enclosing(interval, Interval{Min: -1.0, Max: 2.0})
+	if enclosing.Min != -1.0 || enclosing.Max != 3.0 {
+		t.Errorf("Enclosing() = %v; expected {-1 3}", enclosing)
+	}
+	if enclosing.Size() != 4.0 {
+		t.Errorf("enclosing.Size() = %f; expected 4", enclosing.Size())
+	}
+}
@@ -1,70 +1,226 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"go-tracer/src/camera"
+	"go-tracer/src/denoise"
+	"go-tracer/src/filter"
+	"go-tracer/src/framebuffer"
 	"go-tracer/src/hittable"
-	"go-tracer/src/vec3"
+	"go-tracer/src/imageio"
+	"go-tracer/src/preview"
+	"go-tracer/src/sampler"
+	"go-tracer/src/scene"
 	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
-func setupWorld() hittable.HittableList {
-	var world hittable.HittableList
-	material_ground := hittable.Lambertian{Albedo: vec3.Vec3{X: 0.8, Y: 0.8, Z: 0.0}}
-	material_center := hittable.Lambertian{Albedo: vec3.Vec3{X: 0.1, Y: 0.2, Z: 0.5}}
-	material_left := hittable.Dielectric{Ir: 1.5}
-	material_right := hittable.Metal{Albedo: vec3.Vec3{X: 0.8, Y: 0.6, Z: 0.2}, Fuzz: 0.0}
-
-	world.Append(hittable.Sphere{Center: vec3.Point3{X: 0, Y: -100.5, Z: -1}, Radius: 100, Mat: material_ground})
-	world.Append(hittable.Sphere{Center: vec3.Point3{X: 0, Y: 0, Z: -1}, Radius: 0.5, Mat: material_center})
-	world.Append(hittable.Sphere{Center: vec3.Point3{X: -1, Y: 0, Z: -1}, Radius: 0.5, Mat: material_left})
-	world.Append(hittable.Sphere{Center: vec3.Point3{X: -1, Y: 0, Z: -1}, Radius: -0.4, Mat: material_left})
-	world.Append(hittable.Sphere{Center: vec3.Point3{X: 1, Y: 0, Z: -1}, Radius: 0.5, Mat: material_right})
-
-	return world
-}
-
-func setupCamera() camera.Camera {
-	var cam camera.Camera
-	cam.AspectRatio = 16.0 / 9.0
-	cam.ImageWidth = 1200
-	cam.SamplesPerPixel = 500
-	cam.MaxDepth = 50
-
-	cam.VFOV = 20.0
-	cam.LookFrom = vec3.Point3{X: 13, Y: 2, Z: 3}
-	cam.LookAt = vec3.Point3{X: 0, Y: 0, Z: 0}
-	cam.ViewUp = vec3.Vec3{X: 0, Y: 1, Z: 0}
-	cam.DefocusAngle = 0.6
-	cam.FocusDistance = 10.0
-
-	return cam
-}
-
 func main() {
 	// Command line flags
 	multiThread := flag.Bool("multi", true, "Use multi-threaded rendering")
+	scenePath := flag.String("scene", "scenes/default.json", "Path to a JSON scene description")
+	outputPath := flag.String("o", "out.png", "Output image (.png, .ppm, .jpg, or .pfm/.hdr for raw radiance), or - for a plain PPM on stdout")
+	workers := flag.Int("workers", 0, "Number of render goroutines for multi-threaded mode (0 = one per CPU)")
+	seed := flag.Int64("seed", 0, "Random seed; the same seed gives the same image for any number of workers")
+	progressive := flag.Bool("progressive", false, "Render in passes, refining the whole image each pass")
+	passSamples := flag.Int("pass-samples", 1, "Samples per pixel added by each progressive pass")
+	previewAddr := flag.String("preview", "", "Serve a live preview on this address, e.g. localhost:8080 (implies -progressive)")
+	plainPPM := flag.Bool("ppm-plain", false, "Write .ppm output as ASCII (P3) instead of binary (P6)")
+	toneMap := flag.String("tonemap", "clamp", "Tone mapper for 8-bit output and the preview: clamp, reinhard or aces")
+	exposure := flag.Float64("exposure", 0, "Exposure adjustment in stops before tone mapping")
+	denoiseImage := flag.Bool("denoise", false, "Denoise the image and the live preview, guided by albedo and normal AOVs")
+	writeAOVs := flag.Bool("aovs", false, "Also write AOVs (albedo, normal, depth, position, material and object IDs) next to the output, e.g. out_depth.png")
+	noiseThreshold := flag.Float64("noise-threshold", 0, "Adaptive sampling: stop a pixel once its noise is below this fraction of its brightness, e.g. 0.01 (0 = always take every sample)")
+	minSamples := flag.Int("min-samples", 0, "Adaptive sampling: samples each pixel takes before it may stop (0 = 16)")
+	heatmapPath := flag.String("heatmap", "", "Adaptive sampling: also write an image of the samples each pixel took, blue (few) to red (all)")
+	samplerName := flag.String("sampler", "independent", "How each pixel's samples are spread: independent, stratified, halton or sobol")
+	filterName := flag.String("filter", "box", "Pixel reconstruction filter: box, tent, gaussian, mitchell or lanczos")
+	filterRadius := flag.Float64("filter-radius", 0, "Filter radius in pixels (0 = the filter's default: box 0.5, tent 1, gaussian 1.5, mitchell and lanczos 2)")
+	timeLimit := flag.Duration("time-limit", 0, "Stop rendering after this long and write whatever is finished, e.g. 90s or 5m (0 = no limit)")
 	flag.Parse()
 
+	toneMapper, err := framebuffer.ParseToneMapper(*toneMap)
+	if err != nil {
+		log.Fatalf("Tone mapping: %v", err)
+	}
+	samplerKind, err := sampler.ParseKind(*samplerName)
+	if err != nil {
+		log.Fatalf("Sampler: %v", err)
+	}
+	filterKind, err := filter.ParseKind(*filterName)
+	if err != nil {
+		log.Fatalf("Filter: %v", err)
+	}
+
+	if *heatmapPath != "" && *noiseThreshold <= 0 {
+		log.Fatalf("Heatmap: -heatmap needs adaptive sampling, set -noise-threshold")
+	}
+	var heatmapFormat imageio.Format
+	if *heatmapPath != "" {
+		if heatmapFormat, err = imageio.FormatFromPath(*heatmapPath); err != nil {
+			log.Fatalf("Heatmap: %v", err)
+		}
+	}
+
+	// Pick the output format up front so a typo doesn't cost a whole render
+	format := imageio.PPMPlain
+	if *outputPath != "-" {
+		if format, err = imageio.FormatFromPath(*outputPath); err != nil {
+			log.Fatalf("Output: %v", err)
+		}
+		if format == imageio.PPM && *plainPPM {
+			format = imageio.PPMPlain
+		}
+	} else if *writeAOVs {
+		log.Fatalf("Output: -aovs needs an output file to name the AOV images after")
+	}
+
 	// Setup scene
-	world := setupWorld()
-	cam := setupCamera()
+	s, err := scene.Load(*scenePath)
+	if err != nil {
+		log.Fatalf("Loading scene: %v", err)
+	}
+	objects := s.World
+	if *writeAOVs {
+		// Number the scene's objects for the object ID AOV
+		objects = hittable.TagObjects(objects)
+	}
+	world := hittable.NewBVH(objects)
+	cam := s.Camera
+	cam.Workers = *workers
+	cam.Seed = *seed
+	cam.SamplesPerPass = *passSamples
+	cam.RecordAOVs = *denoiseImage || *writeAOVs
+	cam.NoiseThreshold = *noiseThreshold
+	cam.MinSamples = *minSamples
+	cam.Sampler = samplerKind
+	cam.Filter = filter.Filter{Kind: filterKind, Radius: *filterRadius}
+
+	var server *preview.Server
+	if *previewAddr != "" {
+		*progressive = true
+		server = preview.NewServer()
+		server.ToneMapper = toneMapper
+		server.Exposure = *exposure
+		go func() {
+			log.Fatal(http.ListenAndServe(*previewAddr, server.Handler()))
+		}()
+		log.Printf("Live preview at http://%s/", *previewAddr)
+	}
+
+	ctx := context.Background()
+	if *timeLimit > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeLimit)
+		defer cancel()
+	}
 
 	// Time the rendering
 	start := time.Now()
 
 	// Render based on flag
-	if *multiThread {
+	var fb *framebuffer.Framebuffer
+	var mode string
+	switch {
+	case *progressive:
+		mode = "Progressive"
+		log.Printf("Starting progressive render...")
+		fb, err = cam.RenderProgressiveContext(ctx, world, func(fb *framebuffer.Framebuffer, samples int) bool {
+			if server == nil {
+				return true
+			}
+			if *denoiseImage {
+				fb = denoised(fb, cam.AOVs)
+			}
+			if err := server.Update(fb, samples, cam.SamplesPerPixel); err != nil {
+				log.Printf("Updating preview: %v", err)
+			}
+			return !server.StopRequested()
+		})
+	case *multiThread:
+		mode = "Multi-threaded"
 		log.Printf("Starting multi-threaded render...")
-		cam.RenderMulti(&world)
-	} else {
+		fb, err = cam.RenderMultiContext(ctx, world)
+	default:
+		mode = "Single-threaded"
 		log.Printf("Starting single-threaded render...")
-		cam.RenderSingle(&world)
+		fb, err = cam.RenderSingleContext(ctx, world)
+	}
+	if server != nil {
+		server.Finish()
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		log.Printf("Time limit of %v reached, keeping the partial image", *timeLimit)
+		err = nil
+	}
+	if err != nil {
+		log.Fatalf("Rendering: %v", err)
+	}
+	if *denoiseImage {
+		fb = denoised(fb, cam.AOVs)
 	}
 
 	// Calculate and display render time
 	duration := time.Since(start)
 	log.Printf("\nRendering completed in: %v", duration)
-	log.Printf("Mode: %s", map[bool]string{true: "Multi-threaded", false: "Single-threaded"}[*multiThread])
+	log.Printf("Mode: %s", mode)
+
+	if *outputPath == "-" {
+		err = imageio.Encode(os.Stdout, fb.ToneMapped(toneMapper, *exposure), format)
+	} else {
+		err = save(*outputPath, fb, format, toneMapper, *exposure)
+	}
+	if err != nil {
+		log.Fatalf("Writing image: %v", err)
+	}
+	log.Printf("Wrote %s image to %s", format, *outputPath)
+
+	if *heatmapPath != "" {
+		if err := save(*heatmapPath, cam.SampleHeatmap(), heatmapFormat, framebuffer.Clamp, 0); err != nil {
+			log.Fatalf("Writing heatmap: %v", err)
+		}
+		log.Printf("Wrote sample heatmap to %s", *heatmapPath)
+	}
+
+	if *writeAOVs {
+		for _, layer := range cam.AOVs.Layers() {
+			path := aovPath(*outputPath, layer.Name)
+			aov := layer.FB
+			if !format.HDR() {
+				aov = layer.Display()
+			}
+			if err := save(path, aov, format, framebuffer.Clamp, 0); err != nil {
+				log.Fatalf("Writing %s AOV: %v", layer.Name, err)
+			}
+			log.Printf("Wrote %s AOV to %s", layer.Name, path)
+		}
+	}
+}
+
+func save(path string, fb *framebuffer.Framebuffer, format imageio.Format, toneMapper framebuffer.ToneMapper, exposure float64) error {
+	if format.HDR() {
+		return imageio.SaveHDR(path, fb, format)
+	}
+	return imageio.Save(path, fb.ToneMapped(toneMapper, exposure), format)
+}
+
+func denoised(fb *framebuffer.Framebuffer, aovs *camera.AOVs) *framebuffer.Framebuffer {
+	out, err := denoise.Denoise(fb, aovs.Albedo, aovs.Normal, denoise.Default)
+	if err != nil {
+		log.Fatalf("Denoising: %v", err)
+	}
+	return out
+}
+
+// out.png -> out_albedo.png
+func aovPath(output, name string) string {
+	ext := filepath.Ext(output)
+	return strings.TrimSuffix(output, ext) + "_" + name + ext
 }
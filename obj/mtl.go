@@ -0,0 +1,175 @@
+package obj
+
+import (
+	"bufio"
+	"fmt"
+	"go-tracer/src/hittable"
+	"go-tracer/src/vec3"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// The subset of an MTL material we use to pick one of our materials
+type mtlMaterial struct {
+	kd, ks       vec3.Vec3
+	ns, ni, d    float64
+	pr, pm       float64 // roughness and metallic from the PBR extension
+	illum        int
+	hasKs, hasNi bool
+	hasPBR       bool
+}
+
+// Parse an MTL library, mapping each material onto the closest of ours:
+//   - materials using the PBR extension (Pr roughness, Pm metallic) become
+//     Principled, refracting by 1 - d if they are transparent
+//   - transparent materials (d < 1, or illum 4, 6, 7 or 9) become Dielectric with Ni as the index
+//   - reflective materials (illum 3, or illum 5 and 8) become Metal, tinted by Ks,
+//     with the specular exponent Ns turned into fuzz
+//   - everything else becomes Lambertian with Kd as the albedo
+func ParseMTL(r io.Reader, name string) (map[string]hittable.Material, error) {
+	materials := make(map[string]hittable.Material)
+	var current *mtlMaterial
+	var currentName string
+
+	finish := func() {
+		if current != nil {
+			materials[currentName] = current.material()
+		}
+	}
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		errorf := func(format string, args ...any) error {
+			return fmt.Errorf("%s:%d: %s", name, line, fmt.Sprintf(format, args...))
+		}
+
+		if fields[0] == "newmtl" {
+			if len(fields) < 2 {
+				return nil, errorf("newmtl without a name")
+			}
+			finish()
+			current = &mtlMaterial{kd: vec3.Vec3{X: 0.8, Y: 0.8, Z: 0.8}, d: 1, ni: 1.5}
+			currentName = fields[1]
+			continue
+		}
+		if current == nil {
+			// Statements before the first newmtl have nothing to apply to
+			continue
+		}
+
+		var err error
+		switch fields[0] {
+		case "Kd":
+			current.kd, err = parseColor(fields[1:])
+		case "Ks":
+			current.ks, err = parseColor(fields[1:])
+			current.hasKs = true
+		case "Ns":
+			current.ns, err = parseScalar(fields[1:])
+		case "Ni":
+			current.ni, err = parseScalar(fields[1:])
+			current.hasNi = true
+		case "d":
+			current.d, err = parseScalar(fields[1:])
+		case "Tr":
+			var tr float64
+			tr, err = parseScalar(fields[1:])
+			current.d = 1 - tr
+		case "Pr":
+			current.pr, err = parseFraction(fields[1:])
+			current.hasPBR = true
+		case "Pm":
+			current.pm, err = parseFraction(fields[1:])
+			current.hasPBR = true
+		case "illum":
+			var illum float64
+			illum, err = parseScalar(fields[1:])
+			current.illum = int(illum)
+		}
+		if err != nil {
+			return nil, errorf("%s: %v", fields[0], err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	finish()
+	return materials, nil
+}
+
+func (m *mtlMaterial) material() hittable.Material {
+	ir := 1.5
+	if m.hasNi && m.ni > 0 {
+		ir = m.ni
+	}
+
+	switch {
+	case m.hasPBR:
+		return hittable.Principled{
+			BaseColor:    m.kd,
+			Roughness:    m.pr,
+			Metallic:     m.pm,
+			Specular:     0.5,
+			Transmission: 1 - m.d,
+			IOR:          ir,
+		}
+	case m.d < 1 || m.illum == 4 || m.illum == 6 || m.illum == 7 || m.illum == 9:
+		return hittable.Dielectric{Ir: ir}
+	case m.illum == 3 || m.illum == 5 || m.illum == 8:
+		albedo := m.kd
+		if m.hasKs && !m.ks.NearZero() {
+			albedo = m.ks
+		}
+		// Blinn-Phong exponent to roughness, as commonly done when converting to PBR
+		fuzz := math.Min(math.Sqrt(2/(m.ns+2)), 1)
+		return hittable.Metal{Albedo: albedo, Fuzz: fuzz}
+	}
+	return hittable.Lambertian{Albedo: m.kd}
+}
+
+func parseScalar(fields []string) (float64, error) {
+	if len(fields) < 1 {
+		return 0, fmt.Errorf("missing value")
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+// Parse a scalar that has to lie in [0, 1], like roughness or metallic
+func parseFraction(fields []string) (float64, error) {
+	value, err := parseScalar(fields)
+	if err != nil {
+		return 0, err
+	}
+	if value < 0 || value > 1 {
+		return 0, fmt.Errorf("must be between 0 and 1, got %v", value)
+	}
+	return value, nil
+}
+
+// Parse "r g b", or a single value used for all three channels
+func parseColor(fields []string) (vec3.Vec3, error) {
+	if len(fields) < 1 {
+		return vec3.Vec3{}, fmt.Errorf("missing value")
+	}
+	values := make([]float64, 3)
+	for i := range values {
+		field := fields[0]
+		if i < len(fields) {
+			field = fields[i]
+		}
+		value, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return vec3.Vec3{}, err
+		}
+		values[i] = value
+	}
+	return vec3.Vec3{X: values[0], Y: values[1], Z: values[2]}, nil
+}
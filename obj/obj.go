@@ -0,0 +1,263 @@
+// Package obj loads Wavefront OBJ meshes and their MTL material libraries.
+package obj
+
+import (
+	"bufio"
+	"fmt"
+	"go-tracer/src/hittable"
+	"go-tracer/src/vec3"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Load an OBJ file as a single mesh. Polygons are fan-triangulated, material
+// libraries are resolved relative to the OBJ file, and faces without a
+// usemtl statement get defaultMat.
+func Load(path string, defaultMat hittable.Material) (*hittable.Mesh, error) {
+	return LoadWith(path, defaultMat, nil)
+}
+
+// Load, passing each MTL material through useMaterial (if not nil) the first
+// time a usemtl statement picks it, e.g. to tag it with an ID
+func LoadWith(path string, defaultMat hittable.Material, useMaterial func(name string, mat hittable.Material) hittable.Material) (*hittable.Mesh, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	p := parser{
+		name:        path,
+		dir:         filepath.Dir(path),
+		materials:   make(map[string]hittable.Material),
+		used:        make(map[string]hittable.Material),
+		useMaterial: useMaterial,
+		currentMat:  defaultMat,
+	}
+	if err := p.parse(f); err != nil {
+		return nil, err
+	}
+	if len(p.triangles) == 0 {
+		return nil, fmt.Errorf("%s: no faces", path)
+	}
+	return hittable.NewMesh(p.triangles), nil
+}
+
+type parser struct {
+	name string
+	dir  string
+	line int
+
+	positions []vec3.Point3
+	normals   []vec3.Vec3
+	texcoords []hittable.TexCoord
+	triangles []hittable.Triangle
+
+	materials   map[string]hittable.Material
+	used        map[string]hittable.Material // materials picked by usemtl, after useMaterial
+	useMaterial func(name string, mat hittable.Material) hittable.Material
+	currentMat  hittable.Material
+}
+
+// One corner of a face: indices into positions, texcoords and normals (-1 if absent)
+type corner struct {
+	v, vt, vn int
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%s:%d: %s", p.name, p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) parse(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		p.line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		var err error
+		switch fields[0] {
+		case "v":
+			var v vec3.Vec3
+			if v, err = p.parseVec(fields[1:]); err == nil {
+				p.positions = append(p.positions, v)
+			}
+		case "vn":
+			var v vec3.Vec3
+			if v, err = p.parseVec(fields[1:]); err == nil {
+				p.normals = append(p.normals, v)
+			}
+		case "vt":
+			var uv hittable.TexCoord
+			if uv, err = p.parseTexCoord(fields[1:]); err == nil {
+				p.texcoords = append(p.texcoords, uv)
+			}
+		case "f":
+			err = p.parseFace(fields[1:])
+		case "mtllib":
+			for _, lib := range fields[1:] {
+				if err = p.loadMaterialLibrary(filepath.Join(p.dir, lib)); err != nil {
+					break
+				}
+			}
+		case "usemtl":
+			if len(fields) < 2 {
+				return p.errorf("usemtl without a material name")
+			}
+			mat, ok := p.used[fields[1]]
+			if !ok {
+				if mat, ok = p.materials[fields[1]]; !ok {
+					return p.errorf("unknown material %q", fields[1])
+				}
+				if p.useMaterial != nil {
+					mat = p.useMaterial(fields[1], mat)
+				}
+				p.used[fields[1]] = mat
+			}
+			p.currentMat = mat
+		default:
+			// Groups, objects, smoothing groups, lines etc. don't affect rendering
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func (p *parser) parseFloats(fields []string, min int) ([]float64, error) {
+	if len(fields) < min {
+		return nil, p.errorf("expected at least %d numbers, got %d", min, len(fields))
+	}
+	values := make([]float64, len(fields))
+	for i, field := range fields {
+		value, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil, p.errorf("bad number %q", field)
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+func (p *parser) parseVec(fields []string) (vec3.Vec3, error) {
+	values, err := p.parseFloats(fields, 3)
+	if err != nil {
+		return vec3.Vec3{}, err
+	}
+	return vec3.Vec3{X: values[0], Y: values[1], Z: values[2]}, nil
+}
+
+func (p *parser) parseTexCoord(fields []string) (hittable.TexCoord, error) {
+	values, err := p.parseFloats(fields, 1)
+	if err != nil {
+		return hittable.TexCoord{}, err
+	}
+	uv := hittable.TexCoord{U: values[0]}
+	if len(values) > 1 {
+		uv.V = values[1]
+	}
+	return uv, nil
+}
+
+// Resolve a 1-based (or negative, counting back from the end) OBJ index
+func (p *parser) resolveIndex(field string, count int, kind string) (int, error) {
+	index, err := strconv.Atoi(field)
+	if err != nil {
+		return 0, p.errorf("bad %s index %q", kind, field)
+	}
+	if index < 0 {
+		index += count
+	} else {
+		index--
+	}
+	if index < 0 || index >= count {
+		return 0, p.errorf("%s index %s out of range (have %d)", kind, field, count)
+	}
+	return index, nil
+}
+
+// Parse v, v/vt, v//vn or v/vt/vn
+func (p *parser) parseCorner(field string) (corner, error) {
+	parts := strings.Split(field, "/")
+	c := corner{v: -1, vt: -1, vn: -1}
+	var err error
+
+	if c.v, err = p.resolveIndex(parts[0], len(p.positions), "vertex"); err != nil {
+		return c, err
+	}
+	if len(parts) > 1 && parts[1] != "" {
+		if c.vt, err = p.resolveIndex(parts[1], len(p.texcoords), "texture coordinate"); err != nil {
+			return c, err
+		}
+	}
+	if len(parts) > 2 && parts[2] != "" {
+		if c.vn, err = p.resolveIndex(parts[2], len(p.normals), "normal"); err != nil {
+			return c, err
+		}
+	}
+	return c, nil
+}
+
+func (p *parser) parseFace(fields []string) error {
+	if len(fields) < 3 {
+		return p.errorf("face needs at least 3 vertices, got %d", len(fields))
+	}
+	if p.currentMat == nil {
+		return p.errorf("face has no material (no usemtl and no default material)")
+	}
+
+	corners := make([]corner, len(fields))
+	for i, field := range fields {
+		c, err := p.parseCorner(field)
+		if err != nil {
+			return err
+		}
+		corners[i] = c
+	}
+
+	// Fan triangulation, fine for the convex polygons exporters produce
+	for i := 1; i+1 < len(corners); i++ {
+		p.triangles = append(p.triangles, p.triangle(corners[0], corners[i], corners[i+1]))
+	}
+	return nil
+}
+
+func (p *parser) triangle(a, b, c corner) hittable.Triangle {
+	tri := hittable.Triangle{
+		V0:  p.positions[a.v],
+		V1:  p.positions[b.v],
+		V2:  p.positions[c.v],
+		Mat: p.currentMat,
+	}
+	// Only use vertex attributes when every corner has them
+	if a.vn >= 0 && b.vn >= 0 && c.vn >= 0 {
+		tri.N0, tri.N1, tri.N2 = p.normals[a.vn], p.normals[b.vn], p.normals[c.vn]
+	}
+	if a.vt >= 0 && b.vt >= 0 && c.vt >= 0 {
+		tri.UV0, tri.UV1, tri.UV2 = p.texcoords[a.vt], p.texcoords[b.vt], p.texcoords[c.vt]
+	}
+	return tri
+}
+
+func (p *parser) loadMaterialLibrary(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return p.errorf("%v", err)
+	}
+	defer f.Close()
+
+	materials, err := ParseMTL(f, path)
+	if err != nil {
+		return err
+	}
+	for name, mat := range materials {
+		p.materials[name] = mat
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package obj
+
+import (
+	"go-tracer/src/hittable"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, dir, name, contents string) string {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "quad.mtl", `
+newmtl red
+Kd 0.9 0.1 0.1
+
+newmtl glass
+Ni 1.33
+d 0.5
+
+newmtl chrome
+illum 3
+Ks 0.8 0.8 0.8
+Ns 1000
+`)
+	path := writeFile(t, dir, "quad.obj", `
+# A unit quad and a triangle with smooth normals
+mtllib quad.mtl
+v 0 0 0
+v 1 0 0
+v 1 1 0
+v 0 1 0
+vt 0 0
+vt 1 0
+vt 1 1
+vt 0 1
+vn 0 0 1
+usemtl red
+f 1/1/1 2/2/1 3/3/1 4/4/1
+usemtl glass
+f -4//1 -3//1 -2//1
+f 1 2 4
+`)
+
+	mesh, err := Load(path, nil)
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if len(mesh.Triangles) != 4 {
+		t.Fatalf("Expected the quad to be split into 2 triangles plus 2 more, got %d", len(mesh.Triangles))
+	}
+
+	first := mesh.Triangles[0]
+	if red, ok := first.Mat.(hittable.Lambertian); !ok || red.Albedo.X != 0.9 {
+		t.Errorf("First face should use red Lambertian, got %+v", first.Mat)
+	}
+	if first.UV2 != (hittable.TexCoord{U: 1, V: 1}) || first.N0.Z != 1 {
+		t.Errorf("Vertex attributes not loaded: %+v", first)
+	}
+
+	glass := mesh.Triangles[2]
+	if glass.Mat != (hittable.Dielectric{Ir: 1.33}) {
+		t.Errorf("Third face should use glass, got %+v", glass.Mat)
+	}
+	if glass.V0 != first.V0 || glass.V2 != first.V2 {
+		t.Errorf("Negative indices resolved incorrectly: %+v", glass)
+	}
+	if glass.UV0 != (hittable.TexCoord{}) {
+		t.Errorf("Face without texture coordinates should have zero UVs, got %+v", glass.UV0)
+	}
+	// LoadWith passes each used material through once, in the order of use
+	var used []string
+	mesh, err = LoadWith(path, nil, func(name string, mat hittable.Material) hittable.Material {
+		used = append(used, name)
+		return hittable.TaggedMaterial{Material: mat, ID: len(used)}
+	})
+	if err != nil {
+		t.Fatalf("LoadWith() returned error: %v", err)
+	}
+	if strings.Join(used, " ") != "red glass" {
+		t.Errorf("Materials used = %v, want [red glass]", used)
+	}
+	for i, want := range []int{1, 1, 2, 2} {
+		if got := hittable.MaterialID(mesh.Triangles[i].Mat); got != want {
+			t.Errorf("Triangle %d has material ID %d, want %d", i, got, want)
+		}
+	}
+}
+
+func TestParseMTLMetal(t *testing.T) {
+	materials, err := ParseMTL(strings.NewReader("newmtl chrome\nillum 3\nKs 0.8 0.7 0.6\nNs 98\n"), "test.mtl")
+	if err != nil {
+		t.Fatalf("ParseMTL() returned error: %v", err)
+	}
+	metal, ok := materials["chrome"].(hittable.Metal)
+	if !ok {
+		t.Fatalf("Expected a Metal, got %T", materials["chrome"])
+	}
+	if metal.Albedo.Y != 0.7 || metal.Fuzz < 0.1 || metal.Fuzz > 0.2 {
+		t.Errorf("Unexpected metal: %+v", metal)
+	}
+}
+
+func TestParseMTLPBR(t *testing.T) {
+	materials, err := ParseMTL(strings.NewReader("newmtl brushed\nKd 0.9 0.6 0.2\nPr 0.35\nPm 1\n"), "test.mtl")
+	if err != nil {
+		t.Fatalf("ParseMTL() returned error: %v", err)
+	}
+	pbr, ok := materials["brushed"].(hittable.Principled)
+	if !ok {
+		t.Fatalf("Expected a Principled material, got %T", materials["brushed"])
+	}
+	if pbr.BaseColor.Y != 0.6 || pbr.Roughness != 0.35 || pbr.Metallic != 1 || pbr.Transmission != 0 {
+		t.Errorf("Unexpected material: %+v", pbr)
+	}
+
+	for _, bad := range []string{"Pm 2", "Pr -0.1"} {
+		_, err := ParseMTL(strings.NewReader("newmtl bad\n"+bad+"\n"), "test.mtl")
+		if err == nil || !strings.Contains(err.Error(), "test.mtl:2: ") || !strings.Contains(err.Error(), "between 0 and 1") {
+			t.Errorf("ParseMTL(%q) error = %v, want a range error on line 2", bad, err)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name     string
+		contents string
+		want     string
+	}{
+		{"Index out of range", "v 0 0 0\nv 1 0 0\nf 1 2 3\n", ":3: vertex index 3 out of range"},
+		{"Unknown material", "v 0 0 0\nusemtl nope\n", ":2: unknown material"},
+		{"Bad number", "v 0 zero 0\n", ":1: bad number"},
+		{"No faces", "v 0 0 0\n", "no faces"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeFile(t, dir, "bad.obj", tt.contents)
+			_, err := Load(path, hittable.Lambertian{})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
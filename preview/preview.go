@@ -0,0 +1,165 @@
+// Package preview serves the image of a render in progress over HTTP.
+package preview
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-tracer/src/framebuffer"
+	"image/png"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// Holds the latest snapshot of a render. Snapshots are encoded once when they
+// arrive, so serving them to any number of browsers is cheap.
+type Server struct {
+	// How snapshots are turned into displayable images; set before the first Update
+	ToneMapper framebuffer.ToneMapper
+	Exposure   float64
+
+	mu      sync.Mutex
+	png     []byte
+	samples int
+	total   int
+	done    bool
+
+	stop atomic.Bool
+}
+
+// What /status reports
+type Status struct {
+	Samples int  `json:"samples"`
+	Total   int  `json:"total"`
+	Done    bool `json:"done"`
+	Stopped bool `json:"stopped"`
+}
+
+func NewServer() *Server {
+	return &Server{}
+}
+
+// Publish a new snapshot with samples of total samples per pixel rendered
+func (s *Server) Update(fb *framebuffer.Framebuffer, samples, total int) error {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, fb.ToneMapped(s.ToneMapper, s.Exposure)); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.png = buf.Bytes()
+	s.samples = samples
+	s.total = total
+	return nil
+}
+
+// Mark the render as finished, so the page stops polling
+func (s *Server) Finish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.done = true
+}
+
+// Whether someone asked (via POST /stop) for the render to end early
+func (s *Server) StopRequested() bool {
+	return s.stop.Load()
+}
+
+func (s *Server) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Status{Samples: s.samples, Total: s.total, Done: s.done, Stopped: s.stop.Load()}
+}
+
+// Routes:
+//
+//	GET  /           page showing the image, refreshing it every second
+//	GET  /image.png  latest snapshot
+//	GET  /status     progress as JSON
+//	POST /stop       ask the render to stop after the current pass
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handlePage)
+	mux.HandleFunc("/image.png", s.handleImage)
+	mux.HandleFunc("/status", s.handleStatus)
+	mux.HandleFunc("/stop", s.handleStop)
+	return mux
+}
+
+func (s *Server) handlePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(page))
+}
+
+func (s *Server) handleImage(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	img := s.png
+	s.mu.Unlock()
+
+	if img == nil {
+		http.Error(w, "no pass has finished yet", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(img)
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(s.Status())
+}
+
+func (s *Server) handleStop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "use POST to stop the render", http.StatusMethodNotAllowed)
+		return
+	}
+	s.stop.Store(true)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+const page = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>go-tracer preview</title>
+<style>
+body { background: #222; color: #ddd; font-family: sans-serif; text-align: center; }
+img { max-width: 95vw; image-rendering: pixelated; margin-top: 1em; }
+</style>
+</head>
+<body>
+<div><span id="status">Waiting for the first pass...</span> <button id="stop">Stop</button></div>
+<img id="image" alt="">
+<script>
+const status = document.getElementById("status");
+const image = document.getElementById("image");
+const stop = document.getElementById("stop");
+let shown = -1;
+
+stop.onclick = () => fetch("/stop", { method: "POST" });
+
+async function refresh() {
+  const s = await (await fetch("/status")).json();
+  if (s.samples !== shown && s.samples > 0) {
+    image.src = "/image.png?" + s.samples;
+    shown = s.samples;
+  }
+  status.textContent = s.samples + " / " + s.total + " samples per pixel" +
+    (s.done ? " (done)" : s.stopped ? " (stopping...)" : "");
+  stop.disabled = s.done || s.stopped;
+  if (!s.done) setTimeout(refresh, 1000);
+}
+refresh();
+</script>
+</body>
+</html>
+`
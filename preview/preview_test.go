@@ -0,0 +1,100 @@
+package preview
+
+import (
+	"encoding/json"
+	"go-tracer/src/framebuffer"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestImageAndStatus(t *testing.T) {
+	s := NewServer()
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/image.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Image before the first pass: status %d, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+
+	if err := s.Update(framebuffer.New(4, 3), 8, 100); err != nil {
+		t.Fatalf("Update() returned error: %v", err)
+	}
+
+	resp, err = http.Get(server.URL + "/image.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("Decoding snapshot: %v", err)
+	}
+	if img.Bounds().Dx() != 4 || img.Bounds().Dy() != 3 {
+		t.Errorf("Snapshot is %v, want 4x3", img.Bounds())
+	}
+
+	resp, err = http.Get(server.URL + "/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status Status
+	err = json.NewDecoder(resp.Body).Decode(&status)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != (Status{Samples: 8, Total: 100}) {
+		t.Errorf("Status = %+v", status)
+	}
+}
+
+func TestStop(t *testing.T) {
+	s := NewServer()
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/stop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed || s.StopRequested() {
+		t.Errorf("GET /stop should be rejected, got status %d", resp.StatusCode)
+	}
+
+	resp, err = http.Post(server.URL+"/stop", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !s.StopRequested() {
+		t.Errorf("Expected POST /stop to request a stop")
+	}
+}
+
+func TestPage(t *testing.T) {
+	server := httptest.NewServer(NewServer().Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), "/image.png") {
+		t.Errorf("Preview page does not load the image")
+	}
+}
@@ -0,0 +1,325 @@
+package sampler
+
+import (
+	"fmt"
+	"go-tracer/src/utils"
+	"math"
+	"strings"
+)
+
+// A Sampler hands out the random numbers of one pixel's samples. Unlike a
+// plain utils.Random it knows which sample each number belongs to and which
+// dimension of it (pixel x, pixel y, lens u, ...) it is, so it can spread the
+// pixel's samples evenly over each dimension instead of letting them clump.
+//
+// Every number is still uniform in [0, 1) on its own, so any Sampler gives the
+// same image on average; the better ones just get there with less noise.
+type Sampler interface {
+	// Float64 returns the next dimension of the current sample
+	utils.Random
+	// Begin sample index of the pixel, counting from 0; dimensions restart
+	StartSample(index int)
+}
+
+type Kind int
+
+const (
+	Independent Kind = iota // fresh random numbers for everything
+	Stratified              // jittered grid over the pixel, shuffled strata for the other dimensions
+	Halton                  // Halton sequence, randomly shifted per pixel
+	Sobol                   // Sobol sequence, randomly scrambled per pixel
+)
+
+var kindNames = []string{"independent", "stratified", "halton", "sobol"}
+
+func (k Kind) String() string {
+	if k >= 0 && int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+func ParseKind(name string) (Kind, error) {
+	for k, n := range kindNames {
+		if strings.EqualFold(name, n) {
+			return Kind(k), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown sampler %q (want %s)", name, strings.Join(kindNames, ", "))
+}
+
+// Sampler for one pixel. seed should differ between pixels (e.g.
+// utils.PixelSeed) so their patterns don't line up, and samplesPerPixel is
+// the most samples the pixel will take, which Stratified splits its strata by.
+func New(kind Kind, seed uint64, samplesPerPixel int) Sampler {
+	switch kind {
+	case Stratified:
+		s := &stratified{sequence: newSequence(seed), samples: max(samplesPerPixel, 1)}
+		for d := range s.permutations {
+			s.permutations[d] = uint32(hash(seed, uint64(d)))
+		}
+		return s
+	case Halton:
+		s := &halton{sequence: newSequence(seed)}
+		for d := range s.shifts {
+			var rng utils.RNG
+			rng.Seed(hash(seed, uint64(d)))
+			s.shifts[d] = rng.Float64()
+		}
+		return s
+	case Sobol:
+		s := &sobol{sequence: newSequence(seed)}
+		for d := range s.scrambles {
+			s.scrambles[d] = uint32(hash(seed, uint64(d)))
+		}
+		return s
+	}
+	return &independent{rng: utils.NewRNG(seed)}
+}
+
+// Plain pseudo-random numbers, the same stream a bare utils.RNG would give
+type independent struct {
+	rng *utils.RNG
+}
+
+func (s *independent) Float64() float64 {
+	return s.rng.Float64()
+}
+
+func (s *independent) StartSample(index int) {}
+
+// Bookkeeping shared by the samplers that care about dimensions. Dimensions a
+// sampler has no pattern for are padded with pseudo-random numbers that depend
+// only on the pixel and sample, so the image doesn't depend on how the render
+// is split into passes.
+type sequence struct {
+	seed  uint64
+	index int
+	dim   int
+	pad   utils.RNG
+}
+
+func newSequence(seed uint64) sequence {
+	s := sequence{seed: seed}
+	s.start(0)
+	return s
+}
+
+func (s *sequence) start(index int) {
+	s.index = index
+	s.dim = 0
+	s.pad.Seed(hash(s.seed, uint64(index)))
+}
+
+// Dimension of the number about to be handed out
+func (s *sequence) next() int {
+	s.dim++
+	return s.dim - 1
+}
+
+// Well mixed 64 bits from the seed and a few values
+func hash(seed uint64, values ...uint64) uint64 {
+	h := seed
+	var rng utils.RNG
+	for _, v := range values {
+		rng.Seed(h ^ v)
+		h = rng.Uint64()
+	}
+	return h
+}
+
+// Stratified sampling: the pixel is cut into a grid of about samplesPerPixel
+// cells and every sample lands at a random spot in a different cell. Later
+// dimensions are cut into samplesPerPixel strata each, handed to the samples
+// in a shuffled order that differs per dimension so they don't correlate.
+type stratified struct {
+	sequence
+	samples      int
+	permutations [stratifiedDims]uint32 // which shuffle of the strata each dimension uses
+}
+
+// Dimensions whose shuffles are worked out up front; later ones are rarer and
+// derive theirs as they go
+const stratifiedDims = 16
+
+func (s *stratified) permutation(d int) uint32 {
+	if d < stratifiedDims {
+		return s.permutations[d]
+	}
+	return uint32(hash(s.seed, uint64(d)))
+}
+
+func (s *stratified) StartSample(index int) {
+	s.start(index)
+}
+
+func (s *stratified) Float64() float64 {
+	d := s.next()
+	jitter := s.pad.Float64()
+	if d < 2 {
+		nx := int(math.Sqrt(float64(s.samples)))
+		ny := (s.samples + nx - 1) / nx
+		cell := permute(uint32(s.index%(nx*ny)), uint32(nx*ny), s.permutations[0])
+		if d == 0 {
+			return (float64(int(cell)%nx) + jitter) / float64(nx)
+		}
+		return (float64(int(cell)/nx) + jitter) / float64(ny)
+	}
+	stratum := permute(uint32(s.index%s.samples), uint32(s.samples), s.permutation(d))
+	return (float64(stratum) + jitter) / float64(s.samples)
+}
+
+// A pseudo-random permutation of [0, n) chosen by p, evaluated at i without
+// building it (Kensler, "Correlated Multi-Jittered Sampling", 2013)
+func permute(i, n, p uint32) uint32 {
+	w := n - 1
+	w |= w >> 1
+	w |= w >> 2
+	w |= w >> 4
+	w |= w >> 8
+	w |= w >> 16
+	for {
+		i ^= p
+		i *= 0xe170893d
+		i ^= p >> 16
+		i ^= (i & w) >> 4
+		i ^= p >> 8
+		i *= 0x0929eb3f
+		i ^= p >> 23
+		i ^= (i & w) >> 1
+		i *= 1 | p>>27
+		i *= 0x6935fa69
+		i ^= (i & w) >> 11
+		i *= 0x74dcb303
+		i ^= (i & w) >> 2
+		i *= 0x9e501cc3
+		i ^= (i & w) >> 2
+		i *= 0xc860a3df
+		i &= w
+		i ^= i >> 5
+		if i < n {
+			break
+		}
+	}
+	return (i + p) % n
+}
+
+// Primes used as Halton bases, one per dimension. Past these the sequence's
+// dimensions correlate badly, so later ones are padded instead.
+var haltonPrimes = [...]int{2, 3, 5, 7, 11, 13, 17, 19, 23, 29, 31, 37, 41, 43, 47, 53}
+
+// Halton sequence: dimension d is the radical inverse of the sample index in
+// base haltonPrimes[d], shifted by a random amount per pixel and dimension
+// (Cranley-Patterson rotation) so neighbouring pixels don't share a pattern
+type halton struct {
+	sequence
+	shifts [len(haltonPrimes)]float64
+}
+
+func (s *halton) StartSample(index int) {
+	s.start(index)
+}
+
+func (s *halton) Float64() float64 {
+	d := s.next()
+	if d >= len(haltonPrimes) {
+		return s.pad.Float64()
+	}
+	v := radicalInverse(s.index, haltonPrimes[d]) + s.shifts[d]
+	return v - math.Floor(v)
+}
+
+// Mirror the base-b digits of n about the decimal point: 6 = 110 in base 2
+// becomes 0.011 = 0.375
+func radicalInverse(n, base int) float64 {
+	inv := 1.0 / float64(base)
+	scale := inv
+	result := 0.0
+	for n > 0 {
+		result += float64(n%base) * scale
+		n /= base
+		scale *= inv
+	}
+	return result
+}
+
+// Sobol sequence: each dimension XORs together direction numbers picked by the
+// bits of the sample index, then XORs the result with a random mask per pixel
+// and dimension. That scramble keeps every power-of-two run of samples
+// stratified.
+type sobol struct {
+	sequence
+	scrambles [sobolDims]uint32
+}
+
+func (s *sobol) StartSample(index int) {
+	s.start(index)
+}
+
+func (s *sobol) Float64() float64 {
+	d := s.next()
+	if d >= len(sobolDirections) {
+		return s.pad.Float64()
+	}
+	x := s.scrambles[d]
+	for bit, i := 0, uint32(s.index); i != 0; bit, i = bit+1, i>>1 {
+		if i&1 != 0 {
+			x ^= sobolDirections[d][bit]
+		}
+	}
+	return float64(x) / (1 << 32)
+}
+
+// Dimensions the Sobol sequence covers before padding takes over
+const sobolDims = 16
+
+// Primitive polynomial (degree s, coefficients a) and initial direction
+// numbers m of Sobol dimensions 2 and up, from Joe and Kuo's
+// new-joe-kuo-6.21201 table
+var sobolPolynomials = [sobolDims - 1]struct {
+	s, a uint32
+	m    []uint32
+}{
+	{1, 0, []uint32{1}},
+	{2, 1, []uint32{1, 3}},
+	{3, 1, []uint32{1, 3, 1}},
+	{3, 2, []uint32{1, 1, 1}},
+	{4, 1, []uint32{1, 1, 3, 3}},
+	{4, 4, []uint32{1, 3, 5, 13}},
+	{5, 2, []uint32{1, 1, 5, 5, 17}},
+	{5, 4, []uint32{1, 1, 5, 5, 5}},
+	{5, 7, []uint32{1, 1, 7, 11, 19}},
+	{5, 11, []uint32{1, 1, 5, 1, 1}},
+	{5, 13, []uint32{1, 1, 1, 3, 11}},
+	{5, 14, []uint32{1, 3, 5, 5, 31}},
+	{6, 1, []uint32{1, 3, 3, 9, 7, 49}},
+	{6, 13, []uint32{1, 1, 1, 15, 21, 21}},
+	{6, 16, []uint32{1, 3, 1, 13, 27, 49}},
+}
+
+// 32 direction numbers per dimension, as 0.32 fixed point
+var sobolDirections = buildSobolDirections()
+
+func buildSobolDirections() [sobolDims][32]uint32 {
+	var dirs [sobolDims][32]uint32
+	// The first dimension is the base 2 radical inverse
+	for k := 0; k < 32; k++ {
+		dirs[0][k] = 1 << (31 - k)
+	}
+	for d, poly := range sobolPolynomials {
+		v := &dirs[d+1]
+		for k := uint32(0); k < 32; k++ {
+			if k < poly.s {
+				v[k] = poly.m[k] << (31 - k)
+				continue
+			}
+			v[k] = v[k-poly.s] ^ (v[k-poly.s] >> poly.s)
+			for l := uint32(1); l < poly.s; l++ {
+				if (poly.a>>(poly.s-1-l))&1 != 0 {
+					v[k] ^= v[k-l]
+				}
+			}
+		}
+	}
+	return dirs
+}
@@ -0,0 +1,197 @@
+package sampler
+
+import (
+	"go-tracer/src/utils"
+	"math"
+	"testing"
+)
+
+var kinds = []Kind{Independent, Stratified, Halton, Sobol}
+
+// The first dims dimensions of samples 0..n-1
+func points(s Sampler, n, dims int) [][]float64 {
+	pts := make([][]float64, n)
+	for i := range pts {
+		s.StartSample(i)
+		pts[i] = make([]float64, dims)
+		for d := range pts[i] {
+			pts[i][d] = s.Float64()
+		}
+	}
+	return pts
+}
+
+// Whether the points have exactly one in each of the cells of an nx by ny
+// grid over dimensions dx and dy
+func oneInEachCell(pts [][]float64, dx, dy, nx, ny int) bool {
+	seen := make(map[int]bool)
+	for _, p := range pts {
+		cell := int(p[dx]*float64(nx)) + nx*int(p[dy]*float64(ny))
+		if seen[cell] {
+			return false
+		}
+		seen[cell] = true
+	}
+	return len(seen) == nx*ny
+}
+
+func TestParseKind(t *testing.T) {
+	for _, k := range kinds {
+		got, err := ParseKind(k.String())
+		if err != nil || got != k {
+			t.Errorf("ParseKind(%q) = %v, %v", k.String(), got, err)
+		}
+	}
+	if _, err := ParseKind("random"); err == nil {
+		t.Errorf("Expected an error for an unknown sampler")
+	}
+}
+
+func TestSamplersAreReproducibleAndInRange(t *testing.T) {
+	for _, k := range kinds {
+		t.Run(k.String(), func(t *testing.T) {
+			a := points(New(k, 42, 16), 16, 40)
+			b := New(k, 42, 16)
+			b.StartSample(5)
+			for d := 0; d < 40; d++ {
+				v := b.Float64()
+				if k != Independent && v != a[5][d] {
+					t.Fatalf("Sample 5 dimension %d = %v when started on its own, %v in order", d, v, a[5][d])
+				}
+			}
+			for i, p := range a {
+				for d, v := range p {
+					if v < 0 || v >= 1 {
+						t.Fatalf("Sample %d dimension %d = %v, outside [0, 1)", i, d, v)
+					}
+				}
+			}
+		})
+	}
+}
+
+// Drawing samples shouldn't allocate, as it happens for every ray
+func TestSamplingDoesNotAllocate(t *testing.T) {
+	for _, k := range kinds {
+		s := New(k, 9, 16)
+		allocs := testing.AllocsPerRun(100, func() {
+			s.StartSample(3)
+			for d := 0; d < 40; d++ {
+				s.Float64()
+			}
+		})
+		if allocs != 0 {
+			t.Errorf("%v: %v allocations per sample, want 0", k, allocs)
+		}
+	}
+}
+
+func TestIndependentMatchesRNG(t *testing.T) {
+	s := New(Independent, 7, 4)
+	rng := utils.NewRNG(7)
+	for i := 0; i < 10; i++ {
+		s.StartSample(i)
+		if got, want := s.Float64(), rng.Float64(); got != want {
+			t.Fatalf("Number %d = %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestStratification(t *testing.T) {
+	t.Run("stratified", func(t *testing.T) {
+		pts := points(New(Stratified, 3, 16), 16, 4)
+		if !oneInEachCell(pts, 0, 1, 4, 4) {
+			t.Errorf("Pixel samples don't cover a 4x4 grid")
+		}
+		if !oneInEachCell(pts, 2, 2, 16, 1) || !oneInEachCell(pts, 3, 3, 16, 1) {
+			t.Errorf("Later dimensions aren't split into 16 strata")
+		}
+	})
+
+	t.Run("halton", func(t *testing.T) {
+		// 2^3 samples stratify base 2, 3^2 base 3 (the shift only rotates them)
+		if pts := points(New(Halton, 3, 0), 8, 1); !oneInEachCell(pts, 0, 0, 8, 1) {
+			t.Errorf("First 8 samples don't stratify dimension 0")
+		}
+		if pts := points(New(Halton, 3, 0), 9, 2); !oneInEachCell(pts, 1, 1, 9, 1) {
+			t.Errorf("First 9 samples don't stratify dimension 1")
+		}
+	})
+
+	t.Run("sobol", func(t *testing.T) {
+		pts := points(New(Sobol, 3, 0), 32, len(sobolDirections))
+		for d := range sobolDirections {
+			if !oneInEachCell(pts, d, d, 32, 1) {
+				t.Errorf("First 32 samples don't stratify dimension %d", d)
+			}
+		}
+		// The first two dimensions form a (0, 2)-sequence: every elementary
+		// interval of area 1/16 holds one of the first 16 points
+		pts = pts[:16]
+		for _, grid := range [][2]int{{1, 16}, {2, 8}, {4, 4}, {8, 2}, {16, 1}} {
+			if !oneInEachCell(pts, 0, 1, grid[0], grid[1]) {
+				t.Errorf("First 16 samples don't fill a %dx%d grid", grid[0], grid[1])
+			}
+		}
+	})
+}
+
+func TestRadicalInverse(t *testing.T) {
+	tests := []struct {
+		n, base int
+		want    float64
+	}{
+		{0, 2, 0},
+		{1, 2, 0.5},
+		{6, 2, 0.375},
+		{1, 3, 1.0 / 3},
+		{5, 3, 7.0 / 9}, // 12 in base 3 -> 0.21
+	}
+	for _, tt := range tests {
+		if got := radicalInverse(tt.n, tt.base); math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("radicalInverse(%d, %d) = %v, want %v", tt.n, tt.base, got, tt.want)
+		}
+	}
+}
+
+func TestPermute(t *testing.T) {
+	for _, n := range []uint32{1, 5, 16, 100} {
+		seen := make(map[uint32]bool)
+		for i := uint32(0); i < n; i++ {
+			seen[permute(i, n, 12345)] = true
+		}
+		if len(seen) != int(n) {
+			t.Errorf("permute over %d values hit only %d of them", n, len(seen))
+		}
+	}
+}
+
+// Estimating the integral of a smooth function over the unit square should
+// be less noisy with every sampler than with independent samples
+func TestLowerErrorThanIndependent(t *testing.T) {
+	const n, trials = 64, 200
+	f := func(x, y float64) float64 { return x * y * math.Exp(x) }
+	want := 0.5 // integral of x e^x is 1, of y is 1/2
+
+	rmsError := func(k Kind) float64 {
+		sum := 0.0
+		for trial := 0; trial < trials; trial++ {
+			s := New(k, utils.PixelSeed(1, trial, 0), n)
+			estimate := 0.0
+			for i := 0; i < n; i++ {
+				s.StartSample(i)
+				estimate += f(s.Float64(), s.Float64())
+			}
+			err := estimate/n - want
+			sum += err * err
+		}
+		return math.Sqrt(sum / trials)
+	}
+
+	independent := rmsError(Independent)
+	for _, k := range kinds[1:] {
+		if got := rmsError(k); got > independent/2 {
+			t.Errorf("%v RMS error %v, want well under independent's %v", k, got, independent)
+		}
+	}
+}
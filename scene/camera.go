@@ -0,0 +1,134 @@
+package scene
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-tracer/src/camera"
+	"go-tracer/src/texture"
+)
+
+type cameraSpec struct {
+	AspectRatio     float64         `json:"aspect_ratio"`
+	ImageWidth      int             `json:"image_width"`
+	ImageHeight     int             `json:"image_height"`
+	SamplesPerPixel int             `json:"samples_per_pixel"`
+	MaxDepth        int             `json:"max_depth"`
+	VFOV            float64         `json:"vfov"`
+	LookFrom        Vec             `json:"look_from"`
+	LookAt          Vec             `json:"look_at"`
+	ViewUp          Vec             `json:"view_up"`
+	DefocusAngle    float64         `json:"defocus_angle"`
+	FocusDistance   float64         `json:"focus_distance"`
+	ShutterOpen     float64         `json:"shutter_open"`
+	ShutterClose    float64         `json:"shutter_close"`
+	Background      *backgroundSpec `json:"background"`
+}
+
+type backgroundSpec struct {
+	Type      string   `json:"type"`
+	Color     Vec      `json:"color"`
+	Bottom    Vec      `json:"bottom"`
+	Top       Vec      `json:"top"`
+	File      string   `json:"file"`      // environment image, relative to the scene file
+	Intensity *float64 `json:"intensity"` // environment brightness, 1 if left out
+	Rotation  float64  `json:"rotation"`  // degrees the environment is turned about the vertical axis
+}
+
+// Values used for any camera field the scene file leaves out
+func defaultCameraSpec() cameraSpec {
+	return cameraSpec{
+		AspectRatio:     16.0 / 9.0,
+		ImageWidth:      400,
+		SamplesPerPixel: 100,
+		MaxDepth:        50,
+		VFOV:            90.0,
+		LookFrom:        Vec{0, 0, 0},
+		LookAt:          Vec{0, 0, -1},
+		ViewUp:          Vec{0, 1, 0},
+		DefocusAngle:    0.0,
+		FocusDistance:   1.0,
+	}
+}
+
+func (l *loader) parseCamera(raw json.RawMessage) (camera.Camera, error) {
+	spec := defaultCameraSpec()
+	if raw != nil {
+		if err := decodeStrict(raw, &spec); err != nil {
+			return camera.Camera{}, entryError("camera", "%v", err)
+		}
+	}
+
+	if spec.MaxDepth <= 0 {
+		return camera.Camera{}, entryError("camera", "max_depth must be positive, got %d", spec.MaxDepth)
+	}
+	if spec.VFOV <= 0 || spec.VFOV >= 180 {
+		return camera.Camera{}, entryError("camera", "vfov must be between 0 and 180 degrees, got %v", spec.VFOV)
+	}
+	if spec.ShutterClose < spec.ShutterOpen {
+		return camera.Camera{}, entryError("camera", "shutter_close (%v) is before shutter_open (%v)", spec.ShutterClose, spec.ShutterOpen)
+	}
+	if spec.FocusDistance <= 0 {
+		return camera.Camera{}, entryError("camera", "focus_distance must be positive, got %v", spec.FocusDistance)
+	}
+
+	var cam camera.Camera
+	cam.AspectRatio = spec.AspectRatio
+	cam.ImageWidth = spec.ImageWidth
+	cam.ImageHeight = spec.ImageHeight
+	cam.SamplesPerPixel = spec.SamplesPerPixel
+	cam.MaxDepth = spec.MaxDepth
+
+	cam.VFOV = spec.VFOV
+	cam.LookFrom = spec.LookFrom.Vec3()
+	cam.LookAt = spec.LookAt.Vec3()
+	cam.ViewUp = spec.ViewUp.Vec3()
+	cam.DefocusAngle = spec.DefocusAngle
+	cam.FocusDistance = spec.FocusDistance
+	cam.ShutterOpen = spec.ShutterOpen
+	cam.ShutterClose = spec.ShutterClose
+
+	if spec.Background != nil {
+		background, err := l.background(spec.Background)
+		if err != nil {
+			return camera.Camera{}, entryError("camera.background", "%v", err)
+		}
+		cam.Background = background
+	}
+
+	// Catch bad image sizes and degenerate orientations now rather than at render time
+	if err := cam.Initalize(); err != nil {
+		return camera.Camera{}, &ValidationError{Entry: "camera", Err: err}
+	}
+
+	return cam, nil
+}
+
+func (l *loader) background(spec *backgroundSpec) (camera.Background, error) {
+	switch spec.Type {
+	case "solid":
+		return camera.SolidBackground{Color: spec.Color.Vec3()}, nil
+	case "gradient":
+		return camera.GradientBackground{Bottom: spec.Bottom.Vec3(), Top: spec.Top.Vec3()}, nil
+	case "none":
+		return camera.SolidBackground{}, nil
+	case "environment":
+		if spec.File == "" {
+			return nil, fmt.Errorf("missing file")
+		}
+		intensity := 1.0
+		if spec.Intensity != nil {
+			intensity = *spec.Intensity
+		}
+		if intensity < 0 {
+			return nil, fmt.Errorf("intensity must not be negative, got %v", intensity)
+		}
+		img, err := texture.LoadImage(l.path(spec.File))
+		if err != nil {
+			return nil, err
+		}
+		return camera.NewEnvironmentMap(img, intensity, spec.Rotation), nil
+	case "":
+		return nil, fmt.Errorf("missing type")
+	}
+	return nil, fmt.Errorf("unknown background type %q (want solid, gradient, environment or none)", spec.Type)
+}
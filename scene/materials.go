@@ -0,0 +1,148 @@
+package scene
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-tracer/src/hittable"
+)
+
+type lambertianSpec struct {
+	header
+	Albedo  Vec    `json:"albedo"`
+	Texture string `json:"texture"`
+}
+
+type metalSpec struct {
+	header
+	Albedo  Vec     `json:"albedo"`
+	Texture string  `json:"texture"`
+	Fuzz    float64 `json:"fuzz"`
+}
+
+type diffuseLightSpec struct {
+	header
+	Emit     Vec    `json:"emit"`
+	Texture  string `json:"texture"`
+	TwoSided bool   `json:"two_sided"`
+}
+
+type isotropicSpec struct {
+	header
+	Albedo  Vec    `json:"albedo"`
+	Texture string `json:"texture"`
+}
+
+type principledSpec struct {
+	header
+	BaseColor    Vec      `json:"base_color"`
+	Texture      string   `json:"texture"`
+	Roughness    float64  `json:"roughness"`
+	Metallic     float64  `json:"metallic"`
+	Specular     *float64 `json:"specular"` // defaults to 0.5, a 4% reflection
+	Transmission float64  `json:"transmission"`
+	IOR          float64  `json:"ior"`
+}
+
+type dielectricSpec struct {
+	header
+	RefractionIndex float64 `json:"refraction_index"`
+}
+
+func (l *loader) parseMaterial(kind string, raw json.RawMessage) (hittable.Material, error) {
+	switch kind {
+	case "lambertian":
+		var spec lambertianSpec
+		if err := decodeStrict(raw, &spec); err != nil {
+			return nil, err
+		}
+		tex, err := l.texture(spec.Texture)
+		if err != nil {
+			return nil, err
+		}
+		return hittable.Lambertian{Albedo: spec.Albedo.Vec3(), Tex: tex}, nil
+
+	case "metal":
+		var spec metalSpec
+		if err := decodeStrict(raw, &spec); err != nil {
+			return nil, err
+		}
+		if spec.Fuzz < 0 || spec.Fuzz > 1 {
+			return nil, fmt.Errorf("fuzz must be between 0 and 1, got %v", spec.Fuzz)
+		}
+		tex, err := l.texture(spec.Texture)
+		if err != nil {
+			return nil, err
+		}
+		return hittable.Metal{Albedo: spec.Albedo.Vec3(), Tex: tex, Fuzz: spec.Fuzz}, nil
+
+	case "dielectric":
+		var spec dielectricSpec
+		if err := decodeStrict(raw, &spec); err != nil {
+			return nil, err
+		}
+		if spec.RefractionIndex <= 0 {
+			return nil, fmt.Errorf("refraction_index must be positive, got %v", spec.RefractionIndex)
+		}
+		return hittable.Dielectric{Ir: spec.RefractionIndex}, nil
+
+	case "diffuse_light":
+		var spec diffuseLightSpec
+		if err := decodeStrict(raw, &spec); err != nil {
+			return nil, err
+		}
+		tex, err := l.texture(spec.Texture)
+		if err != nil {
+			return nil, err
+		}
+		return hittable.DiffuseLight{Emit: spec.Emit.Vec3(), Tex: tex, TwoSided: spec.TwoSided}, nil
+
+	case "isotropic":
+		var spec isotropicSpec
+		if err := decodeStrict(raw, &spec); err != nil {
+			return nil, err
+		}
+		tex, err := l.texture(spec.Texture)
+		if err != nil {
+			return nil, err
+		}
+		return hittable.Isotropic{Albedo: spec.Albedo.Vec3(), Tex: tex}, nil
+
+	case "principled":
+		var spec principledSpec
+		if err := decodeStrict(raw, &spec); err != nil {
+			return nil, err
+		}
+		specular := 0.5
+		if spec.Specular != nil {
+			specular = *spec.Specular
+		}
+		for _, param := range []struct {
+			name  string
+			value float64
+		}{{"roughness", spec.Roughness}, {"metallic", spec.Metallic}, {"specular", specular}, {"transmission", spec.Transmission}} {
+			if param.value < 0 || param.value > 1 {
+				return nil, fmt.Errorf("%s must be between 0 and 1, got %v", param.name, param.value)
+			}
+		}
+		if spec.IOR < 0 {
+			return nil, fmt.Errorf("ior must be positive, got %v", spec.IOR)
+		}
+		tex, err := l.texture(spec.Texture)
+		if err != nil {
+			return nil, err
+		}
+		return hittable.Principled{
+			BaseColor:    spec.BaseColor.Vec3(),
+			Tex:          tex,
+			Roughness:    spec.Roughness,
+			Metallic:     spec.Metallic,
+			Specular:     specular,
+			Transmission: spec.Transmission,
+			IOR:          spec.IOR,
+		}, nil
+
+	case "":
+		return nil, fmt.Errorf("missing type")
+	}
+	return nil, fmt.Errorf("unknown material type %q", kind)
+}
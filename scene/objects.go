@@ -0,0 +1,421 @@
+package scene
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-tracer/src/hittable"
+	"go-tracer/src/obj"
+	"go-tracer/src/vec3"
+)
+
+type sphereSpec struct {
+	header
+	Center   Vec     `json:"center"`
+	Radius   float64 `json:"radius"`
+	Material string  `json:"material"`
+}
+
+type movingSphereSpec struct {
+	header
+	Center0  Vec     `json:"center0"`
+	Center1  Vec     `json:"center1"`
+	Time0    float64 `json:"time0"`
+	Time1    float64 `json:"time1"`
+	Radius   float64 `json:"radius"`
+	Material string  `json:"material"`
+}
+
+type triangleSpec struct {
+	header
+	Vertices [3]Vec `json:"vertices"`
+	Normals  []Vec  `json:"normals"`
+	Material string `json:"material"`
+}
+
+type quadSpec struct {
+	header
+	Q        Vec    `json:"q"`
+	U        Vec    `json:"u"`
+	V        Vec    `json:"v"`
+	Material string `json:"material"`
+}
+
+type planeSpec struct {
+	header
+	Point    Vec    `json:"point"`
+	Normal   Vec    `json:"normal"`
+	Material string `json:"material"`
+}
+
+type diskSpec struct {
+	header
+	Center   Vec     `json:"center"`
+	Normal   Vec     `json:"normal"`
+	Radius   float64 `json:"radius"`
+	Material string  `json:"material"`
+}
+
+type boxSpec struct {
+	header
+	Min      Vec    `json:"min"`
+	Max      Vec    `json:"max"`
+	Material string `json:"material"`
+}
+
+// Shared by cylinders (base to top) and cones (base to apex)
+type axialSpec struct {
+	header
+	Base     Vec     `json:"base"`
+	Top      *Vec    `json:"top"`
+	Apex     *Vec    `json:"apex"`
+	Radius   float64 `json:"radius"`
+	Open     bool    `json:"open"`
+	Material string  `json:"material"`
+}
+
+type meshSpec struct {
+	header
+	File     string `json:"file"`
+	Material string `json:"material"` // for faces the OBJ file doesn't assign a material to
+}
+
+// Another object placed by a list of transforms, applied in order
+type instanceSpec struct {
+	header
+	Object     json.RawMessage `json:"object"`
+	Transforms []transformSpec `json:"transforms"`
+}
+
+// Fog or smoke filling a closed boundary object
+type constantMediumSpec struct {
+	header
+	Boundary json.RawMessage `json:"boundary"`
+	Density  float64         `json:"density"`
+	Material string          `json:"material"` // usually isotropic
+}
+
+// Two closed objects combined by a boolean operation
+type csgSpec struct {
+	header
+	Operation string          `json:"operation"`
+	A         json.RawMessage `json:"a"`
+	B         json.RawMessage `json:"b"`
+}
+
+var csgOps = map[string]hittable.CSGOp{
+	"union":        hittable.CSGUnion,
+	"intersection": hittable.CSGIntersection,
+	"difference":   hittable.CSGDifference,
+}
+
+// One step of an instance's placement; exactly one field must be set
+type transformSpec struct {
+	Translate *Vec           `json:"translate"`
+	Rotate    *Vec           `json:"rotate"` // axis, turned by Degrees
+	Degrees   float64        `json:"degrees"`
+	Scale     *Vec           `json:"scale"`
+	Matrix    *[4][4]float64 `json:"matrix"` // row-major, applied to column vectors
+}
+
+func (l *loader) parseObject(kind string, raw json.RawMessage) (hittable.Hittable, error) {
+	switch kind {
+	case "sphere":
+		var spec sphereSpec
+		if err := decodeStrict(raw, &spec); err != nil {
+			return nil, err
+		}
+		// Negative radii are allowed: they flip the normals to model hollow glass
+		if spec.Radius == 0 {
+			return nil, fmt.Errorf("radius must be non-zero")
+		}
+		mat, err := l.material(spec.Material)
+		if err != nil {
+			return nil, err
+		}
+		return hittable.Sphere{Center: spec.Center.Vec3(), Radius: spec.Radius, Mat: mat}, nil
+
+	case "moving_sphere":
+		var spec movingSphereSpec
+		if err := decodeStrict(raw, &spec); err != nil {
+			return nil, err
+		}
+		if spec.Radius == 0 {
+			return nil, fmt.Errorf("radius must be non-zero")
+		}
+		if spec.Time1 < spec.Time0 {
+			return nil, fmt.Errorf("time1 (%v) is before time0 (%v)", spec.Time1, spec.Time0)
+		}
+		mat, err := l.material(spec.Material)
+		if err != nil {
+			return nil, err
+		}
+		return hittable.MovingSphere{
+			Center0: spec.Center0.Vec3(),
+			Center1: spec.Center1.Vec3(),
+			Time0:   spec.Time0,
+			Time1:   spec.Time1,
+			Radius:  spec.Radius,
+			Mat:     mat,
+		}, nil
+
+	case "triangle":
+		var spec triangleSpec
+		if err := decodeStrict(raw, &spec); err != nil {
+			return nil, err
+		}
+		mat, err := l.material(spec.Material)
+		if err != nil {
+			return nil, err
+		}
+		tri := hittable.Triangle{V0: spec.Vertices[0].Vec3(), V1: spec.Vertices[1].Vec3(), V2: spec.Vertices[2].Vec3(), Mat: mat}
+		if tri.V1.Subtract(tri.V0).Cross(*tri.V2.Subtract(tri.V0)).NearZero() {
+			return nil, fmt.Errorf("vertices are collinear")
+		}
+		switch len(spec.Normals) {
+		case 0:
+		case 3:
+			tri.N0, tri.N1, tri.N2 = spec.Normals[0].Vec3(), spec.Normals[1].Vec3(), spec.Normals[2].Vec3()
+		default:
+			return nil, fmt.Errorf("normals must list one normal per vertex, got %d", len(spec.Normals))
+		}
+		return tri, nil
+
+	case "quad":
+		var spec quadSpec
+		if err := decodeStrict(raw, &spec); err != nil {
+			return nil, err
+		}
+		mat, err := l.material(spec.Material)
+		if err != nil {
+			return nil, err
+		}
+		quad := hittable.Quad{Q: spec.Q.Vec3(), U: spec.U.Vec3(), V: spec.V.Vec3(), Mat: mat}
+		if quad.U.Cross(quad.V).NearZero() {
+			return nil, fmt.Errorf("edges u and v must not be parallel or zero")
+		}
+		return quad, nil
+
+	case "plane":
+		var spec planeSpec
+		if err := decodeStrict(raw, &spec); err != nil {
+			return nil, err
+		}
+		if spec.Normal.Vec3().NearZero() {
+			return nil, fmt.Errorf("normal must not be zero")
+		}
+		mat, err := l.material(spec.Material)
+		if err != nil {
+			return nil, err
+		}
+		return hittable.Plane{Point: spec.Point.Vec3(), Normal: spec.Normal.Vec3(), Mat: mat}, nil
+
+	case "disk":
+		var spec diskSpec
+		if err := decodeStrict(raw, &spec); err != nil {
+			return nil, err
+		}
+		if spec.Normal.Vec3().NearZero() {
+			return nil, fmt.Errorf("normal must not be zero")
+		}
+		if spec.Radius <= 0 {
+			return nil, fmt.Errorf("radius must be positive, got %v", spec.Radius)
+		}
+		mat, err := l.material(spec.Material)
+		if err != nil {
+			return nil, err
+		}
+		return hittable.Disk{Center: spec.Center.Vec3(), Normal: spec.Normal.Vec3(), Radius: spec.Radius, Mat: mat}, nil
+
+	case "box":
+		var spec boxSpec
+		if err := decodeStrict(raw, &spec); err != nil {
+			return nil, err
+		}
+		for axis := 0; axis < 3; axis++ {
+			if spec.Min[axis] == spec.Max[axis] {
+				return nil, fmt.Errorf("box is flat along axis %d, use a quad instead", axis)
+			}
+		}
+		mat, err := l.material(spec.Material)
+		if err != nil {
+			return nil, err
+		}
+		return hittable.NewBox(spec.Min.Vec3(), spec.Max.Vec3(), mat), nil
+
+	case "cylinder", "cone":
+		var spec axialSpec
+		if err := decodeStrict(raw, &spec); err != nil {
+			return nil, err
+		}
+		end, endName := spec.Top, "top"
+		if kind == "cone" {
+			end, endName = spec.Apex, "apex"
+			if spec.Top != nil {
+				return nil, fmt.Errorf("cones have an apex, not a top")
+			}
+		} else if spec.Apex != nil {
+			return nil, fmt.Errorf("cylinders have a top, not an apex")
+		}
+		if end == nil {
+			return nil, fmt.Errorf("missing %s", endName)
+		}
+		if end.Vec3().Subtract(spec.Base.Vec3()).NearZero() {
+			return nil, fmt.Errorf("base and %s must differ", endName)
+		}
+		if spec.Radius <= 0 {
+			return nil, fmt.Errorf("radius must be positive, got %v", spec.Radius)
+		}
+		mat, err := l.material(spec.Material)
+		if err != nil {
+			return nil, err
+		}
+		if kind == "cone" {
+			return hittable.Cone{Base: spec.Base.Vec3(), Apex: end.Vec3(), Radius: spec.Radius, Open: spec.Open, Mat: mat}, nil
+		}
+		return hittable.Cylinder{Base: spec.Base.Vec3(), Top: end.Vec3(), Radius: spec.Radius, Open: spec.Open, Mat: mat}, nil
+
+	case "mesh":
+		var spec meshSpec
+		if err := decodeStrict(raw, &spec); err != nil {
+			return nil, err
+		}
+		if spec.File == "" {
+			return nil, fmt.Errorf("missing file")
+		}
+		var mat hittable.Material
+		if spec.Material != "" {
+			var err error
+			if mat, err = l.material(spec.Material); err != nil {
+				return nil, err
+			}
+		}
+		// Instances of the same file share one copy of the triangles
+		key := meshKey{path: l.path(spec.File), material: spec.Material}
+		if mesh, ok := l.meshes[key]; ok {
+			return mesh, nil
+		}
+		// Materials from the file's MTL library get IDs after the named ones,
+		// in the order the file first uses them
+		mesh, err := obj.LoadWith(key.path, mat, func(name string, m hittable.Material) hittable.Material {
+			return l.tagMaterial(m)
+		})
+		if err != nil {
+			return nil, err
+		}
+		l.meshes[key] = mesh
+		return mesh, nil
+
+	case "instance":
+		var spec instanceSpec
+		if err := decodeStrict(raw, &spec); err != nil {
+			return nil, err
+		}
+		object, err := l.nestedObject("object", spec.Object)
+		if err != nil {
+			return nil, err
+		}
+		m := vec3.Identity()
+		for i, step := range spec.Transforms {
+			step_m, err := step.matrix()
+			if err != nil {
+				return nil, fmt.Errorf("transforms[%d]: %w", i, err)
+			}
+			m = step_m.Multiply(m)
+		}
+		instance, err := hittable.NewTransform(object, m)
+		if err != nil {
+			return nil, err
+		}
+		return instance, nil
+
+	case "constant_medium":
+		var spec constantMediumSpec
+		if err := decodeStrict(raw, &spec); err != nil {
+			return nil, err
+		}
+		if spec.Density <= 0 {
+			return nil, fmt.Errorf("density must be positive, got %v", spec.Density)
+		}
+		boundary, err := l.nestedObject("boundary", spec.Boundary)
+		if err != nil {
+			return nil, err
+		}
+		mat, err := l.material(spec.Material)
+		if err != nil {
+			return nil, err
+		}
+		return hittable.ConstantMedium{Boundary: boundary, Density: spec.Density, PhaseFunction: mat}, nil
+
+	case "csg":
+		var spec csgSpec
+		if err := decodeStrict(raw, &spec); err != nil {
+			return nil, err
+		}
+		op, ok := csgOps[spec.Operation]
+		if !ok {
+			return nil, fmt.Errorf("unknown operation %q, want union, intersection or difference", spec.Operation)
+		}
+		a, err := l.nestedObject("a", spec.A)
+		if err != nil {
+			return nil, err
+		}
+		b, err := l.nestedObject("b", spec.B)
+		if err != nil {
+			return nil, err
+		}
+		return hittable.CSG{Op: op, A: a, B: b}, nil
+
+	case "":
+		return nil, fmt.Errorf("missing type")
+	}
+	return nil, fmt.Errorf("unknown object type %q", kind)
+}
+
+// Object embedded in another entry's field, with errors prefixed by the field
+func (l *loader) nestedObject(field string, raw json.RawMessage) (hittable.Hittable, error) {
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("missing %s", field)
+	}
+	var h header
+	if err := json.Unmarshal(raw, &h); err != nil {
+		return nil, fmt.Errorf("%s: %w", field, err)
+	}
+	object, err := l.parseObject(h.Type, raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", field, err)
+	}
+	return object, nil
+}
+
+func (t transformSpec) matrix() (vec3.Mat4, error) {
+	set := 0
+	for _, present := range []bool{t.Translate != nil, t.Rotate != nil, t.Scale != nil, t.Matrix != nil} {
+		if present {
+			set++
+		}
+	}
+	if set != 1 {
+		return vec3.Mat4{}, fmt.Errorf("need exactly one of translate, rotate, scale or matrix")
+	}
+	if t.Degrees != 0 && t.Rotate == nil {
+		return vec3.Mat4{}, fmt.Errorf("degrees only applies to rotate")
+	}
+
+	switch {
+	case t.Translate != nil:
+		return vec3.Translation(t.Translate.Vec3()), nil
+	case t.Rotate != nil:
+		axis := t.Rotate.Vec3()
+		if axis.NearZero() {
+			return vec3.Mat4{}, fmt.Errorf("rotation axis must not be zero")
+		}
+		return vec3.Rotation(axis, t.Degrees), nil
+	case t.Scale != nil:
+		return vec3.Scaling(t.Scale.Vec3()), nil
+	}
+	m := vec3.Mat4(*t.Matrix)
+	if m[3] != [4]float64{0, 0, 0, 1} {
+		return vec3.Mat4{}, fmt.Errorf("matrix must be affine, with a last row of [0, 0, 0, 1]")
+	}
+	return m, nil
+}
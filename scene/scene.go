@@ -0,0 +1,273 @@
+package scene
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-tracer/src/camera"
+	"go-tracer/src/hittable"
+	"go-tracer/src/texture"
+	"go-tracer/src/vec3"
+	"os"
+	"path/filepath"
+)
+
+// A loaded scene: a camera ready to render and the objects it looks at
+type Scene struct {
+	Camera camera.Camera
+	World  hittable.HittableList
+	// Objects with emissive materials that can be sampled directly, part of the camera's Lights
+	Lights hittable.HittableList
+}
+
+// Points at the scene entry that failed to load, e.g. "objects[3]"
+type ValidationError struct {
+	Entry string
+	Err   error
+}
+
+func (e *ValidationError) Error() string {
+	return e.Entry + ": " + e.Err.Error()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+func entryError(entry string, format string, args ...any) error {
+	return &ValidationError{Entry: entry, Err: fmt.Errorf(format, args...)}
+}
+
+// Vec is a JSON [x, y, z] triple
+type Vec [3]float64
+
+func (v Vec) Vec3() vec3.Vec3 {
+	return vec3.Vec3{X: v[0], Y: v[1], Z: v[2]}
+}
+
+type file struct {
+	Camera    json.RawMessage   `json:"camera"`
+	Textures  []json.RawMessage `json:"textures"`
+	Materials []json.RawMessage `json:"materials"`
+	Objects   []json.RawMessage `json:"objects"`
+}
+
+// Fields shared by every material and object entry
+type header struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// State shared while building a scene, so entries can refer to each other
+type loader struct {
+	baseDir   string // relative file references (e.g. meshes) are resolved against this
+	textures  map[string]texture.Texture
+	materials map[string]hittable.Material
+	meshes    map[meshKey]*hittable.Mesh
+	// Materials tagged so far for the material ID AOV, numbered from 1 in the
+	// order they are defined
+	materialIDs int
+}
+
+type meshKey struct {
+	path, material string
+}
+
+func Load(path string) (*Scene, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := parse(data, filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Parse a scene description. Relative file references are resolved against
+// the working directory; use Load to resolve them against the scene file.
+func Parse(data []byte) (*Scene, error) {
+	return parse(data, ".")
+}
+
+func parse(data []byte, baseDir string) (*Scene, error) {
+	var f file
+	if err := decodeStrict(data, &f); err != nil {
+		return nil, describeSyntaxError(data, err)
+	}
+
+	l := loader{
+		baseDir:   baseDir,
+		textures:  make(map[string]texture.Texture),
+		materials: make(map[string]hittable.Material),
+		meshes:    make(map[meshKey]*hittable.Mesh),
+	}
+
+	var s Scene
+	var err error
+	if s.Camera, err = l.parseCamera(f.Camera); err != nil {
+		return nil, err
+	}
+
+	for i, raw := range f.Textures {
+		entry := fmt.Sprintf("textures[%d]", i)
+		var h header
+		if err := json.Unmarshal(raw, &h); err != nil {
+			return nil, entryError(entry, "%v", err)
+		}
+		if h.Name == "" {
+			return nil, entryError(entry, "missing name")
+		}
+		entry = fmt.Sprintf("%s (%s)", entry, h.Name)
+		if _, ok := l.textures[h.Name]; ok {
+			return nil, entryError(entry, "duplicate texture name")
+		}
+		tex, err := l.parseTexture(h.Type, raw)
+		if err != nil {
+			return nil, &ValidationError{Entry: entry, Err: err}
+		}
+		l.textures[h.Name] = tex
+	}
+
+	for i, raw := range f.Materials {
+		entry := fmt.Sprintf("materials[%d]", i)
+		var h header
+		if err := json.Unmarshal(raw, &h); err != nil {
+			return nil, entryError(entry, "%v", err)
+		}
+		if h.Name == "" {
+			return nil, entryError(entry, "missing name")
+		}
+		entry = fmt.Sprintf("%s (%s)", entry, h.Name)
+		if _, ok := l.materials[h.Name]; ok {
+			return nil, entryError(entry, "duplicate material name")
+		}
+		mat, err := l.parseMaterial(h.Type, raw)
+		if err != nil {
+			return nil, &ValidationError{Entry: entry, Err: err}
+		}
+		l.materials[h.Name] = l.tagMaterial(mat)
+	}
+
+	if len(f.Objects) == 0 {
+		return nil, errors.New("scene has no objects")
+	}
+	for i, raw := range f.Objects {
+		entry := fmt.Sprintf("objects[%d]", i)
+		var h header
+		if err := json.Unmarshal(raw, &h); err != nil {
+			return nil, entryError(entry, "%v", err)
+		}
+		if h.Type != "" {
+			entry = fmt.Sprintf("%s (%s)", entry, h.Type)
+		}
+		object, err := l.parseObject(h.Type, raw)
+		if err != nil {
+			return nil, &ValidationError{Entry: entry, Err: err}
+		}
+		s.World.Append(object)
+		if light, ok := lightSource(object); ok {
+			s.Lights.Append(light)
+		}
+	}
+	var lights hittable.SampleableList
+	if len(s.Lights.Objects) > 0 {
+		lights = append(lights, &s.Lights)
+	}
+	// An environment map lights the scene too, and sampling its bright
+	// spots is what makes outdoor scenes converge
+	if env, ok := s.Camera.Background.(*camera.EnvironmentMap); ok {
+		lights = append(lights, env)
+	}
+	switch len(lights) {
+	case 0:
+	case 1:
+		s.Camera.Lights = lights[0]
+	default:
+		s.Camera.Lights = lights
+	}
+
+	return &s, nil
+}
+
+// Objects that emit light and know how to sample themselves, so the camera can
+// aim rays at them directly
+func lightSource(object hittable.Hittable) (hittable.Hittable, bool) {
+	var mat hittable.Material
+	switch o := object.(type) {
+	case hittable.Sphere:
+		mat = o.Mat
+	case hittable.Quad:
+		mat = o.Mat
+	case hittable.Disk:
+		mat = o.Mat
+	default:
+		return nil, false
+	}
+	_, emissive := hittable.UntagMaterial(mat).(hittable.DiffuseLight)
+	return object, emissive
+}
+
+// Decode JSON, rejecting fields we don't know so typos don't go unnoticed
+func decodeStrict(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// Turn byte offsets from encoding/json into line:column positions
+func describeSyntaxError(data []byte, err error) error {
+	var offset int64 = -1
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &syntaxErr) {
+		offset = syntaxErr.Offset
+	} else if errors.As(err, &typeErr) {
+		offset = typeErr.Offset
+	}
+	if offset < 0 || offset > int64(len(data)) {
+		return err
+	}
+	line := 1 + bytes.Count(data[:offset], []byte("\n"))
+	column := int(offset) - bytes.LastIndexByte(data[:offset], '\n')
+	return fmt.Errorf("line %d, column %d: %w", line, column, err)
+}
+
+func (l *loader) path(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(l.baseDir, name)
+}
+
+// Look up an optional texture; an empty name means no texture
+func (l *loader) texture(name string) (texture.Texture, error) {
+	if name == "" {
+		return nil, nil
+	}
+	tex, ok := l.textures[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown texture %q", name)
+	}
+	return tex, nil
+}
+
+// Give mat the next material ID, so every material entry gets its own even
+// when two are defined alike
+func (l *loader) tagMaterial(mat hittable.Material) hittable.Material {
+	l.materialIDs++
+	return hittable.TaggedMaterial{Material: mat, ID: l.materialIDs}
+}
+
+func (l *loader) material(name string) (hittable.Material, error) {
+	if name == "" {
+		return nil, errors.New("missing material")
+	}
+	mat, ok := l.materials[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown material %q", name)
+	}
+	return mat, nil
+}
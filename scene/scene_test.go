@@ -0,0 +1,482 @@
+package scene
+
+import (
+	"errors"
+	"go-tracer/src/camera"
+	"go-tracer/src/hittable"
+	"go-tracer/src/texture"
+	"go-tracer/src/vec3"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseScene(t *testing.T) {
+	data := []byte(`{
+		"camera": { "image_width": 200, "vfov": 30, "look_from": [1, 2, 3] },
+		"materials": [
+			{ "name": "red", "type": "lambertian", "albedo": [0.9, 0.1, 0.1] },
+			{ "name": "glass", "type": "dielectric", "refraction_index": 1.5 },
+			{ "name": "grey", "type": "lambertian", "albedo": [0.5, 0.5, 0.5] },
+			{ "name": "gray", "type": "lambertian", "albedo": [0.5, 0.5, 0.5] }
+		],
+		"objects": [
+			{ "type": "sphere", "center": [0, 0, -1], "radius": 0.5, "material": "red" },
+			{ "type": "sphere", "center": [1, 0, -1], "radius": -0.4, "material": "glass" },
+			{ "type": "sphere", "center": [2, 0, -1], "radius": 0.5, "material": "grey" },
+			{ "type": "sphere", "center": [3, 0, -1], "radius": 0.5, "material": "gray" }
+		]
+	}`)
+
+	s, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+
+	if s.Camera.ImageWidth != 200 || s.Camera.VFOV != 30 || s.Camera.LookFrom.Z != 3 {
+		t.Errorf("Camera fields not loaded: %+v", s.Camera)
+	}
+	// Fields left out of the file fall back to defaults
+	if s.Camera.SamplesPerPixel != 100 || s.Camera.MaxDepth != 50 {
+		t.Errorf("Camera defaults not applied: %+v", s.Camera)
+	}
+
+	if len(s.World.Objects) != 4 {
+		t.Fatalf("Expected 4 objects, got %d", len(s.World.Objects))
+	}
+	sphere, ok := s.World.Objects[1].(hittable.Sphere)
+	if !ok {
+		t.Fatalf("Expected a Sphere, got %T", s.World.Objects[1])
+	}
+	if sphere.Radius != -0.4 || hittable.UntagMaterial(sphere.Mat) != (hittable.Dielectric{Ir: 1.5}) {
+		t.Errorf("Sphere not loaded correctly: %+v", sphere)
+	}
+	// Materials are numbered for the material ID AOV in the order they are
+	// defined, and alike ones still get IDs of their own
+	for i, want := range []int{1, 2, 3, 4} {
+		if got := hittable.MaterialID(s.World.Objects[i].(hittable.Sphere).Mat); got != want {
+			t.Errorf("Material ID of object %d = %d, want %d", i, got, want)
+		}
+	}
+}
+
+func TestParseErrorsPointAtEntry(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		entry string
+		want  string
+	}{
+		{
+			name:  "Unknown material",
+			data:  `{"objects": [{"type": "sphere", "radius": 1, "material": "red"}, {"type": "sphere", "radius": 1, "material": "blue"}]}`,
+			entry: "objects[0] (sphere)",
+			want:  `unknown material "red"`,
+		},
+		{
+			name:  "Zero radius",
+			data:  `{"materials": [{"name": "m", "type": "lambertian"}], "objects": [{"type": "sphere", "material": "m"}]}`,
+			entry: "objects[0] (sphere)",
+			want:  "radius must be non-zero",
+		},
+		{
+			name:  "Unknown field",
+			data:  `{"materials": [{"name": "m", "type": "metal", "albedo": [1, 1, 1], "roughness": 0.2}], "objects": []}`,
+			entry: "materials[0] (m)",
+			want:  "roughness",
+		},
+		{
+			name:  "Duplicate material",
+			data:  `{"materials": [{"name": "m", "type": "lambertian"}, {"name": "m", "type": "lambertian"}], "objects": []}`,
+			entry: "materials[1] (m)",
+			want:  "duplicate",
+		},
+		{
+			name:  "Bad camera",
+			data:  `{"camera": {"samples_per_pixel": 0}, "objects": []}`,
+			entry: "camera",
+			want:  "samples per pixel",
+		},
+		{
+			name:  "Degenerate camera",
+			data:  `{"camera": {"look_from": [0, 0, 1], "look_at": [0, 0, 1]}, "objects": []}`,
+			entry: "camera",
+			want:  "same point",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.data))
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("Expected a ValidationError, got %v", err)
+			}
+			if verr.Entry != tt.entry {
+				t.Errorf("Entry = %q, want %q", verr.Entry, tt.entry)
+			}
+			if !strings.Contains(verr.Error(), tt.want) {
+				t.Errorf("Error %q does not mention %q", verr.Error(), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSyntaxErrorHasPosition(t *testing.T) {
+	_, err := Parse([]byte("{\n  \"objects\": [\n    {\"type\": \"sphere\",}\n  ]\n}"))
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("Expected syntax error on line 3, got %v", err)
+	}
+}
+
+func TestLoadDefaultScene(t *testing.T) {
+	s, err := Load("../scenes/default.json")
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if len(s.World.Objects) != 5 {
+		t.Errorf("Expected 5 objects in the default scene, got %d", len(s.World.Objects))
+	}
+}
+
+func TestLoadMeshRelativeToScene(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "models"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "models", "tri.obj"), []byte("v 0 0 -1\nv 1 0 -1\nv 0 1 -1\nf 1 2 3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	scenePath := filepath.Join(dir, "scene.json")
+	data := `{
+		"materials": [{ "name": "grey", "type": "lambertian", "albedo": [0.5, 0.5, 0.5] }],
+		"objects": [
+			{ "type": "mesh", "file": "models/tri.obj", "material": "grey" },
+			{ "type": "triangle", "vertices": [[0, 0, -2], [1, 0, -2], [0, 1, -2]], "material": "grey" }
+		]
+	}`
+	if err := os.WriteFile(scenePath, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Load(scenePath)
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	mesh, ok := s.World.Objects[0].(*hittable.Mesh)
+	if !ok || len(mesh.Triangles) != 1 {
+		t.Fatalf("Expected a one-triangle mesh, got %#v", s.World.Objects[0])
+	}
+	if _, ok := s.World.Objects[1].(hittable.Triangle); !ok {
+		t.Errorf("Expected a Triangle, got %T", s.World.Objects[1])
+	}
+}
+
+func TestParseTextures(t *testing.T) {
+	data := []byte(`{
+		"textures": [{ "name": "checks", "type": "checker", "scale": 0.5, "even": [1, 1, 1], "odd": [0, 0, 0] }],
+		"materials": [{ "name": "floor", "type": "lambertian", "texture": "checks" }],
+		"objects": [{ "type": "sphere", "center": [0, -100, 0], "radius": 100, "material": "floor" }]
+	}`)
+
+	s, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	mat := hittable.UntagMaterial(s.World.Objects[0].(hittable.Sphere).Mat).(hittable.Lambertian)
+	if checker, ok := mat.Tex.(texture.Checker); !ok || checker.Scale != 0.5 {
+		t.Errorf("Expected a checker texture with scale 0.5, got %#v", mat.Tex)
+	}
+
+	_, err = Parse([]byte(`{"materials": [{ "name": "m", "type": "metal", "texture": "nope" }], "objects": []}`))
+	if err == nil || !strings.Contains(err.Error(), `materials[0] (m): unknown texture "nope"`) {
+		t.Errorf("Expected an unknown texture error, got %v", err)
+	}
+}
+
+func TestLoadCornellScene(t *testing.T) {
+	s, err := Load("../scenes/cornell.json")
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if s.Camera.Background != (camera.SolidBackground{}) {
+		t.Errorf("Expected a black background, got %#v", s.Camera.Background)
+	}
+	quad, ok := s.World.Objects[2].(hittable.Quad)
+	if !ok {
+		t.Fatalf("Expected the light to be a Quad, got %T", s.World.Objects[2])
+	}
+	if _, ok := hittable.UntagMaterial(quad.Mat).(hittable.DiffuseLight); !ok {
+		t.Errorf("Expected the light quad to use a DiffuseLight, got %T", quad.Mat)
+	}
+	if len(s.Lights.Objects) != 1 || s.Lights.Objects[0] != quad || s.Camera.Lights == nil {
+		t.Errorf("Expected the light quad to be the only sampled light, got %+v", s.Lights)
+	}
+}
+
+func TestParseMotionBlur(t *testing.T) {
+	data := []byte(`{
+		"camera": { "shutter_open": 0, "shutter_close": 1 },
+		"materials": [{ "name": "m", "type": "lambertian", "albedo": [0.5, 0.5, 0.5] }],
+		"objects": [{ "type": "moving_sphere", "center0": [0, 0, -1], "center1": [0, 0.5, -1], "time0": 0, "time1": 1, "radius": 0.2, "material": "m" }]
+	}`)
+	s, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	if s.Camera.ShutterClose != 1 {
+		t.Errorf("ShutterClose = %v, want 1", s.Camera.ShutterClose)
+	}
+	sphere, ok := s.World.Objects[0].(hittable.MovingSphere)
+	if !ok || sphere.Center1.Y != 0.5 {
+		t.Errorf("Expected a moving sphere ending at y = 0.5, got %#v", s.World.Objects[0])
+	}
+
+	_, err = Parse([]byte(`{"camera": { "shutter_open": 1, "shutter_close": 0 }, "objects": []}`))
+	if err == nil || !strings.Contains(err.Error(), "shutter_close") {
+		t.Errorf("Expected an error about the shutter interval, got %v", err)
+	}
+}
+
+func TestParseInstances(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "tri.obj"), []byte("v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	scenePath := filepath.Join(dir, "scene.json")
+	data := `{
+		"materials": [{ "name": "m", "type": "lambertian", "albedo": [0.5, 0.5, 0.5] }],
+		"objects": [
+			{ "type": "instance", "object": { "type": "mesh", "file": "tri.obj", "material": "m" },
+			  "transforms": [{ "scale": [2, 2, 2] }, { "rotate": [0, 0, 1], "degrees": 90 }, { "translate": [0, 0, -1] }] },
+			{ "type": "instance", "object": { "type": "mesh", "file": "tri.obj", "material": "m" },
+			  "transforms": [{ "matrix": [[1, 0, 0, 3], [0, 1, 0, 0], [0, 0, 1, 0], [0, 0, 0, 1]] }] }
+		]
+	}`
+	if err := os.WriteFile(scenePath, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Load(scenePath)
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	first, ok := s.World.Objects[0].(*hittable.Transform)
+	if !ok {
+		t.Fatalf("Expected a Transform, got %T", s.World.Objects[0])
+	}
+	second := s.World.Objects[1].(*hittable.Transform)
+	if first.Object != second.Object {
+		t.Errorf("Expected both instances to share one mesh")
+	}
+
+	// (1, 0, 0) is scaled to (2, 0, 0), turned to (0, 2, 0), then moved back
+	p := first.ObjectToWorld.TransformPoint(vec3.Point3{X: 1, Y: 0, Z: 0})
+	if !p.Subtract(vec3.Point3{X: 0, Y: 2, Z: -1}).NearZero() {
+		t.Errorf("Transformed point = %v, want (0, 2, -1)", p)
+	}
+
+	tests := []struct {
+		name, transforms, want string
+	}{
+		{"Two operations in one step", `[{ "translate": [1, 0, 0], "scale": [1, 1, 1] }]`, "exactly one"},
+		{"Zero axis", `[{ "rotate": [0, 0, 0], "degrees": 10 }]`, "axis"},
+		{"Singular", `[{ "scale": [1, 0, 1] }]`, "not invertible"},
+		{"Projective", `[{ "matrix": [[1, 0, 0, 0], [0, 1, 0, 0], [0, 0, 1, 0], [0, 0, 1, 0]] }]`, "affine"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := `{
+				"materials": [{ "name": "m", "type": "lambertian", "albedo": [0.5, 0.5, 0.5] }],
+				"objects": [{ "type": "instance", "object": { "type": "sphere", "center": [0, 0, 0], "radius": 1, "material": "m" }, "transforms": ` + tt.transforms + ` }]
+			}`
+			_, err := Parse([]byte(data))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected an error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestParseConstantMedium(t *testing.T) {
+	data := []byte(`{
+		"materials": [{ "name": "smoke", "type": "isotropic", "albedo": [0.8, 0.8, 0.8] }],
+		"objects": [{ "type": "constant_medium", "density": 0.2, "material": "smoke",
+		              "boundary": { "type": "sphere", "center": [0, 0, -1], "radius": 0.5, "material": "smoke" } }]
+	}`)
+	s, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	medium, ok := s.World.Objects[0].(hittable.ConstantMedium)
+	if !ok || medium.Density != 0.2 {
+		t.Fatalf("Expected a constant medium of density 0.2, got %#v", s.World.Objects[0])
+	}
+	if _, ok := medium.Boundary.(hittable.Sphere); !ok {
+		t.Errorf("Expected a sphere boundary, got %T", medium.Boundary)
+	}
+
+	_, err = Parse([]byte(`{
+		"materials": [{ "name": "smoke", "type": "isotropic", "albedo": [0.8, 0.8, 0.8] }],
+		"objects": [{ "type": "constant_medium", "density": 0.2, "material": "smoke", "boundary": { "type": "sphere", "radius": 0, "material": "smoke" } }]
+	}`))
+	if err == nil || !strings.Contains(err.Error(), "boundary: radius") {
+		t.Errorf("Expected an error pointing at the boundary, got %v", err)
+	}
+}
+
+func TestParsePrimitives(t *testing.T) {
+	data := []byte(`{
+		"materials": [
+			{ "name": "m", "type": "lambertian", "albedo": [0.5, 0.5, 0.5] },
+			{ "name": "light", "type": "diffuse_light", "emit": [4, 4, 4] }
+		],
+		"objects": [
+			{ "type": "plane", "point": [0, -0.5, 0], "normal": [0, 1, 0], "material": "m" },
+			{ "type": "disk", "center": [0, 2, -1], "normal": [0, -1, 0], "radius": 0.5, "material": "light" },
+			{ "type": "box", "min": [0, 0, -2], "max": [1, 1, -1], "material": "m" },
+			{ "type": "cylinder", "base": [0, 0, -1], "top": [0, 1, -1], "radius": 0.3, "open": true, "material": "m" },
+			{ "type": "cone", "base": [1, 0, -1], "apex": [1, 1, -1], "radius": 0.3, "material": "m" }
+		]
+	}`)
+	s, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	if _, ok := s.World.Objects[0].(hittable.Plane); !ok {
+		t.Errorf("Expected a Plane, got %T", s.World.Objects[0])
+	}
+	if _, ok := s.World.Objects[2].(hittable.Box); !ok {
+		t.Errorf("Expected a Box, got %T", s.World.Objects[2])
+	}
+	if cylinder, ok := s.World.Objects[3].(hittable.Cylinder); !ok || !cylinder.Open {
+		t.Errorf("Expected an open Cylinder, got %#v", s.World.Objects[3])
+	}
+	if cone, ok := s.World.Objects[4].(hittable.Cone); !ok || cone.Apex.Y != 1 {
+		t.Errorf("Expected a Cone with its apex at y = 1, got %#v", s.World.Objects[4])
+	}
+	if len(s.Lights.Objects) != 1 {
+		t.Errorf("Expected the emissive disk to be sampled as a light, got %d lights", len(s.Lights.Objects))
+	}
+
+	tests := []struct {
+		name, object, want string
+	}{
+		{"Zero plane normal", `{ "type": "plane", "normal": [0, 0, 0], "material": "m" }`, "normal"},
+		{"Flat box", `{ "type": "box", "min": [0, 0, 0], "max": [1, 0, 1], "material": "m" }`, "flat"},
+		{"Cylinder without top", `{ "type": "cylinder", "radius": 1, "material": "m" }`, "missing top"},
+		{"Cone with top", `{ "type": "cone", "top": [0, 1, 0], "apex": [0, 1, 0], "radius": 1, "material": "m" }`, "apex, not a top"},
+		{"Degenerate cone", `{ "type": "cone", "apex": [0, 0, 0], "radius": 1, "material": "m" }`, "must differ"},
+		{"Disk without radius", `{ "type": "disk", "normal": [0, 1, 0], "material": "m" }`, "radius"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := `{"materials": [{ "name": "m", "type": "lambertian", "albedo": [0.5, 0.5, 0.5] }], "objects": [` + tt.object + `]}`
+			_, err := Parse([]byte(data))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected an error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestParseCSG(t *testing.T) {
+	data := []byte(`{
+		"materials": [{ "name": "glass", "type": "dielectric", "refraction_index": 1.5 }],
+		"objects": [{ "type": "csg", "operation": "difference",
+		              "a": { "type": "sphere", "center": [0, 0, -1], "radius": 0.5, "material": "glass" },
+		              "b": { "type": "csg", "operation": "union",
+		                     "a": { "type": "sphere", "center": [0, 0, -1], "radius": 0.4, "material": "glass" },
+		                     "b": { "type": "box", "min": [-1, 0, -2], "max": [1, 1, 0], "material": "glass" } } }]
+	}`)
+	s, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	csg, ok := s.World.Objects[0].(hittable.CSG)
+	if !ok || csg.Op != hittable.CSGDifference {
+		t.Fatalf("Expected a CSG difference, got %#v", s.World.Objects[0])
+	}
+	if inner, ok := csg.B.(hittable.CSG); !ok || inner.Op != hittable.CSGUnion {
+		t.Errorf("Expected a nested CSG union, got %#v", csg.B)
+	}
+
+	_, err = Parse([]byte(`{
+		"materials": [{ "name": "glass", "type": "dielectric", "refraction_index": 1.5 }],
+		"objects": [{ "type": "csg", "operation": "xor",
+		              "a": { "type": "sphere", "center": [0, 0, -1], "radius": 0.5, "material": "glass" },
+		              "b": { "type": "sphere", "center": [0, 0, -1], "radius": 0.4, "material": "glass" } }]
+	}`))
+	if err == nil || !strings.Contains(err.Error(), "unknown operation") {
+		t.Errorf("Expected an unknown operation error, got %v", err)
+	}
+}
+
+func TestParsePrincipled(t *testing.T) {
+	data := []byte(`{
+		"materials": [
+			{ "name": "gold", "type": "principled", "base_color": [1, 0.8, 0.3], "roughness": 0.3, "metallic": 1 },
+			{ "name": "matte", "type": "principled", "base_color": [0.5, 0.5, 0.5], "roughness": 1, "specular": 0 }
+		],
+		"objects": [
+			{ "type": "sphere", "center": [0, 0, -1], "radius": 0.5, "material": "gold" },
+			{ "type": "sphere", "center": [1, 0, -1], "radius": 0.5, "material": "matte" }
+		]
+	}`)
+	s, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	gold := hittable.UntagMaterial(s.World.Objects[0].(hittable.Sphere).Mat).(hittable.Principled)
+	if gold.Metallic != 1 || gold.Roughness != 0.3 || gold.Specular != 0.5 {
+		t.Errorf("Unexpected gold material, specular should default to 0.5: %+v", gold)
+	}
+	matte := hittable.UntagMaterial(s.World.Objects[1].(hittable.Sphere).Mat).(hittable.Principled)
+	if matte.Specular != 0 {
+		t.Errorf("Expected an explicit specular of 0 to be kept, got %v", matte.Specular)
+	}
+
+	_, err = Parse([]byte(`{"materials": [{ "name": "m", "type": "principled", "roughness": 2 }], "objects": []}`))
+	if err == nil || !strings.Contains(err.Error(), "roughness must be between 0 and 1") {
+		t.Errorf("Expected a roughness range error, got %v", err)
+	}
+}
+
+func TestParseEnvironmentBackground(t *testing.T) {
+	dir := t.TempDir()
+	hdr := append([]byte("#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n\n-Y 1 +X 2\n"), 128, 128, 128, 130, 128, 128, 128, 129)
+	if err := os.WriteFile(filepath.Join(dir, "sky.hdr"), hdr, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	scenePath := filepath.Join(dir, "scene.json")
+	data := `{
+		"camera": { "background": { "type": "environment", "file": "sky.hdr", "intensity": 0.5, "rotation": 45 } },
+		"materials": [{ "name": "light", "type": "diffuse_light", "emit": [1, 1, 1] }],
+		"objects": [{ "type": "sphere", "center": [0, 3, 0], "radius": 1, "material": "light" }]
+	}`
+	if err := os.WriteFile(scenePath, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Load(scenePath)
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	env, ok := s.Camera.Background.(*camera.EnvironmentMap)
+	if !ok {
+		t.Fatalf("Expected an environment map background, got %T", s.Camera.Background)
+	}
+	if env.Intensity != 0.5 || env.Rotation != 45 || env.Image.Width != 2 {
+		t.Errorf("Unexpected environment map: %+v", env)
+	}
+	lights, ok := s.Camera.Lights.(hittable.SampleableList)
+	if !ok || len(lights) != 2 {
+		t.Errorf("Expected the sphere light and the environment to be sampled, got %#v", s.Camera.Lights)
+	}
+
+	_, err = Parse([]byte(`{"camera": { "background": { "type": "environment", "file": "missing.hdr" } }, "objects": []}`))
+	if err == nil || !strings.Contains(err.Error(), "camera.background") {
+		t.Errorf("Expected an error pointing at the background, got %v", err)
+	}
+}
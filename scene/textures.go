@@ -0,0 +1,63 @@
+package scene
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-tracer/src/texture"
+)
+
+type solidSpec struct {
+	header
+	Color Vec `json:"color"`
+}
+
+type checkerSpec struct {
+	header
+	Scale float64 `json:"scale"`
+	Even  Vec     `json:"even"`
+	Odd   Vec     `json:"odd"`
+}
+
+type imageSpec struct {
+	header
+	File string `json:"file"`
+}
+
+func (l *loader) parseTexture(kind string, raw json.RawMessage) (texture.Texture, error) {
+	switch kind {
+	case "solid":
+		var spec solidSpec
+		if err := decodeStrict(raw, &spec); err != nil {
+			return nil, err
+		}
+		return texture.SolidColor{Albedo: spec.Color.Vec3()}, nil
+
+	case "checker":
+		var spec checkerSpec
+		if err := decodeStrict(raw, &spec); err != nil {
+			return nil, err
+		}
+		if spec.Scale <= 0 {
+			return nil, fmt.Errorf("scale must be positive, got %v", spec.Scale)
+		}
+		return texture.Checker{
+			Scale: spec.Scale,
+			Even:  texture.SolidColor{Albedo: spec.Even.Vec3()},
+			Odd:   texture.SolidColor{Albedo: spec.Odd.Vec3()},
+		}, nil
+
+	case "image":
+		var spec imageSpec
+		if err := decodeStrict(raw, &spec); err != nil {
+			return nil, err
+		}
+		if spec.File == "" {
+			return nil, fmt.Errorf("missing file")
+		}
+		return texture.LoadImage(l.path(spec.File))
+
+	case "":
+		return nil, fmt.Errorf("missing type")
+	}
+	return nil, fmt.Errorf("unknown texture type %q", kind)
+}
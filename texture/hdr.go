@@ -0,0 +1,139 @@
+package texture
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"go-tracer/src/vec3"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// Load a Radiance RGBE (.hdr) image. Unlike PNGs, its pixels are already
+// linear radiance and may be far brighter than 1.
+func LoadHDR(path string) (*Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, err := DecodeHDR(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return img, nil
+}
+
+func DecodeHDR(r io.Reader) (*Image, error) {
+	br := bufio.NewReader(r)
+
+	magic, err := br.ReadString('\n')
+	if err != nil || !strings.HasPrefix(magic, "#?") {
+		return nil, errors.New("not a Radiance HDR file")
+	}
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("reading header: %w", err)
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if format, ok := strings.CutPrefix(line, "FORMAT="); ok && format != "32-bit_rle_rgbe" {
+			return nil, fmt.Errorf("unsupported format %q", format)
+		}
+	}
+
+	var width, height int
+	resolution, err := br.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("reading resolution: %w", err)
+	}
+	if _, err := fmt.Sscanf(resolution, "-Y %d +X %d", &height, &width); err != nil {
+		return nil, fmt.Errorf("unsupported resolution line %q (only -Y H +X W is handled)", strings.TrimSpace(resolution))
+	}
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("bad image size %dx%d", width, height)
+	}
+
+	img := &Image{Width: width, Height: height, Pixels: make([]vec3.Vec3, width*height)}
+	scanline := make([]byte, 4*width)
+	for y := 0; y < height; y++ {
+		if err := readScanline(br, scanline, width); err != nil {
+			return nil, fmt.Errorf("scanline %d: %w", y, err)
+		}
+		for x := 0; x < width; x++ {
+			img.Pixels[y*width+x] = rgbeToVec3(scanline[4*x : 4*x+4])
+		}
+	}
+	return img, nil
+}
+
+// Read one scanline of width RGBE pixels into buf, which is laid out RGBERGBE...
+func readScanline(br *bufio.Reader, buf []byte, width int) error {
+	if _, err := io.ReadFull(br, buf[:4]); err != nil {
+		return err
+	}
+
+	// Scanlines of modest width may be run-length encoded one channel at a
+	// time; they start with 2, 2 and the width
+	if width < 8 || width > 0x7fff || buf[0] != 2 || buf[1] != 2 || buf[2]&0x80 != 0 {
+		_, err := io.ReadFull(br, buf[4:])
+		return err
+	}
+	if int(buf[2])<<8|int(buf[3]) != width {
+		return errors.New("scanline width mismatch")
+	}
+
+	for channel := 0; channel < 4; channel++ {
+		for x := 0; x < width; {
+			count, err := br.ReadByte()
+			if err != nil {
+				return err
+			}
+			if count > 128 {
+				// Run of one repeated value
+				n := int(count) - 128
+				value, err := br.ReadByte()
+				if err != nil {
+					return err
+				}
+				if x+n > width {
+					return errors.New("run overflows scanline")
+				}
+				for ; n > 0; n-- {
+					buf[4*x+channel] = value
+					x++
+				}
+			} else {
+				// Literal values
+				n := int(count)
+				if n == 0 || x+n > width {
+					return errors.New("bad literal run length")
+				}
+				for ; n > 0; n-- {
+					value, err := br.ReadByte()
+					if err != nil {
+						return err
+					}
+					buf[4*x+channel] = value
+					x++
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// A shared exponent E scales all three mantissas by 2^(E-128)
+func rgbeToVec3(rgbe []byte) vec3.Vec3 {
+	if rgbe[3] == 0 {
+		return vec3.Vec3{X: 0, Y: 0, Z: 0}
+	}
+	f := math.Ldexp(1, int(rgbe[3])-(128+8))
+	return vec3.Vec3{X: float64(rgbe[0]) * f, Y: float64(rgbe[1]) * f, Z: float64(rgbe[2]) * f}
+}
@@ -0,0 +1,113 @@
+// Package texture provides colors that vary over a surface, for use as material albedos.
+package texture
+
+import (
+	"fmt"
+	"go-tracer/src/interval"
+	"go-tracer/src/vec3"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Texture gives a color for a surface point, from its (u, v) surface
+// coordinates and/or its position p in space
+type Texture interface {
+	Value(u, v float64, p vec3.Point3) vec3.Vec3
+}
+
+type SolidColor struct {
+	Albedo vec3.Vec3
+}
+
+func (s SolidColor) Value(u, v float64, p vec3.Point3) vec3.Vec3 {
+	return s.Albedo
+}
+
+// 3D checkerboard of cubes with edge length Scale, alternating between Even and Odd
+type Checker struct {
+	Scale float64
+	Even  Texture
+	Odd   Texture
+}
+
+func (c Checker) Value(u, v float64, p vec3.Point3) vec3.Vec3 {
+	inv_scale := 1.0 / c.Scale
+	x := int(math.Floor(inv_scale * p.X))
+	y := int(math.Floor(inv_scale * p.Y))
+	z := int(math.Floor(inv_scale * p.Z))
+
+	if (x+y+z)%2 == 0 {
+		return c.Even.Value(u, v, p)
+	}
+	return c.Odd.Value(u, v, p)
+}
+
+// Texture backed by an image, mapped so (0, 0) is the bottom left corner and
+// (1, 1) the top right. Pixels are stored as linear colors.
+type Image struct {
+	Width, Height int
+	Pixels        []vec3.Vec3
+}
+
+func NewImage(img image.Image) *Image {
+	bounds := img.Bounds()
+	tex := &Image{Width: bounds.Dx(), Height: bounds.Dy(), Pixels: make([]vec3.Vec3, bounds.Dx()*bounds.Dy())}
+	for y := 0; y < tex.Height; y++ {
+		for x := 0; x < tex.Width; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			// Undo the gamma 2 encoding images are written with
+			tex.Pixels[y*tex.Width+x] = vec3.Vec3{
+				X: gammaToLinear(float64(r) / 0xffff),
+				Y: gammaToLinear(float64(g) / 0xffff),
+				Z: gammaToLinear(float64(b) / 0xffff),
+			}
+		}
+	}
+	return tex
+}
+
+// Load a PNG, JPEG or Radiance HDR image as a texture
+func LoadImage(path string) (*Image, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".hdr":
+		return LoadHDR(path)
+	case ".exr":
+		return nil, fmt.Errorf("%s: OpenEXR images are not supported, convert to Radiance .hdr", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	return NewImage(img), nil
+}
+
+func (t *Image) Value(u, v float64, p vec3.Point3) vec3.Vec3 {
+	// Solid cyan makes a missing texture easy to spot
+	if t.Height <= 0 {
+		return vec3.Vec3{X: 0, Y: 1, Z: 1}
+	}
+
+	unit := interval.Interval{Min: 0, Max: 1}
+	u = unit.Clamp(u)
+	v = 1.0 - unit.Clamp(v) // Flip V to image rows, which run top to bottom
+
+	i := min(int(u*float64(t.Width)), t.Width-1)
+	j := min(int(v*float64(t.Height)), t.Height-1)
+	return t.Pixels[j*t.Width+i]
+}
+
+func gammaToLinear(gamma_component float64) float64 {
+	return gamma_component * gamma_component
+}
@@ -0,0 +1,110 @@
+package texture
+
+import (
+	"bytes"
+	"go-tracer/src/vec3"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestChecker(t *testing.T) {
+	white := vec3.Vec3{X: 1, Y: 1, Z: 1}
+	black := vec3.Vec3{}
+	checker := Checker{Scale: 1.0, Even: SolidColor{Albedo: white}, Odd: SolidColor{Albedo: black}}
+
+	tests := []struct {
+		p    vec3.Point3
+		want vec3.Vec3
+	}{
+		{vec3.Point3{X: 0.5, Y: 0.5, Z: 0.5}, white},
+		{vec3.Point3{X: 1.5, Y: 0.5, Z: 0.5}, black},
+		{vec3.Point3{X: -0.5, Y: 0.5, Z: 0.5}, black},
+		{vec3.Point3{X: 1.5, Y: 1.5, Z: 0.5}, white},
+	}
+	for _, tt := range tests {
+		if got := checker.Value(0, 0, tt.p); got != tt.want {
+			t.Errorf("Checker.Value(%v) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestImage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	img.Set(0, 0, color.RGBA{R: 255, A: 255}) // top left
+	img.Set(1, 1, color.RGBA{B: 255, A: 255}) // bottom right
+	tex := NewImage(img)
+
+	if got := tex.Value(0.1, 0.9, vec3.Point3{}); got != (vec3.Vec3{X: 1}) {
+		t.Errorf("Top left = %v, want red", got)
+	}
+	if got := tex.Value(0.9, 0.1, vec3.Point3{}); got != (vec3.Vec3{Z: 1}) {
+		t.Errorf("Bottom right = %v, want blue", got)
+	}
+	// Coordinates outside [0, 1] clamp to the edge
+	if got := tex.Value(-3, 7, vec3.Point3{}); got != (vec3.Vec3{X: 1}) {
+		t.Errorf("Clamped top left = %v, want red", got)
+	}
+}
+
+func TestDecodeHDR(t *testing.T) {
+	var data bytes.Buffer
+	data.WriteString("#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n\n-Y 2 +X 8\n")
+	// First row run-length encoded one channel at a time: all pixels are
+	// (128, 64, 32) with exponent 129, i.e. (1, 0.5, 0.25)
+	data.Write([]byte{2, 2, 0, 8})
+	for _, value := range []byte{128, 64, 32, 129} {
+		data.Write([]byte{128 + 8, value})
+	}
+	// Second row as plain RGBE pixels, the first one black and the rest (4, 4, 4)
+	data.Write([]byte{0, 0, 0, 0})
+	for i := 1; i < 8; i++ {
+		data.Write([]byte{128, 128, 128, 131})
+	}
+
+	img, err := DecodeHDR(&data)
+	if err != nil {
+		t.Fatalf("DecodeHDR() returned error: %v", err)
+	}
+	if img.Width != 8 || img.Height != 2 {
+		t.Fatalf("Size = %dx%d, want 8x2", img.Width, img.Height)
+	}
+	if got := img.Pixels[3]; got != (vec3.Vec3{X: 1, Y: 0.5, Z: 0.25}) {
+		t.Errorf("RLE pixel = %v, want (1, 0.5, 0.25)", got)
+	}
+	if got := img.Pixels[8]; got != (vec3.Vec3{}) {
+		t.Errorf("Pixel with zero exponent = %v, want black", got)
+	}
+	// Brighter than 1, which an 8-bit image can't store
+	if got := img.Pixels[15]; got != (vec3.Vec3{X: 4, Y: 4, Z: 4}) {
+		t.Errorf("Flat pixel = %v, want (4, 4, 4)", got)
+	}
+
+	tests := []struct {
+		name, data, want string
+	}{
+		{"Not HDR", "P6\n", "not a Radiance HDR file"},
+		{"XYZ", "#?RADIANCE\nFORMAT=32-bit_rle_xyze\n\n-Y 1 +X 1\n", "unsupported format"},
+		{"Flipped", "#?RADIANCE\n\n+Y 1 +X 1\n", "unsupported resolution"},
+		{"Truncated", "#?RADIANCE\n\n-Y 1 +X 2\n\x01\x01", "scanline 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeHDR(strings.NewReader(tt.data))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected an error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "sky.exr")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadImage(path); err == nil || !strings.Contains(err.Error(), "OpenEXR") {
+		t.Errorf("Expected OpenEXR to be rejected with a clear message, got %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package utils
+
+import "math/rand"
+
+// Random is a source of uniformly distributed numbers in [0, 1). Everything
+// that needs randomness during a render takes one of these, so renders can be
+// reproduced by seeding it.
+type Random interface {
+	Float64() float64
+}
+
+// Small SplitMix64 generator. It is cheap enough to create one per pixel and,
+// unlike the global math/rand source, has no lock for goroutines to fight over.
+type RNG struct {
+	state uint64
+}
+
+func NewRNG(seed uint64) *RNG {
+	return &RNG{state: seed}
+}
+
+// Restart the generator from seed, as NewRNG(seed) would
+func (r *RNG) Seed(seed uint64) {
+	r.state = seed
+}
+
+func (r *RNG) Uint64() uint64 {
+	r.state += 0x9E3779B97F4A7C15
+	return mix64(r.state)
+}
+
+func (r *RNG) Float64() float64 {
+	// Use the top 53 bits so every value is exactly representable
+	return float64(r.Uint64()>>11) / (1 << 53)
+}
+
+// Seed for the generator of pixel (i, j), so the random numbers a pixel sees
+// don't depend on which worker renders it or in what order
+func PixelSeed(seed int64, i, j int) uint64 {
+	return mix64(uint64(seed) + mix64(uint64(uint32(j))<<32|uint64(uint32(i))))
+}
+
+// Seed for one pass of a multi-pass render, so each pass draws fresh samples
+func PassSeed(seed int64, pass int) int64 {
+	return int64(mix64(uint64(seed) ^ mix64(uint64(pass)+1)))
+}
+
+func mix64(z uint64) uint64 {
+	z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+	z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+	return z ^ (z >> 31)
+}
+
+type globalRandom struct{}
+
+func (globalRandom) Float64() float64 {
+	return rand.Float64()
+}
+
+// Random backed by the global math/rand source, for callers that don't care
+// about reproducibility
+var GlobalRandom Random = globalRandom{}
+
+func RandomRange(rnd Random, min, max float64) float64 {
+	return min + (max-min)*rnd.Float64()
+}
@@ -25,3 +25,33 @@ func Test(t *testing.T) {
 		t.Errorf("RandomDoubleRange(0.0, 10.0) = %f; expected %f (both are the same)", result, expected)
 	}
 }
+
+func TestRNG(t *testing.T) {
+	a := NewRNG(42)
+	b := NewRNG(42)
+	for i := 0; i < 100; i++ {
+		x, y := a.Float64(), b.Float64()
+		if x != y {
+			t.Fatalf("Same seed gave different values at draw %d: %f vs %f", i, x, y)
+		}
+		if x < 0 || x >= 1 {
+			t.Fatalf("Float64() = %f; expected a value in [0, 1)", x)
+		}
+	}
+
+	if NewRNG(1).Float64() == NewRNG(2).Float64() {
+		t.Errorf("Different seeds gave the same first value")
+	}
+}
+
+func TestPixelSeed(t *testing.T) {
+	if PixelSeed(7, 3, 4) != PixelSeed(7, 3, 4) {
+		t.Errorf("PixelSeed() is not deterministic")
+	}
+	if PixelSeed(7, 3, 4) == PixelSeed(7, 4, 3) {
+		t.Errorf("PixelSeed() should distinguish (3, 4) from (4, 3)")
+	}
+	if PixelSeed(7, 3, 4) == PixelSeed(8, 3, 4) {
+		t.Errorf("PixelSeed() should depend on the render seed")
+	}
+}
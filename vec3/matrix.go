@@ -0,0 +1,131 @@
+package vec3
+
+import (
+	"go-tracer/src/utils"
+	"math"
+)
+
+// Row-major 4x4 affine transform, applied to column vectors: M * [x y z 1]^T
+type Mat4 [4][4]float64
+
+func Identity() Mat4 {
+	return Mat4{
+		{1, 0, 0, 0},
+		{0, 1, 0, 0},
+		{0, 0, 1, 0},
+		{0, 0, 0, 1},
+	}
+}
+
+func Translation(offset Vec3) Mat4 {
+	m := Identity()
+	m[0][3] = offset.X
+	m[1][3] = offset.Y
+	m[2][3] = offset.Z
+	return m
+}
+
+func Scaling(factors Vec3) Mat4 {
+	m := Identity()
+	m[0][0] = factors.X
+	m[1][1] = factors.Y
+	m[2][2] = factors.Z
+	return m
+}
+
+// Rotation by degrees counter-clockwise about axis (looking down the axis
+// towards the origin), using Rodrigues' formula
+func Rotation(axis Vec3, degrees float64) Mat4 {
+	a := *axis.UnitVector()
+	theta := utils.DegreesToRadians(degrees)
+	c := math.Cos(theta)
+	s := math.Sin(theta)
+	t := 1 - c
+
+	return Mat4{
+		{t*a.X*a.X + c, t*a.X*a.Y - s*a.Z, t*a.X*a.Z + s*a.Y, 0},
+		{t*a.X*a.Y + s*a.Z, t*a.Y*a.Y + c, t*a.Y*a.Z - s*a.X, 0},
+		{t*a.X*a.Z - s*a.Y, t*a.Y*a.Z + s*a.X, t*a.Z*a.Z + c, 0},
+		{0, 0, 0, 1},
+	}
+}
+
+// Matrix product m * n, i.e. the transform that applies n first and then m
+func (m Mat4) Multiply(n Mat4) Mat4 {
+	var result Mat4
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			for k := 0; k < 4; k++ {
+				result[i][j] += m[i][k] * n[k][j]
+			}
+		}
+	}
+	return result
+}
+
+func (m Mat4) Transpose() Mat4 {
+	var result Mat4
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			result[i][j] = m[j][i]
+		}
+	}
+	return result
+}
+
+// Inverse by Gauss-Jordan elimination with partial pivoting. Returns false
+// if the matrix is singular (e.g. a scale of zero along some axis).
+func (m Mat4) Inverse() (Mat4, bool) {
+	a := m
+	inv := Identity()
+
+	for col := 0; col < 4; col++ {
+		pivot := col
+		for row := col + 1; row < 4; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return Mat4{}, false
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		inv[col], inv[pivot] = inv[pivot], inv[col]
+
+		scale := 1 / a[col][col]
+		for k := 0; k < 4; k++ {
+			a[col][k] *= scale
+			inv[col][k] *= scale
+		}
+
+		for row := 0; row < 4; row++ {
+			if row == col {
+				continue
+			}
+			factor := a[row][col]
+			for k := 0; k < 4; k++ {
+				a[row][k] -= factor * a[col][k]
+				inv[row][k] -= factor * inv[col][k]
+			}
+		}
+	}
+	return inv, true
+}
+
+// Transform a position, including the translation part
+func (m Mat4) TransformPoint(p Point3) Point3 {
+	return Point3{
+		X: m[0][0]*p.X + m[0][1]*p.Y + m[0][2]*p.Z + m[0][3],
+		Y: m[1][0]*p.X + m[1][1]*p.Y + m[1][2]*p.Z + m[1][3],
+		Z: m[2][0]*p.X + m[2][1]*p.Y + m[2][2]*p.Z + m[2][3],
+	}
+}
+
+// Transform a direction, ignoring the translation part
+func (m Mat4) TransformVector(v Vec3) Vec3 {
+	return Vec3{
+		X: m[0][0]*v.X + m[0][1]*v.Y + m[0][2]*v.Z,
+		Y: m[1][0]*v.X + m[1][1]*v.Y + m[1][2]*v.Z,
+		Z: m[2][0]*v.X + m[2][1]*v.Y + m[2][2]*v.Z,
+	}
+}
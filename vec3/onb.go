@@ -0,0 +1,53 @@
+package vec3
+
+import (
+	"go-tracer/src/utils"
+	"math"
+)
+
+// Orthonormal basis whose W axis is a given direction, used to turn directions
+// sampled around +Z into directions around that axis
+type ONB struct {
+	U, V, W Vec3
+}
+
+func NewONB(n Vec3) ONB {
+	w := *n.UnitVector()
+	a := Vec3{X: 1, Y: 0, Z: 0}
+	if math.Abs(w.X) > 0.9 {
+		a = Vec3{X: 0, Y: 1, Z: 0}
+	}
+	v := *w.Cross(a).UnitVector()
+	u := *w.Cross(v)
+	return ONB{U: u, V: v, W: w}
+}
+
+// Express a vector given in basis coordinates in world coordinates
+func (o ONB) Transform(a Vec3) Vec3 {
+	return o.U.MultiplyFloat(a.X).Add(*o.V.MultiplyFloat(a.Y)).Add(*o.W.MultiplyFloat(a.Z))
+}
+
+// Direction in the +Z hemisphere, with density proportional to cos(theta)
+func RandomCosineDirection(rnd utils.Random) Vec3 {
+	r1 := rnd.Float64()
+	r2 := rnd.Float64()
+
+	phi := 2 * math.Pi * r1
+	x := math.Cos(phi) * math.Sqrt(r2)
+	y := math.Sin(phi) * math.Sqrt(r2)
+	z := math.Sqrt(1 - r2)
+	return Vec3{X: x, Y: y, Z: z}
+}
+
+// Direction towards a sphere of the given radius whose center is at squared
+// distance distance_squared along +Z, uniform over the cone it subtends
+func RandomToSphere(rnd utils.Random, radius, distance_squared float64) Vec3 {
+	r1 := rnd.Float64()
+	r2 := rnd.Float64()
+	z := 1 + r2*(math.Sqrt(1-radius*radius/distance_squared)-1)
+
+	phi := 2 * math.Pi * r1
+	x := math.Cos(phi) * math.Sqrt(1-z*z)
+	y := math.Sin(phi) * math.Sqrt(1-z*z)
+	return Vec3{X: x, Y: y, Z: z}
+}
@@ -21,6 +21,8 @@ type Point3 = Vec3
 type Ray struct {
 	Origin    Point3
 	Direction Vec3
+	Time      float64 // moment within the camera's shutter interval the ray exists at
+	FreePath  float64 // uniform number in [0, 1) the integrator drew for this ray, from which fog picks how far the ray gets
 }
 
 // Ray functions
@@ -33,6 +35,10 @@ func (r Ray) GetDirection() Vec3 {
 	return r.Direction
 }
 
+func (r Ray) GetTime() float64 {
+	return r.Time
+}
+
 func (r Ray) At(t float64) Vec3 {
 
 	return r.GetOrigin().Add(*r.GetDirection().MultiplyFloat(t))
@@ -107,6 +113,12 @@ func (v Vec3) LinearToGamma(linear_component float64) float64 {
 
 // Simulating the << overload, but writing our own String() method
 func (v Vec3) String(samples_per_pixel int) string {
+	r, g, b := v.RGB(samples_per_pixel)
+	return fmt.Sprintf("%d %d %d", r, g, b)
+}
+
+// Average the accumulated samples, gamma correct and quantize to [0, 255]
+func (v Vec3) RGB(samples_per_pixel int) (int, int, int) {
 	r := v.GetX()
 	g := v.GetY()
 	b := v.GetZ()
@@ -121,9 +133,9 @@ func (v Vec3) String(samples_per_pixel int) string {
 	b = v.LinearToGamma(b)
 
 	var intensity interval.Interval = interval.Interval{Min: 0.000, Max: 0.999}
-	return fmt.Sprintf("%d %d %d", int(COLOR_MAX_INT*intensity.Clamp(r)),
-		int(COLOR_MAX_INT*intensity.Clamp(g)),
-		int(COLOR_MAX_INT*intensity.Clamp(b)))
+	return int(COLOR_MAX_INT * intensity.Clamp(r)),
+		int(COLOR_MAX_INT * intensity.Clamp(g)),
+		int(COLOR_MAX_INT * intensity.Clamp(b))
 }
 
 func (v Vec3) Add(v2 Vec3) Vec3 {
@@ -158,36 +170,56 @@ func (v Vec3) UnitVector() *Vec3 {
 	return v.DivideFloat(v.Length())
 }
 
-func (v Vec3) RandomInUnitDisk() Vec3 {
-	p := Vec3{X: utils.RandomDoubleRange(-1, 1), Y: utils.RandomDoubleRange(-1, 1), Z: 0}
-	if p.LengthSquared() < 1.0 {
-		return p
+func (v Vec3) RandomInUnitDisk(rnd utils.Random) Vec3 {
+	for {
+		p := Vec3{X: utils.RandomRange(rnd, -1, 1), Y: utils.RandomRange(rnd, -1, 1), Z: 0}
+		if p.LengthSquared() < 1.0 {
+			return p
+		}
+	}
+}
+
+// Uniform point in the unit disk (Z = 0) from exactly two random numbers,
+// using Shirley and Chiu's concentric mapping. Unlike RandomInUnitDisk it
+// never rejects, so well spread numbers give well spread points.
+func SampleUnitDisk(rnd utils.Random) Vec3 {
+	a := 2*rnd.Float64() - 1
+	b := 2*rnd.Float64() - 1
+	if a == 0 && b == 0 {
+		return Vec3{}
+	}
+	var r, phi float64
+	if math.Abs(a) > math.Abs(b) {
+		r, phi = a, (math.Pi/4)*(b/a)
+	} else {
+		r, phi = b, math.Pi/2-(math.Pi/4)*(a/b)
 	}
-	return p.RandomInUnitDisk()
+	return Vec3{X: r * math.Cos(phi), Y: r * math.Sin(phi), Z: 0}
 }
 
-func (v Vec3) Random() *Vec3 {
-	return &Vec3{X: utils.RandomDouble(), Y: utils.RandomDouble(), Z: utils.RandomDouble()}
+func (v Vec3) Random(rnd utils.Random) *Vec3 {
+	return &Vec3{X: rnd.Float64(), Y: rnd.Float64(), Z: rnd.Float64()}
 }
 
-func (v Vec3) RandomRange(min, max float64) *Vec3 {
-	return &Vec3{X: utils.RandomDoubleRange(min, max), Y: utils.RandomDoubleRange(min, max), Z: utils.RandomDoubleRange(min, max)}
+func (v Vec3) RandomRange(rnd utils.Random, min, max float64) *Vec3 {
+	return &Vec3{X: utils.RandomRange(rnd, min, max), Y: utils.RandomRange(rnd, min, max), Z: utils.RandomRange(rnd, min, max)}
 }
 
-func (v Vec3) RandomInUnitSphere() *Vec3 {
-	p := v.RandomRange(-1, 1)
-	if p.LengthSquared() < 1 {
-		return v.RandomInUnitSphere()
+func (v Vec3) RandomInUnitSphere(rnd utils.Random) *Vec3 {
+	for {
+		p := v.RandomRange(rnd, -1, 1)
+		if p.LengthSquared() < 1 {
+			return p
+		}
 	}
-	return p
 }
 
-func (v Vec3) RandomUnitVector() *Vec3 {
-	return v.RandomInUnitSphere().UnitVector()
+func (v Vec3) RandomUnitVector(rnd utils.Random) *Vec3 {
+	return v.RandomInUnitSphere(rnd).UnitVector()
 }
 
-func (v Vec3) RandomOnHemiSphere(normal *Vec3) *Vec3 {
-	on_unit_sphere := v.RandomUnitVector()
+func (v Vec3) RandomOnHemiSphere(rnd utils.Random, normal *Vec3) *Vec3 {
+	on_unit_sphere := v.RandomUnitVector(rnd)
 	if on_unit_sphere.Dot(*normal) > 0.0 {
 		return on_unit_sphere
 	} else {
@@ -132,3 +132,63 @@ func TestVec3Reflect(t *testing.T) {
 	want := Vec3{1, 1, 0}
 	almostEqual(t, result, want, "Vector reflection")
 }
+
+func TestMat4Transforms(t *testing.T) {
+	p := Point3{1, 2, 3}
+
+	almostEqual(t, Translation(Vec3{1, -1, 2}).TransformPoint(p), Point3{2, 1, 5}, "Translated point")
+	almostEqual(t, Translation(Vec3{1, -1, 2}).TransformVector(p), p, "Translation leaves directions alone")
+	almostEqual(t, Scaling(Vec3{2, 3, -1}).TransformPoint(p), Point3{2, 6, -3}, "Scaled point")
+	almostEqual(t, Rotation(Vec3{0, 1, 0}, 90).TransformPoint(Point3{1, 0, 0}), Point3{0, 0, -1}, "Rotation about Y")
+	almostEqual(t, Rotation(Vec3{0, 0, 2}, 90).TransformPoint(Point3{1, 0, 0}), Point3{0, 1, 0}, "Rotation about an unnormalised Z")
+
+	// Multiply applies the right-hand matrix first
+	m := Translation(Vec3{0, 0, 5}).Multiply(Scaling(Vec3{2, 2, 2}))
+	almostEqual(t, m.TransformPoint(p), Point3{2, 4, 11}, "Scale then translate")
+}
+
+func TestMat4Inverse(t *testing.T) {
+	m := Translation(Vec3{1, 2, 3}).Multiply(Rotation(Vec3{1, 1, 0}, 37)).Multiply(Scaling(Vec3{2, 0.5, -3}))
+	inv, ok := m.Inverse()
+	if !ok {
+		t.Fatalf("Expected the matrix to be invertible")
+	}
+	identity := m.Multiply(inv)
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			floatAlmostEqual(t, identity[i][j], Identity()[i][j], "m * m^-1")
+		}
+	}
+
+	if _, ok := Scaling(Vec3{1, 0, 1}).Inverse(); ok {
+		t.Errorf("Expected a zero scale to be singular")
+	}
+}
+
+// Hands out fixed numbers in turn
+type fixedRandom struct {
+	values []float64
+}
+
+func (f *fixedRandom) Float64() float64 {
+	v := f.values[0]
+	f.values = f.values[1:]
+	return v
+}
+
+func TestSampleUnitDisk(t *testing.T) {
+	tests := []struct {
+		u1, u2 float64
+		want   Vec3
+	}{
+		{0.5, 0.5, Vec3{}},
+		{1, 0.5, Vec3{X: 1, Y: 0, Z: 0}},
+		{0.5, 1, Vec3{X: 0, Y: 1, Z: 0}},
+		{0, 0.5, Vec3{X: -1, Y: 0, Z: 0}},
+		{1, 1, Vec3{X: math.Sqrt2 / 2, Y: math.Sqrt2 / 2, Z: 0}},
+	}
+	for _, tt := range tests {
+		got := SampleUnitDisk(&fixedRandom{values: []float64{tt.u1, tt.u2}})
+		almostEqual(t, got, tt.want, "SampleUnitDisk")
+	}
+}